@@ -0,0 +1,259 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bao
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+)
+
+const (
+	transitCachePrefix    = "transit:"
+	secretCachePrefix     = "secret:"
+	transitKeyCachePrefix = "transit-key:"
+)
+
+// Cache stores the decrypted transit values, the secrets and the transit key lookups of a SecretInjector.
+// A cache shared by injector instances (or persisted) saves their lookups, e.g. for short-lived jobs.
+// Implementations have to be safe for concurrent use.
+//
+// The cached values are plaintext secrets: an implementation backed by an external store
+// (e.g. Redis) makes them readable by anyone with access to that store, and persists them
+// beyond the lifetime of the process and of their Bao leases. Only use such a cache if the store
+// is trusted at least as much as the workloads reading the secrets, encrypt the values at rest
+// and in transit, and expire them no later than their leases.
+type Cache interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte)
+	Delete(key string)
+}
+
+// MemoryCache is the default in-memory Cache implementation.
+type MemoryCache struct {
+	mu    sync.RWMutex
+	items map[string][]byte
+}
+
+// NewMemoryCache creates an empty in-memory cache.
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{items: map[string][]byte{}}
+}
+
+func (c *MemoryCache) Get(key string) ([]byte, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	value, ok := c.items[key]
+
+	return value, ok
+}
+
+func (c *MemoryCache) Set(key string, value []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.items[key] = value
+}
+
+func (c *MemoryCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.items, key)
+}
+
+// cachedSecret is the cached form of a secret read from a path.
+type cachedSecret struct {
+	Data    map[string]interface{} `json:"data"`
+	Lease   *SecretLease           `json:"lease,omitempty"`
+	Version int                    `json:"version,omitempty"`
+}
+
+func (i *SecretInjector) cachedTransitSecret(ciphertext string) ([]byte, bool) {
+	return i.cache.Get(transitCachePrefix + ciphertext)
+}
+
+func (i *SecretInjector) cacheTransitSecret(ciphertext string, plaintext []byte) {
+	i.cache.Set(transitCachePrefix+ciphertext, plaintext)
+}
+
+// injectionWritesKey is the context key of the writes of an injection.
+type injectionWritesKey struct{}
+
+// injectionWrites are the results of the writes (>>bao:) of one injection. They aren't stored in the Cache,
+// every injection writes again, but the references of the same write within an injection share its result
+// (e.g. the certificate and the private key of one PKI issue).
+type injectionWrites struct {
+	mu      sync.Mutex
+	results map[string]baoPathResult
+}
+
+// withInjectionWrites returns a context holding the writes of an injection, unless ctx already holds them,
+// so the nested injections of inline references share them with the outer one.
+func withInjectionWrites(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(injectionWritesKey{}).(*injectionWrites); ok {
+		return ctx
+	}
+
+	return context.WithValue(ctx, injectionWritesKey{}, &injectionWrites{results: map[string]baoPathResult{}})
+}
+
+// injectionWrite returns the result of a write of the injection of ctx, its data is nil if it wasn't written yet.
+func injectionWrite(ctx context.Context, key string) baoPathResult {
+	writes, ok := ctx.Value(injectionWritesKey{}).(*injectionWrites)
+	if !ok {
+		return baoPathResult{}
+	}
+
+	writes.mu.Lock()
+	defer writes.mu.Unlock()
+
+	return writes.results[key]
+}
+
+// recordInjectionWrite stores the result of a write for the rest of the injection of ctx.
+func recordInjectionWrite(ctx context.Context, key string, write baoPathResult) {
+	writes, ok := ctx.Value(injectionWritesKey{}).(*injectionWrites)
+	if !ok {
+		return
+	}
+
+	writes.mu.Lock()
+	defer writes.mu.Unlock()
+
+	writes.results[key] = write
+}
+
+// cachedSecret returns the cached data and lease of a path#version key, data is nil if it isn't cached.
+func (i *SecretInjector) cachedSecret(key string) (map[string]interface{}, *SecretLease) {
+	read := i.cachedRead(key)
+
+	return read.data, read.lease
+}
+
+// cachedRead returns the cached read of a path#version key, its data is nil if it isn't cached.
+func (i *SecretInjector) cachedRead(key string) baoPathResult {
+	value, ok := i.cache.Get(secretCachePrefix + key)
+	if !ok {
+		return baoPathResult{}
+	}
+
+	var secret cachedSecret
+
+	decoder := json.NewDecoder(bytes.NewReader(value))
+	decoder.UseNumber()
+	if err := decoder.Decode(&secret); err != nil {
+		i.logger.Warn("dropping undecodable cached secret")
+		i.cache.Delete(secretCachePrefix + key)
+
+		return baoPathResult{}
+	}
+
+	return baoPathResult{data: secret.Data, lease: secret.Lease, version: secret.Version}
+}
+
+func (i *SecretInjector) cacheSecret(key string, data map[string]interface{}, lease *SecretLease) error {
+	return i.cacheRead(key, baoPathResult{data: data, lease: lease})
+}
+
+func (i *SecretInjector) cacheRead(key string, read baoPathResult) error {
+	value, err := json.Marshal(cachedSecret{Data: read.data, Lease: read.lease, Version: read.version})
+	if err != nil {
+		return errors.Wrap(err, "failed to encode secret for caching")
+	}
+
+	i.cache.Set(secretCachePrefix+key, value)
+
+	i.mu.Lock()
+	i.secretKeys[key] = true
+	i.mu.Unlock()
+
+	return nil
+}
+
+// cachedSecrets returns the data of all cached secrets of this injector by their path#version keys.
+func (i *SecretInjector) cachedSecrets() map[string]map[string]interface{} {
+	i.mu.RLock()
+	keys := make([]string, 0, len(i.secretKeys))
+	for key := range i.secretKeys {
+		keys = append(keys, key)
+	}
+	i.mu.RUnlock()
+
+	secrets := make(map[string]map[string]interface{}, len(keys))
+	for _, key := range keys {
+		if data, _ := i.cachedSecret(key); data != nil {
+			secrets[key] = data
+		}
+	}
+
+	return secrets
+}
+
+// uncacheSecrets drops the cached secrets of this injector whose keys match.
+func (i *SecretInjector) uncacheSecrets(match func(key string) bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	for key := range i.secretKeys {
+		if match(key) {
+			i.cache.Delete(secretCachePrefix + key)
+			delete(i.secretKeys, key)
+		}
+	}
+}
+
+// cachedTransitKey reports if the existence of a transit key is cached, and not older than Config.TransitKeyCacheTTL.
+func (i *SecretInjector) cachedTransitKey(transitPath, keyID string) bool {
+	value, ok := i.cache.Get(transitKeyCacheKey(transitPath, keyID))
+	if !ok {
+		return false
+	}
+
+	if i.config.TransitKeyCacheTTL <= 0 {
+		return true
+	}
+
+	// the lookup may come from another host, so its age is compared with the tolerance of the clock skew:
+	// a lookup from the future is skewed beyond the tolerance, and lookups expire earlier by the tolerance
+	checkedAt, err := time.Parse(time.RFC3339Nano, string(value))
+	age := time.Since(checkedAt)
+	if err != nil || age < -i.config.ClockSkewTolerance || age > i.config.TransitKeyCacheTTL-i.config.ClockSkewTolerance {
+		i.cache.Delete(transitKeyCacheKey(transitPath, keyID))
+
+		return false
+	}
+
+	return true
+}
+
+// cacheTransitKey caches the existence of a transit key, missing keys aren't cached, since they may be created any time.
+func (i *SecretInjector) cacheTransitKey(transitPath, keyID string) {
+	i.cache.Set(transitKeyCacheKey(transitPath, keyID), []byte(time.Now().Format(time.RFC3339Nano)))
+}
+
+func transitKeyCacheKey(transitPath, keyID string) string {
+	if transitPath == "" {
+		transitPath = "transit"
+	}
+
+	return transitKeyCachePrefix + path.Join(transitPath, keyID)
+}
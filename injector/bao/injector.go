@@ -15,16 +15,33 @@
 package bao
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
+	"math"
+	"net/url"
+	"os"
+	"os/signal"
+	"reflect"
 	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"text/template"
+	"time"
 
 	"emperror.dev/errors"
 	baoapi "github.com/hashicorp/vault/api"
 	"github.com/spf13/cast"
+	"golang.org/x/sync/singleflight"
 
 	"github.com/bank-vaults/vault-sdk/utils/templater"
 	bao "github.com/bank-vaults/vault-sdk/vault"
@@ -32,42 +49,360 @@ import (
 
 type SecretInjectorFunc func(key, value string)
 
+// SecretInjectorFuncE is a SecretInjectorFunc which can fail, e.g. if it writes the secrets to a file.
+type SecretInjectorFuncE func(key, value string) error
+
+// SecretLeaseInjectorFunc receives the lease of the secret next to the value, lease is nil if the secret has none.
+type SecretLeaseInjectorFunc func(key, value string, lease *SecretLease)
+
+// SecretLease is the lease of a dynamic secret as it was read.
+// ExpiresAt doesn't reflect later renewals of the lease. It's derived from the relative TTL reported by Bao
+// and the local clock at the time of the read, so prefer Duration for decisions, which doesn't depend on the clocks.
+type SecretLease struct {
+	ID        string
+	Duration  time.Duration
+	ExpiresAt time.Time
+	Renewable bool
+}
+
 type SecretRenewer interface {
 	Renew(path string, secret *baoapi.Secret) error
 }
 
+// SecretRenewerWithDone can be implemented by a SecretRenewer to report when the renewal of a secret stops
+// (e.g. because its lease got revoked), the returned channel behaves like baoapi.LifetimeWatcher.DoneCh.
+// In DaemonMode the cached data of the path is dropped then, so the next access reads it again.
+type SecretRenewerWithDone interface {
+	RenewWithDone(path string, secret *baoapi.Secret) (<-chan error, error)
+}
+
 type Config struct {
-	TransitKeyID         string
-	TransitPath          string
-	TransitBatchSize     int
+	TransitKeyID string
+	TransitPath  string
+	// TransitBatchSize is the number of transit secrets decrypted with one request.
+	// If it's 0 or negative, it's derived from the average ciphertext size so a request
+	// takes at most half of TransitMaxRequestSize.
+	TransitBatchSize int
+	// TransitMaxRequestSize is the max_request_size of the Bao listener, it defaults to Bao's 32 MiB.
+	TransitMaxRequestSize int
+	// TransitConcurrency is the max number of transit batch decryptions in flight at the same time,
+	// across all the injections of the injector, 0 means unlimited. The batches of one injection
+	// are decrypted one after another, so it bounds the load of concurrent injections on the transit engine.
+	TransitConcurrency int
+	// TransitValueTransform is applied to the decrypted transit values before they are cached and injected,
+	// e.g. to decode a base64 encoded binary value.
+	TransitValueTransform func([]byte) ([]byte, error)
+	// KVValueTransform is applied to the values read from paths (not to the transit values and placeholders)
+	// before they are injected, so transit and KV values can be transformed differently.
+	KVValueTransform func([]byte) ([]byte, error)
+	// ValueTransforms are made available in the transform pipelines of references (e.g. bao:secret/data/app#key|name),
+	// besides the built-in ones. A transform with the same name overrides the built-in one.
+	ValueTransforms      map[string]func([]byte) ([]byte, error)
 	IgnoreMissingSecrets bool
-	DaemonMode           bool
+	// MissingValuePlaceholder is injected for the missing paths and keys instead of skipping them
+	// if IgnoreMissingSecrets is set, so the set of injected variables doesn't depend on which secrets exist.
+	// For a missing path of InjectSecretsFromBaoPath it's only injected for the explicitly listed keys.
+	// The placeholders are subject to the EnvNamePolicy and MaxValueSize just like the values.
+	MissingValuePlaceholder *string
+	// MissingSecretLogLevel is the level of the logs about missing paths and keys ignored due to IgnoreMissingSecrets,
+	// it defaults to slog.LevelWarn. Use LogLevelNone to suppress them, e.g. if the secrets are optional.
+	MissingSecretLogLevel *slog.Level
+	// WarningHandler receives the warnings Bao returned for a path (e.g. about a TTL exceeding the max TTL)
+	// instead of them being logged, the read fails if it returns an error, so certain warnings can be treated as errors.
+	WarningHandler func(path string, warnings []string) error
+	// MissingSecretRetry retries the reads of paths which don't exist (yet), e.g. if they are written
+	// by another job right after the consumer starts. Other errors (e.g. permission denied) aren't retried.
+	MissingSecretRetry MissingSecretRetry
+	DaemonMode         bool
+	// OnSecretChange is called by Reload for each path whose data changed, with its data before and after the reload.
+	// It's called after the changed values are injected, without holding any lock of the injector,
+	// so it may use the injector (but shouldn't call Reload synchronously, which would wait for it).
+	OnSecretChange func(path string, old, new map[string]interface{})
+	// TemplateFuncs are made available in template keys (e.g. bao:secret/data/db#${printf "%s:%s" .user .pass}),
+	// besides the Sprig and custom functions listed by templater.Templater.FuncNames.
+	// A function with the same name overrides the built-in one.
+	TemplateFuncs template.FuncMap
+	// WriteCAS makes writes (>>bao:) treat the data as a KV version 2 secret and write it with check-and-set,
+	// retrying WriteCASRetries times if the secret was changed concurrently.
+	WriteCAS        bool
+	WriteCASRetries int
+	// AggregateErrors makes the injection go on after a failed reference, and return the errors
+	// of all failed references combined, instead of returning on the first one.
+	AggregateErrors bool
+	// PathVars are substituted into the {{.name}} placeholders of references before they are parsed
+	// (e.g. bao:{{.mount}}/data/app#password), so the same references can target different environments.
+	PathVars map[string]string
+	// EnvNamePolicy is applied to the variable names which aren't valid environment variable names
+	// (e.g. keys containing dots injected by InjectSecretsFromBaoPath), they are injected as they are by default.
+	EnvNamePolicy EnvNamePolicy
+	// ServingNodeHeader is the response header identifying the Bao node which served a read,
+	// it's logged with each read to be able to correlate failures with the nodes of an HA cluster.
+	// Bao doesn't send such a header by default, configure it with custom_response_headers on the listeners.
+	ServingNodeHeader string
+	// EmptySecretPolicy decides what happens if a path exists, but its secret has no data
+	// (e.g. all of its keys were removed, or its latest version was deleted).
+	// By default a key lookup in such a secret fails with an EmptySecretError, and InjectSecretsFromBaoPath injects nothing.
+	EmptySecretPolicy EmptySecretPolicy
+	// MaxValueSize is the max size in bytes of an injected value, 0 means unlimited.
+	// Huge environment variables make exec fail with E2BIG, so this catches a file-sized secret referenced by mistake.
+	MaxValueSize int
+	// OversizedValuePolicy decides what happens to the values larger than MaxValueSize,
+	// by default the injection fails with an OversizedValueError.
+	OversizedValuePolicy OversizedValuePolicy
+	// PathTimeouts overrides the timeout of the client for the requests to the paths starting with its keys
+	// (e.g. database/creds/ for a slow dynamic secrets engine), the longest matching prefix wins.
+	PathTimeouts map[string]time.Duration
+	// TokenPassthroughName is the variable which receives the token of the client with the bao:login reference,
+	// it defaults to BAO_TOKEN.
+	TokenPassthroughName string
+	// RecordVersions records the KV version 2 versions the variables were injected from,
+	// including the latest versions resolved for the references without a version, see ResolvedVersions.
+	RecordVersions bool
+	// AuditManifestPath is the file a JSON AuditManifest is written to at the end of every injection of references,
+	// listing the injected variables with their references, source paths and versions, and the SHA-256 hashes
+	// of their values (but not the values), e.g. as a record of the secret configuration a workload received.
+	AuditManifestPath string
+	// StrictKVMetadata fails the reads of KV version 2 secrets without metadata, by default the data is used
+	// with an unknown version, as some KV version 2 compatible implementations (e.g. proxies) don't return metadata.
+	StrictKVMetadata bool
+	// OutputFormat is the file format written by RenderFile, it defaults to OutputFormatEnv.
+	OutputFormat OutputFormat
+	// OutputEncoders add encoders for custom formats to RenderFile, or override the built-in ones.
+	OutputEncoders map[OutputFormat]OutputEncoder
+	// Cache stores the decrypted transit values, the read secrets and the transit key lookups of Validate,
+	// it defaults to a MemoryCache. See the Cache documentation before plugging in an external store.
+	Cache Cache
+	// TransitKeyCacheTTL is how long the existence of the transit key is cached by Validate, 0 means forever.
+	TransitKeyCacheTTL time.Duration
+	// ClockSkewTolerance is the max difference between the clocks of the hosts sharing a Cache.
+	// The timestamps stored in the cache are compared with the local clock allowing for it, they are considered
+	// expired earlier by it. The other expiries are based on the relative TTLs of Bao and the monotonic clock,
+	// so they aren't affected by skew.
+	ClockSkewTolerance time.Duration
+}
+
+// MissingSecretRetry configures the retries of reading a missing path.
+type MissingSecretRetry struct {
+	// Attempts is the number of retries after the first read, 0 means no retries.
+	Attempts int
+	// Interval is the time waited before each retry.
+	Interval time.Duration
+}
+
+// EmptySecretPolicy decides what happens to the secrets without data.
+type EmptySecretPolicy string
+
+const (
+	// EmptySecretFail fails the injection with an EmptySecretError, even in InjectSecretsFromBaoPath
+	EmptySecretFail EmptySecretPolicy = "error"
+	// EmptySecretAsMissing handles the secret like a missing path, so IgnoreMissingSecrets and MissingValuePlaceholder apply
+	EmptySecretAsMissing EmptySecretPolicy = "missing"
+)
+
+// EmptySecretError means that a path exists, but its secret has no data.
+type EmptySecretError struct {
+	Path string
+}
+
+func (e *EmptySecretError) Error() string {
+	return fmt.Sprintf("secret has no data under path: %s", e.Path)
+}
+
+// OversizedValuePolicy decides what happens to the values larger than Config.MaxValueSize.
+type OversizedValuePolicy string
+
+const (
+	// OversizedValueFail fails the injection with an OversizedValueError
+	OversizedValueFail OversizedValuePolicy = "error"
+	// OversizedValueSkip logs a warning and skips the variable
+	OversizedValueSkip OversizedValuePolicy = "skip"
+)
+
+// OversizedValueError means that a value is larger than Config.MaxValueSize.
+type OversizedValueError struct {
+	Name    string
+	Size    int
+	MaxSize int
+}
+
+func (e *OversizedValueError) Error() string {
+	return fmt.Sprintf("value of variable %s is %d bytes, larger than the limit of %d bytes", e.Name, e.Size, e.MaxSize)
+}
+
+// checkValueSize applies the OversizedValuePolicy to a value, ok is false if the variable has to be skipped.
+func (i *SecretInjector) checkValueSize(name string, size int) (bool, error) {
+	if i.config.MaxValueSize <= 0 || size <= i.config.MaxValueSize {
+		return true, nil
+	}
+
+	if i.config.OversizedValuePolicy == OversizedValueSkip {
+		i.logger.Warn("value is too large, skipping variable", slog.String("variable", name), slog.Int("size", size), slog.Int("max-size", i.config.MaxValueSize))
+
+		return false, nil
+	}
+
+	return false, &OversizedValueError{Name: name, Size: size, MaxSize: i.config.MaxValueSize}
+}
+
+// checkEmptySecret applies the EmptySecretPolicy to the data read from a path, it returns nil data for a missing path.
+func (i *SecretInjector) checkEmptySecret(path string, data map[string]interface{}) (map[string]interface{}, error) {
+	if data == nil || len(data) > 0 {
+		return data, nil
+	}
+
+	switch i.config.EmptySecretPolicy {
+	case EmptySecretFail:
+		return nil, &EmptySecretError{Path: path}
+	case EmptySecretAsMissing:
+		return nil, nil
+	default:
+		return data, nil
+	}
 }
 
+// EnvNamePolicy decides what happens to the variable names which aren't valid environment variable names,
+// i.e. don't match [A-Za-z_][A-Za-z0-9_]*.
+type EnvNamePolicy string
+
+const (
+	// EnvNameError fails the injection
+	EnvNameError EnvNamePolicy = "error"
+	// EnvNameSkip skips the variable with a warning
+	EnvNameSkip EnvNamePolicy = "skip"
+	// EnvNameSanitize replaces the invalid characters with underscores, and prefixes a leading digit with one,
+	// an injection fails if two names are sanitized to the same one (e.g. DB.HOST and DB_HOST)
+	EnvNameSanitize EnvNamePolicy = "sanitize"
+)
+
+// SecretInjector resolves references to secrets in Bao.
+// The client isn't modified by the injector, so one client can be shared by many injectors
+// (e.g. one per request of a server) to reuse its connections and token. The limits of the client
+// (ClientMaxConcurrentRequests) apply to all of them together then.
 type SecretInjector struct {
-	mu           sync.RWMutex
-	config       Config
-	client       *bao.Client
-	renewer      SecretRenewer
-	logger       *slog.Logger
-	transitCache map[string][]byte
-	secretCache  map[string]map[string]interface{}
+	mu         sync.RWMutex
+	config     Config
+	client     *bao.Client
+	renewer    SecretRenewer
+	logger     *slog.Logger
+	cache      Cache
+	secretKeys map[string]bool
+	// renewals are the lease IDs with an active renewal
+	renewals map[string]bool
+	// versions are the paths and versions the variables were injected from,
+	// if Config.RecordVersions or Config.AuditManifestPath is set
+	versions map[string]ResolvedVersion
+	// reads deduplicates the concurrent reads of the same path
+	reads singleflight.Group
+	// transitSlots limits the concurrent transit batch decryptions if Config.TransitConcurrency is set
+	transitSlots chan struct{}
+
+	// tracked references of DaemonMode injections, for Reload
+	reloadMu sync.Mutex
+	tracked  map[string]trackedReference
+}
+
+type trackedReference struct {
+	value  string
+	inject SecretLeaseInjectorFunc
+	// fingerprint is the hash of the last injected value
+	fingerprint string
 }
 
 func NewSecretInjector(config Config, client *bao.Client, renewer SecretRenewer, logger *slog.Logger) SecretInjector {
+	cache := config.Cache
+	if cache == nil {
+		cache = NewMemoryCache()
+	}
+
+	var transitSlots chan struct{}
+	if config.TransitConcurrency > 0 {
+		transitSlots = make(chan struct{}, config.TransitConcurrency)
+	}
+
 	return SecretInjector{
 		config:       config,
 		client:       client,
 		renewer:      renewer,
 		logger:       logger,
-		transitCache: map[string][]byte{},
-		secretCache:  map[string]map[string]interface{}{},
+		cache:        cache,
+		secretKeys:   map[string]bool{},
+		renewals:     map[string]bool{},
+		versions:     map[string]ResolvedVersion{},
+		tracked:      map[string]trackedReference{},
+		transitSlots: transitSlots,
+	}
+}
+
+// ResolvedVersion is the KV version 2 secret version a variable was injected from.
+type ResolvedVersion struct {
+	Path    string
+	Version int
+}
+
+// ResolvedVersions returns the versions the variables were injected from by their names, if Config.RecordVersions is set,
+// so the same versions can be pinned later (e.g. bao:secret/data/app#password#3) for a reproducible deployment.
+// The variables injected from other engines than KV version 2 aren't included.
+func (i *SecretInjector) ResolvedVersions() map[string]ResolvedVersion {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	versions := make(map[string]ResolvedVersion, len(i.versions))
+	if !i.config.RecordVersions {
+		return versions
+	}
+
+	for name, version := range i.versions {
+		if version.Version != 0 {
+			versions[name] = version
+		}
+	}
+
+	return versions
+}
+
+// recordVersion records the path and version a variable was injected from, for ResolvedVersions and the audit manifest.
+func (i *SecretInjector) recordVersion(name, path string, version int) {
+	if !i.config.RecordVersions && i.config.AuditManifestPath == "" {
+		return
 	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.versions[name] = ResolvedVersion{Path: path, Version: version}
 }
 
+// LogLevelNone can be set as Config.MissingSecretLogLevel to suppress the logs about missing secrets.
+const LogLevelNone = slog.Level(math.MaxInt)
+
+// defaultTokenPassthroughName is the default of Config.TokenPassthroughName.
+const defaultTokenPassthroughName = "BAO_TOKEN"
+
+// loginReference is the path of the bao:login reference, which is resolved to the token of the client.
+const loginReference = "login"
+
+// mergePrefix marks a comma separated list of paths to be merged into one key set.
+const mergePrefix = "merge:"
+
+// namespacePrefix marks the Bao namespace of a reference (e.g. bao:ns=team-a:secret/data/app#key).
+const namespacePrefix = "ns="
+
+// namespaceKey is the context key of the namespace of the reference being read.
+type namespaceKey struct{}
+
+// bypassCacheKey is the context key which makes the reads of a reload bypass the secret cache.
+type bypassCacheKey struct{}
+
 var inlineMutationRegex = regexp.MustCompile(`\${([>]{0,2}bao:.*?#*}?)}`)
 
+var envFileValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "\n", `\n`, "\r", `\r`)
+
 func (i *SecretInjector) FetchTransitSecrets(secrets []string) (map[string][]byte, error) {
+	return i.FetchTransitSecretsWithContext(context.Background(), secrets)
+}
+
+// FetchTransitSecretsWithContext works like FetchTransitSecrets, but the decryption is cancelled once ctx is done.
+func (i *SecretInjector) FetchTransitSecretsWithContext(ctx context.Context, secrets []string) (map[string][]byte, error) {
 	if len(i.config.TransitKeyID) == 0 {
 		return map[string][]byte{}, errors.Errorf("found encrypted variable, but transit key ID is empty: %s", "todo")
 	}
@@ -76,20 +411,160 @@ func (i *SecretInjector) FetchTransitSecrets(secrets []string) (map[string][]byt
 		return map[string][]byte{}, nil
 	}
 
-	out, err := i.client.Transit.DecryptBatch(i.config.TransitPath, i.config.TransitKeyID, secrets)
+	release, err := i.acquireTransitSlot(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := i.client.Transit.DecryptBatchWithContext(ctx, i.config.TransitPath, i.config.TransitKeyID, secrets)
+	release()
+	if bao.IsKeyNotFound(err) {
+		return nil, i.transitKeyNotFound()
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
 	if err != nil {
 		i.logger.Error(fmt.Sprintf("failed to decrypt variable: %s", err))
 	}
 
-	i.mu.Lock()
 	for k, v := range out {
-		i.transitCache[k] = v
+		v, err := i.transformTransitValue(v)
+		if err != nil {
+			return nil, err
+		}
+
+		out[k] = v
+		i.cacheTransitSecret(k, v)
 	}
-	i.mu.Unlock()
 
 	return out, nil
 }
 
+func (i *SecretInjector) tokenPassthroughName() string {
+	if i.config.TokenPassthroughName != "" {
+		return i.config.TokenPassthroughName
+	}
+
+	return defaultTokenPassthroughName
+}
+
+// acquireTransitSlot waits for a free transit decryption slot if Config.TransitConcurrency is set,
+// and returns a function which releases it.
+func (i *SecretInjector) acquireTransitSlot(ctx context.Context) (func(), error) {
+	if i.transitSlots == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case i.transitSlots <- struct{}{}:
+		return func() { <-i.transitSlots }, nil
+	case <-ctx.Done():
+		return nil, errors.Wrap(ctx.Err(), "waiting for a free transit decryption slot")
+	}
+}
+
+// transformTransitValue applies Config.TransitValueTransform to a decrypted transit value.
+func (i *SecretInjector) transformTransitValue(value []byte) ([]byte, error) {
+	if i.config.TransitValueTransform == nil {
+		return value, nil
+	}
+
+	value, err := i.config.TransitValueTransform(value)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to transform decrypted transit value")
+	}
+
+	return value, nil
+}
+
+func (i *SecretInjector) transformKVValue(value SecretString) (SecretString, error) {
+	if i.config.KVValueTransform == nil {
+		return value, nil
+	}
+
+	transformed, err := i.config.KVValueTransform([]byte(value.Reveal()))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to transform secret value")
+	}
+
+	return SecretString(transformed), nil
+}
+
+// logMissing logs a missing secret ignored due to IgnoreMissingSecrets at the configured level.
+func (i *SecretInjector) logMissing(msg string) {
+	level := slog.LevelWarn
+	if i.config.MissingSecretLogLevel != nil {
+		level = *i.config.MissingSecretLogLevel
+	}
+
+	if level == LogLevelNone {
+		return
+	}
+
+	i.logger.Log(context.Background(), level, msg)
+}
+
+// Validate checks the configuration against Bao, so misconfigurations (e.g. a wrong transit key name)
+// are reported clearly before any secret is injected.
+func (i *SecretInjector) Validate(ctx context.Context) error {
+	if i.config.TransitKeyID == "" || i.cachedTransitKey(i.config.TransitPath, i.config.TransitKeyID) {
+		return nil
+	}
+
+	exists, err := i.client.Transit.KeyExists(ctx, i.config.TransitPath, i.config.TransitKeyID)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return i.transitKeyNotFound()
+	}
+
+	i.cacheTransitKey(i.config.TransitPath, i.config.TransitKeyID)
+
+	return nil
+}
+
+func (i *SecretInjector) transitKeyNotFound() error {
+	transitPath := i.config.TransitPath
+	if transitPath == "" {
+		transitPath = "transit"
+	}
+
+	return errors.Errorf("transit key '%s' not found at path '%s'", i.config.TransitKeyID, transitPath)
+}
+
+const (
+	defaultTransitMaxRequestSize = 32 << 20
+	// transitBatchItemOverhead is the JSON encoding overhead of a ciphertext in a batch request
+	transitBatchItemOverhead = len(`{"ciphertext":""},`)
+)
+
+// transitBatchSize returns the configured batch size, or derives one from the average size of the ciphertexts,
+// using half of the maximum request size to leave room for the JSON escaping and headers.
+func (i *SecretInjector) transitBatchSize(secrets []string) int {
+	if i.config.TransitBatchSize > 0 {
+		return i.config.TransitBatchSize
+	}
+
+	if len(secrets) == 0 {
+		return 1
+	}
+
+	maxRequestSize := i.config.TransitMaxRequestSize
+	if maxRequestSize <= 0 {
+		maxRequestSize = defaultTransitMaxRequestSize
+	}
+
+	total := 0
+	for _, secret := range secrets {
+		total += len(secret) + transitBatchItemOverhead
+	}
+
+	return max(1, maxRequestSize/2/(total/len(secrets)))
+}
+
 func paginate(secrets []string, batchSize int) [][]string {
 	transitSecrets := [][]string{}
 
@@ -106,7 +581,7 @@ func paginate(secrets []string, batchSize int) [][]string {
 	return transitSecrets
 }
 
-func (i *SecretInjector) preprocessTransitSecrets(references *map[string]string, inject SecretInjectorFunc) error {
+func (i *SecretInjector) preprocessTransitSecrets(ctx context.Context, references *map[string]string, inject SecretInjectorFunc) error {
 	// use set so that we don't have duplicates
 	secretSet := map[string]bool{}
 
@@ -125,18 +600,18 @@ func (i *SecretInjector) preprocessTransitSecrets(references *map[string]string,
 
 	// convert back to slice & filter out already-cached secrets
 	secrets := make([]string, 0, len(secretSet))
-	i.mu.RLock()
-	for k := range secretSet {
-		if _, cached := i.transitCache[k]; !cached {
+	for _, k := range sortedKeys(secretSet) {
+		if _, cached := i.cachedTransitSecret(k); !cached {
 			secrets = append(secrets, k)
 		}
 	}
-	i.mu.RUnlock()
 
-	for _, sec := range paginate(secrets, i.config.TransitBatchSize) {
-		_, err := i.FetchTransitSecrets(sec)
+	for _, sec := range paginate(secrets, i.transitBatchSize(secrets)) {
+		start := time.Now()
+		_, err := i.FetchTransitSecretsWithContext(ctx, sec)
+		i.logger.Debug("transit secrets decrypted with Bao", slog.Int("count", len(sec)), slog.Duration("latency", time.Since(start)))
 		if err != nil {
-			if !i.config.IgnoreMissingSecrets {
+			if !i.config.IgnoreMissingSecrets || ctx.Err() != nil {
 				return errors.Wrapf(err, "failed to decrypt secret: %s", sec)
 			}
 
@@ -144,16 +619,15 @@ func (i *SecretInjector) preprocessTransitSecrets(references *map[string]string,
 		}
 	}
 
-	for name, value := range *references {
+	for _, name := range sortedKeys(*references) {
+		value := (*references)[name]
 		if HasInlineBaoDelimiters(value) {
 			newValue := value
-			i.mu.RLock()
 			for _, baoSecretReference := range FindInlineBaoDelimiters(value) {
-				if v, ok := i.transitCache[baoSecretReference[0]]; ok {
+				if v, ok := i.cachedTransitSecret(baoSecretReference[0]); ok {
 					newValue = strings.Replace(value, baoSecretReference[0], string(v), -1)
 				}
 			}
-			i.mu.RUnlock()
 
 			// Only inject the value if its content has been updated using the transit cache
 			if value != newValue {
@@ -166,11 +640,9 @@ func (i *SecretInjector) preprocessTransitSecrets(references *map[string]string,
 			continue
 		}
 		if i.client.Transit.IsEncrypted(value) {
-			i.mu.RLock()
-			v, ok := i.transitCache[value]
-			i.mu.RUnlock()
-			if ok {
-				inject(name, string(v))
+			if cached, ok := i.cachedTransitSecret(value); ok {
+				i.logger.Debug("transit secret served from cache", slog.String("variable", name))
+				inject(name, SecretString(cached).Reveal())
 
 				continue
 			}
@@ -180,252 +652,1179 @@ func (i *SecretInjector) preprocessTransitSecrets(references *map[string]string,
 	return nil
 }
 
+// InjectSecretsFromBao resolves the references and injects the results.
+// The injection order is deterministic: the transit encrypted values come first, then the rest, both sorted by name.
+//
+// A KV version 2 reference may select a version after the key (bao:secret/data/app#password#2),
+// or a version relative to the latest one with ~ (bao:secret/data/app#password#~1 is the version before the latest).
+// Relative versions are counted on the version numbers, so deleted and destroyed versions count as well.
+// A key containing # has to be escaped with a backslash (bao:secret/data/app#app\#1).
+// Several paths can be merged into one key set with the merge: prefix (bao:merge:secret/data/common,secret/data/app#key),
+// the later paths override the keys of the earlier ones.
+// A key may end with a type hint (:int, :bool, :float or :duration, e.g. bao:secret/data/app#port:int),
+// then the injection fails if the value doesn't parse as that type. The : of a key ending with a type name
+// is escaped with a backslash (bao:secret/data/app#timeout\:duration reads the timeout:duration key).
+// A key starting with $ is a field selector for nested values (bao:secret/data/db#$.connection.password),
+// $ is the secret data the plain keys are looked up in (the data of a KV version 2 secret), followed by
+// .field steps and [index] steps for lists (e.g. $.hosts[0].address).
+// A key (or template) may be followed by a pipeline of transforms applied to the value in order
+// (bao:secret/data/app#certificate|base64decode|trimspace), after the type hint if there is one (#port:int|trimspace),
+// then the type is checked on the transformed value. The built-in transforms are base64decode, base64encode,
+// urldecode and trimspace, more can be added with Config.ValueTransforms. A | before the name of a transform
+// is escaped with a backslash if it's part of the key (bao:secret/data/app#a\|trimspace).
+// A reference may be read from another Bao namespace than the one of the client with the ns= prefix
+// (bao:ns=team-a:secret/data/app#key), so one injection can read from several namespaces.
 func (i *SecretInjector) InjectSecretsFromBao(references map[string]string, inject SecretInjectorFunc) error {
-	err := i.preprocessTransitSecrets(&references, inject)
-	if err != nil && !i.config.IgnoreMissingSecrets {
-		return errors.Wrapf(err, "unable to preprocess transit secrets")
-	}
+	return i.InjectSecretsFromBaoWithContext(context.Background(), references, inject)
+}
 
-	for name, value := range references {
-		if HasInlineBaoDelimiters(value) {
-			for _, baoSecretReference := range FindInlineBaoDelimiters(value) {
-				mapData, err := i.GetDataFromBao(map[string]string{name: baoSecretReference[1]})
-				if err != nil {
-					return err
-				}
-				for _, v := range mapData {
-					value = strings.Replace(value, baoSecretReference[0], v, -1)
-				}
-			}
-			inject(name, value)
+// InjectSecretsFromBaoWithContext works like InjectSecretsFromBao, but all Bao requests
+// (reads, writes and transit decryptions) are cancelled once ctx is done, and the injection returns ctx.Err() then.
+func (i *SecretInjector) InjectSecretsFromBaoWithContext(ctx context.Context, references map[string]string, inject SecretInjectorFunc) error {
+	return i.injectSecretsWithLeases(ctx, references, func(key, value string, _ *SecretLease) {
+		inject(key, value)
+	}, nil)
+}
 
-			continue
-		}
+// InjectSecretsFromBaoE works like InjectSecretsFromBao, but stops on the first error returned by inject,
+// and returns it. The secrets already injected aren't rolled back.
+func (i *SecretInjector) InjectSecretsFromBaoE(references map[string]string, inject SecretInjectorFuncE) error {
+	var injectErr error
 
-		var update bool
-		if strings.HasPrefix(value, ">>bao:") {
-			value = strings.TrimPrefix(value, ">>")
-			update = true
-		} else {
-			update = false
+	err := i.injectSecretsWithLeases(context.Background(), references, func(key, value string, _ *SecretLease) {
+		if injectErr != nil {
+			return
 		}
 
-		if !strings.HasPrefix(value, "bao:") {
-			inject(name, value)
-
-			continue
+		if err := inject(key, value); err != nil {
+			injectErr = errors.WithMessagef(err, "failed to inject variable: %s", key)
 		}
+	}, func() error {
+		return injectErr
+	})
+	if injectErr != nil {
+		return injectErr
+	}
 
-		valuePath := strings.TrimPrefix(value, "bao:")
-
-		// handle special case for bao:login env value
-		// namely pass through the BAO_TOKEN received from the Bao login procedure
-		if name == "BAO_TOKEN" && valuePath == "login" {
-			value = i.client.RawClient().Token()
-			inject(name, value)
+	return err
+}
 
-			continue
-		}
+// InjectSecretsWithLeasesFromBao works like InjectSecretsFromBao, but passes the lease of
+// dynamic secrets (e.g. database credentials) along with their values, so they can be rotated proactively.
+// In DaemonMode the references are tracked, so Reload can inject them again.
+func (i *SecretInjector) InjectSecretsWithLeasesFromBao(references map[string]string, inject SecretLeaseInjectorFunc) error {
+	return i.injectSecretsWithLeases(context.Background(), references, inject, nil)
+}
 
-		// decrypts value with Bao Transit Secret Engine
-		if i.client.Transit.IsEncrypted(value) {
-			if len(i.config.TransitKeyID) == 0 {
-				return errors.Errorf("found encrypted variable, but transit key ID is empty: %s", name)
+// injectSecretsWithLeases injects the references, aborting once abort (if not nil) returns an error.
+func (i *SecretInjector) injectSecretsWithLeases(ctx context.Context, references map[string]string, inject SecretLeaseInjectorFunc, abort func() error) error {
+	if i.config.EnvNamePolicy != "" {
+		checked := make(map[string]string, len(references))
+		originals := make(map[string]string, len(references))
+		for original, value := range references {
+			name, ok, err := i.envName(original)
+			if err != nil {
+				return err
 			}
 
-			i.mu.RLock()
-			v, ok := i.transitCache[value]
-			i.mu.RUnlock()
-			if ok {
-				inject(name, string(v))
-
+			if !ok {
 				continue
 			}
 
-			out, err := i.client.Transit.Decrypt(i.config.TransitPath, i.config.TransitKeyID, []byte(value))
-			if err != nil {
-				if !i.config.IgnoreMissingSecrets {
-					return errors.Wrapf(err, "failed to decrypt variable: %s", name)
-				}
+			if err := checkEnvNameCollision(originals, name, original); err != nil {
+				return err
+			}
+			checked[name] = value
+		}
+		references = checked
+	}
 
-				i.logger.Error(fmt.Sprintf("failed to decrypt variable: %s", err), slog.String("variable", name))
+	if i.config.AuditManifestPath == "" {
+		return i.injectSecretsTracked(ctx, references, inject, abort)
+	}
 
-				continue
-			}
+	injections := &auditInjections{references: references, hashes: map[string]string{}}
+	err := i.injectSecretsTracked(ctx, references, injections.recording(inject), abort)
+	if manifestErr := i.writeAuditManifest(injections); manifestErr != nil {
+		return errors.Combine(err, manifestErr)
+	}
 
-			i.mu.Lock()
-			i.transitCache[value] = out
-			i.mu.Unlock()
+	return err
+}
 
-			inject(name, string(out))
+// injectSecretsTracked injects the references, tracking them for Reload in DaemonMode.
+func (i *SecretInjector) injectSecretsTracked(ctx context.Context, references map[string]string, inject SecretLeaseInjectorFunc, abort func() error) error {
+	if !i.config.DaemonMode {
+		return i.injectSecretsUntil(ctx, references, inject, abort)
+	}
 
-			continue
+	i.reloadMu.Lock()
+	for name, value := range references {
+		i.tracked[name] = trackedReference{value: value, inject: inject}
+	}
+	i.reloadMu.Unlock()
+
+	return i.injectSecretsUntil(ctx, references, func(key, value string, lease *SecretLease) {
+		i.reloadMu.Lock()
+		if reference, ok := i.tracked[key]; ok {
+			reference.fingerprint = fingerprint(value)
+			i.tracked[key] = reference
 		}
+		i.reloadMu.Unlock()
+
+		inject(key, value, lease)
+	}, abort)
+}
 
-		split := strings.SplitN(valuePath, "#", 3)
-		valuePath = split[0]
+func (i *SecretInjector) injectSecrets(ctx context.Context, references map[string]string, inject SecretLeaseInjectorFunc) error {
+	return i.injectSecretsUntil(ctx, references, inject, nil)
+}
 
-		if len(split) < 2 {
-			return errors.New("secret data key or template not defined")
+// injectSecretsUntil injects the references, and stops once ctx is done or abort (if not nil) returns an error.
+func (i *SecretInjector) injectSecretsUntil(ctx context.Context, references map[string]string, inject SecretLeaseInjectorFunc, abort func() error) error {
+	if abort == nil {
+		abort = func() error { return nil }
+	}
+	ctx = withInjectionWrites(ctx)
+	abortOrDone := func() error {
+		if err := ctx.Err(); err != nil {
+			return err
 		}
 
-		key := split[1]
+		return abort()
+	}
 
-		versionOrData := "-1"
-		if update {
-			versionOrData = "{}"
+	// the injected values are checked against MaxValueSize, the error of an oversized one is returned
+	// for the reference which injected it
+	var oversized []error
+	checkedInject := func(key, value string, lease *SecretLease) {
+		ok, err := i.checkValueSize(key, len(value))
+		if err != nil {
+			oversized = append(oversized, err)
+		}
+		if ok {
+			inject(key, value, lease)
+		}
+	}
+	takeOversized := func(err error) error {
+		if err == nil {
+			err = errors.Combine(oversized...)
 		}
-		if len(split) == 3 {
-			versionOrData = split[2]
+		oversized = nil
+
+		return err
+	}
+
+	err := i.preprocessTransitSecrets(ctx, &references, func(key, value string) {
+		checkedInject(key, value, nil)
+	})
+	if err := abortOrDone(); err != nil {
+		return err
+	}
+	var errs []error
+
+	if err := takeOversized(nil); err != nil {
+		if !i.config.AggregateErrors {
+			return err
 		}
 
-		secretCacheKey := valuePath + "#" + versionOrData
-		var data map[string]interface{}
-		var err error
+		errs = append(errs, err)
+	}
 
-		i.mu.RLock()
-		if data = i.secretCache[secretCacheKey]; data == nil {
-			data, err = i.readBaoPath(valuePath, versionOrData, update)
+	if err != nil && !i.config.IgnoreMissingSecrets {
+		if !i.config.AggregateErrors {
+			return errors.Wrapf(err, "unable to preprocess transit secrets")
 		}
-		i.mu.RUnlock()
 
-		if err != nil {
+		errs = append(errs, errors.WithMessage(err, "unable to preprocess transit secrets"))
+	}
+
+	for _, name := range sortedKeys(references) {
+		err := i.injectSecretFromBao(ctx, name, references[name], checkedInject)
+		if err := abortOrDone(); err != nil {
 			return err
 		}
-
-		if data == nil {
-			if !i.config.IgnoreMissingSecrets {
-				return errors.Errorf("path not found: %s", valuePath)
+		err = takeOversized(err)
+		if err != nil {
+			if !i.config.AggregateErrors {
+				return err
 			}
-			i.logger.Warn(fmt.Sprintf("path not found %s", valuePath))
 
-			continue
+			errs = append(errs, errors.WithMessagef(err, "variable %s", name))
 		}
+	}
 
-		i.mu.Lock()
-		i.secretCache[secretCacheKey] = data
-		i.mu.Unlock()
-
-		templater := templater.NewTemplater(templater.DefaultLeftDelimiter, templater.DefaultRightDelimiter)
+	return errors.Combine(errs...)
+}
 
-		if templater.IsGoTemplate(key) {
-			value, err := templater.Template(key, data)
+func (i *SecretInjector) injectSecretFromBao(ctx context.Context, name, value string, inject SecretLeaseInjectorFunc) error {
+	if HasInlineBaoDelimiters(value) {
+		resolved := SecretString(value)
+		for _, baoSecretReference := range FindInlineBaoDelimiters(value) {
+			mapData, err := i.getDataFromBao(ctx, map[string]string{name: baoSecretReference[1]})
 			if err != nil {
-				return errors.Wrapf(err, "failed to interpolate template key with bao data: %s", key)
+				return err
 			}
-			inject(name, value.String())
-		} else {
-			if value, ok := data[key]; ok {
-				value, err := cast.ToStringE(value)
-				if err != nil {
-					return errors.Wrap(err, "value can't be cast to a string")
-				}
-				inject(name, value)
-			} else {
-				return errors.Errorf("key '%s' not found under path: %s", key, valuePath)
+			for _, v := range mapData {
+				resolved = SecretString(strings.Replace(resolved.Reveal(), baoSecretReference[0], v, -1))
 			}
 		}
+		inject(name, resolved.Reveal(), nil)
+
+		return nil
 	}
 
-	return nil
-}
+	var update bool
+	if strings.HasPrefix(value, ">>bao:") {
+		value = strings.TrimPrefix(value, ">>")
+		update = true
+	} else {
+		update = false
+	}
 
-func (i *SecretInjector) InjectSecretsFromBaoPath(paths string, inject SecretInjectorFunc) error {
-	baoPaths := strings.Split(paths, ",")
+	if !strings.HasPrefix(value, "bao:") {
+		inject(name, value, nil)
 
-	for _, path := range baoPaths {
-		split := strings.SplitN(path, "#", 2)
-		valuePath := split[0]
+		return nil
+	}
 
-		version := "-1"
+	valuePath := strings.TrimPrefix(value, "bao:")
 
-		if len(split) == 2 {
-			version = split[1]
-		}
+	// handle special case for bao:login env value
+	// namely pass through the token received from the Bao login procedure
+	if name == i.tokenPassthroughName() && valuePath == loginReference {
+		token := SecretString(i.client.RawClient().Token())
+		inject(name, token.Reveal(), nil)
 
-		data, err := i.readBaoPath(valuePath, version, false)
-		if err != nil {
-			return err
+		return nil
+	}
+
+	// decrypts value with Bao Transit Secret Engine
+	if i.client.Transit.IsEncrypted(value) {
+		if len(i.config.TransitKeyID) == 0 {
+			return errors.Errorf("found encrypted variable, but transit key ID is empty: %s", name)
 		}
 
-		if data == nil {
-			if !i.config.IgnoreMissingSecrets {
-				return errors.Errorf("path not found: %s", valuePath)
-			}
-			i.logger.Warn(fmt.Sprintf("path not found %s", valuePath))
+		if cached, ok := i.cachedTransitSecret(value); ok {
+			i.logger.Debug("transit secret served from cache", slog.String("variable", name))
+			inject(name, SecretString(cached).Reveal(), nil)
 
-			continue
+			return nil
 		}
 
-		for key, value := range data {
-			value, err := cast.ToStringE(value)
-			if err != nil {
-				return errors.Wrap(err, "value can't be cast to a string for key: "+key)
-			}
-			inject(key, value)
+		start := time.Now()
+		out, err := i.client.Transit.DecryptWithContext(ctx, i.config.TransitPath, i.config.TransitKeyID, []byte(value))
+		i.logger.Debug("transit secret decrypted with Bao", slog.String("variable", name), slog.Duration("latency", time.Since(start)))
+		if bao.IsKeyNotFound(err) {
+			err = i.transitKeyNotFound()
 		}
-	}
-
-	return nil
-}
-
-func (i *SecretInjector) readBaoPath(path, versionOrData string, update bool) (map[string]interface{}, error) {
-	var secretData map[string]interface{}
+		if err != nil {
+			if !i.config.IgnoreMissingSecrets || ctx.Err() != nil {
+				return errors.Wrapf(err, "failed to decrypt variable: %s", name)
+			}
 
-	var secret *baoapi.Secret
-	var err error
+			i.logger.Error(fmt.Sprintf("failed to decrypt variable: %s", err), slog.String("variable", name))
 
-	if update {
-		var data map[string]interface{}
-		err = json.Unmarshal([]byte(versionOrData), &data)
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to unmarshal data for writing")
+			return nil
 		}
 
-		secret, err = i.client.RawClient().Logical().Write(path, data)
+		out, err = i.transformTransitValue(out)
 		if err != nil {
-			return nil, errors.Wrapf(err, "failed to write secret to path: %s", path)
+			return errors.WithMessagef(err, "variable: %s", name)
+		}
+
+		i.cacheTransitSecret(value, out)
+
+		inject(name, SecretString(out).Reveal(), nil)
+
+		return nil
+	}
+
+	valuePath, err := i.renderPathTemplate(valuePath)
+	if err != nil {
+		return err
+	}
+
+	ref, err := i.parseReference(valuePath, update)
+	if err != nil {
+		return err
+	}
+	if ref.hasNamespace {
+		ctx = context.WithValue(ctx, namespaceKey{}, ref.namespace)
+	}
+	valuePath, key, versionOrData := ref.path, ref.key, ref.versionOrData
+	transforms, typeHint := ref.transforms, ref.typeHint
+
+	secretCacheKey := secretCacheKey(ctx, valuePath, versionOrData, update)
+
+	// the cache is safe for concurrent use, no lock is held here to not block the writers during the read.
+	// Writes aren't cached, they are only shared within the injection.
+	var read baoPathResult
+	if update {
+		read = injectionWrite(ctx, secretCacheKey)
+	} else if bypass, _ := ctx.Value(bypassCacheKey{}).(bool); !bypass {
+		read = i.cachedRead(secretCacheKey)
+	}
+	if read.data == nil {
+		start := time.Now()
+		read, err = i.readBaoPathOnce(ctx, valuePath, versionOrData, update)
+		i.logger.Debug("secret read from Bao", slog.String("variable", name), slog.String("path", valuePath), slog.Duration("latency", time.Since(start)))
+	} else {
+		i.logger.Debug("secret served from cache", slog.String("variable", name), slog.String("path", valuePath))
+	}
+
+	if err != nil {
+		return err
+	}
+
+	data, err := i.checkEmptySecret(valuePath, read.data)
+	if err != nil {
+		return err
+	}
+
+	if data == nil {
+		if !i.config.IgnoreMissingSecrets {
+			return errors.Errorf("path not found: %s", valuePath)
+		}
+		i.logMissing(fmt.Sprintf("path not found %s", valuePath))
+
+		if placeholder := i.config.MissingValuePlaceholder; placeholder != nil {
+			inject(name, *placeholder, nil)
+		}
+
+		return nil
+	}
+
+	read.data = data
+	if update {
+		recordInjectionWrite(ctx, secretCacheKey, read)
+	} else if err := i.cacheRead(secretCacheKey, read); err != nil {
+		return err
+	}
+
+	i.recordVersion(name, valuePath, read.version)
+	lease := read.lease
+
+	templater := templater.NewTemplater(templater.DefaultLeftDelimiter, templater.DefaultRightDelimiter).WithFuncs(i.config.TemplateFuncs)
+
+	if templater.IsGoTemplate(key) {
+		rendered, err := templater.Template(key, data)
+		if err != nil {
+			return errors.Wrapf(err, "failed to interpolate template key with bao data: %s", key)
+		}
+		transformed, err := i.transformKVValue(SecretString(rendered.String()))
+		if err != nil {
+			return errors.WithMessagef(err, "variable %s", name)
+		}
+		if transformed, err = i.applyTransforms(transformed, transforms); err != nil {
+			return errors.WithMessagef(err, "variable %s", name)
+		}
+		if err := validateTypeHint(transformed, typeHint); err != nil {
+			return errors.WithMessagef(err, "variable %s", name)
+		}
+		inject(name, transformed.Reveal(), lease)
+	} else {
+		value, ok, err := lookupKey(data, key)
+		if err != nil {
+			return errors.WithMessagef(err, "path: %s", valuePath)
+		}
+
+		if ok {
+			value, err := toSecretString(value)
+			if err != nil {
+				return errors.WithMessagef(err, "key '%s' under path: %s", key, valuePath)
+			}
+			transformed, err := i.transformKVValue(value)
+			if err != nil {
+				return errors.WithMessagef(err, "key '%s' under path: %s", key, valuePath)
+			}
+			if transformed, err = i.applyTransforms(transformed, transforms); err != nil {
+				return errors.WithMessagef(err, "key '%s' under path: %s", key, valuePath)
+			}
+			if err := validateTypeHint(transformed, typeHint); err != nil {
+				return errors.WithMessagef(err, "key '%s' under path: %s", key, valuePath)
+			}
+			inject(name, transformed.Reveal(), lease)
+		} else if placeholder := i.config.MissingValuePlaceholder; placeholder != nil && i.config.IgnoreMissingSecrets {
+			i.logMissing(fmt.Sprintf("key '%s' not found under path: %s", key, valuePath))
+			inject(name, *placeholder, lease)
+		} else if len(data) == 0 {
+			return &EmptySecretError{Path: valuePath}
+		} else {
+			return errors.Errorf("key '%s' not found under path: %s", key, valuePath)
+		}
+	}
+
+	return nil
+}
+
+// InjectSecretsFromBaoPath injects all keys of the comma separated paths, path by path, the keys sorted by name.
+//
+// A path may select a version (secret/data/app#2) and limit the injected keys to a
+// semicolon separated list (secret/data/app#2#key1;key2, or secret/data/app##key1;key2 for the latest version).
+//
+// With the merge: prefix (merge:secret/data/common,secret/data/app) the paths are merged into one key set
+// before injection, every key is injected once, with the value of the last path containing it.
+func (i *SecretInjector) InjectSecretsFromBaoPath(paths string, inject SecretInjectorFunc) error {
+	return i.InjectSecretsFromBaoPathWithContext(context.Background(), paths, inject)
+}
+
+// InjectSecretsFromBaoPathWithContext works like InjectSecretsFromBaoPath, but the reads are cancelled once ctx is done.
+func (i *SecretInjector) InjectSecretsFromBaoPathWithContext(ctx context.Context, paths string, inject SecretInjectorFunc) error {
+	baoPaths := strings.Split(paths, ",")
+	if strings.HasPrefix(paths, mergePrefix) {
+		baoPaths = []string{paths}
+	}
+
+	// the keys injected under each variable name, to detect the keys sanitized to the same name
+	originals := map[string]string{}
+
+	for _, path := range baoPaths {
+		path, err := i.renderPathTemplate(path)
+		if err != nil {
+			return err
+		}
+
+		valuePath, version, keys := parsePathReference(path)
+
+		read, err := i.readBaoPath(ctx, valuePath, version, false)
+		if err != nil {
+			return err
+		}
+
+		data, err := i.checkEmptySecret(valuePath, read.data)
+		if err != nil {
+			return err
+		}
+
+		if data == nil {
+			if !i.config.IgnoreMissingSecrets {
+				return errors.Errorf("path not found: %s", valuePath)
+			}
+			i.logMissing(fmt.Sprintf("path not found %s", valuePath))
+
+			placeholder := i.config.MissingValuePlaceholder
+			if placeholder == nil || len(keys) == 0 {
+				continue
+			}
+
+			// the placeholders go through the same name policy and size checks as the values
+			data = make(map[string]interface{}, len(keys))
+			for _, key := range keys {
+				data[key] = *placeholder
+			}
+		} else if keys != nil {
+			filtered := make(map[string]interface{}, len(keys))
+			for _, key := range keys {
+				value, ok := data[key]
+				if !ok {
+					if !i.config.IgnoreMissingSecrets {
+						return errors.Errorf("key '%s' not found under path: %s", key, valuePath)
+					}
+					i.logMissing(fmt.Sprintf("key '%s' not found under path: %s", key, valuePath))
+
+					if placeholder := i.config.MissingValuePlaceholder; placeholder != nil {
+						filtered[key] = *placeholder
+					}
+
+					continue
+				}
+				filtered[key] = value
+			}
+			data = filtered
+		}
+
+		for _, key := range sortedKeys(data) {
+			value, err := toSecretString(data[key])
+			if err != nil {
+				return errors.WithMessagef(err, "key '%s' under path: %s", key, valuePath)
+			}
+
+			name, ok, err := i.envName(key)
+			if err != nil {
+				return errors.WithMessagef(err, "path: %s", valuePath)
+			}
+
+			if !ok {
+				continue
+			}
+
+			if err := checkEnvNameCollision(originals, name, key); err != nil {
+				return errors.WithMessagef(err, "path: %s", valuePath)
+			}
+
+			transformed, err := i.transformKVValue(value)
+			if err != nil {
+				return errors.WithMessagef(err, "key '%s' under path: %s", key, valuePath)
+			}
+
+			ok, err = i.checkValueSize(name, len(transformed))
+			if err != nil {
+				return errors.WithMessagef(err, "path: %s", valuePath)
+			}
+
+			if ok {
+				i.recordVersion(name, valuePath, read.version)
+				inject(name, transformed.Reveal())
+			}
+		}
+	}
+
+	return nil
+}
+
+var validEnvName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+var invalidEnvNameChars = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// envName applies the EnvNamePolicy to a variable name, ok is false if the variable has to be skipped.
+func (i *SecretInjector) envName(name string) (string, bool, error) {
+	if i.config.EnvNamePolicy == "" || validEnvName.MatchString(name) {
+		return name, true, nil
+	}
+
+	switch i.config.EnvNamePolicy {
+	case EnvNameError:
+		return "", false, errors.Errorf("invalid environment variable name: %s", name)
+	case EnvNameSkip:
+		i.logger.Warn("skipping invalid environment variable name", slog.String("variable", name))
+
+		return "", false, nil
+	case EnvNameSanitize:
+		sanitized := invalidEnvNameChars.ReplaceAllString(name, "_")
+		if sanitized == "" || (sanitized[0] >= '0' && sanitized[0] <= '9') {
+			sanitized = "_" + sanitized
+		}
+
+		return sanitized, true, nil
+	default:
+		return "", false, errors.Errorf("unknown environment variable name policy: %s", i.config.EnvNamePolicy)
+	}
+}
+
+// checkEnvNameCollision records that original is injected as name, and fails if a different name
+// was already injected as name (e.g. DB.HOST and DB_HOST with EnvNameSanitize).
+func checkEnvNameCollision(originals map[string]string, name, original string) error {
+	if previous, ok := originals[name]; ok && previous != original {
+		if previous > original {
+			previous, original = original, previous
+		}
+
+		return errors.Errorf("environment variable names collide: %s and %s are both injected as %s", previous, original, name)
+	}
+	originals[name] = original
+
+	return nil
+}
+
+// renderPathTemplate substitutes the PathVars into the {{.name}} placeholders of a reference.
+func (i *SecretInjector) renderPathTemplate(reference string) (string, error) {
+	if !strings.Contains(reference, "{{") {
+		return reference, nil
+	}
+
+	pathTemplate, err := parsePathTemplate(reference)
+	if err != nil {
+		return "", err
+	}
+
+	rendered := strings.Builder{}
+	if err := pathTemplate.Execute(&rendered, i.config.PathVars); err != nil {
+		return "", errors.Wrapf(err, "failed to render path template: %s", reference)
+	}
+
+	return rendered.String(), nil
+}
+
+// parsePathTemplate parses the {{.name}} placeholders of a reference.
+func parsePathTemplate(reference string) (*template.Template, error) {
+	pathTemplate, err := template.New("path").Option("missingkey=error").Parse(reference)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse path template: %s", reference)
+	}
+
+	return pathTemplate, nil
+}
+
+// secretReference is the path part of a reference (after bao: or >>bao:) split into its parts.
+type secretReference struct {
+	namespace    string
+	hasNamespace bool
+	// path may be a merge: list of paths
+	path          string
+	key           string
+	versionOrData string
+	transforms    []string
+	typeHint      string
+}
+
+// parseReference splits the path part of a reference (e.g. ns=team-a:secret/data/app#port:int|trimspace#2),
+// with the path template already rendered. It's the grammar of both the injection and ValidateReference.
+func (i *SecretInjector) parseReference(reference string, update bool) (secretReference, error) {
+	var ref secretReference
+	ref.namespace, reference, ref.hasNamespace = parseNamespace(reference)
+
+	var err error
+	ref.path, ref.key, ref.versionOrData, err = parseSecretReference(reference, update)
+	if err != nil {
+		return secretReference{}, err
+	}
+
+	ref.key, ref.transforms = i.parseTransforms(ref.key)
+	ref.key, ref.typeHint = parseTypeHint(ref.key)
+
+	return ref, nil
+}
+
+// parseNamespace splits the namespace off a reference with one (e.g. ns=team-a:secret/data/app#key).
+func parseNamespace(reference string) (namespace, path string, ok bool) {
+	rest, ok := strings.CutPrefix(reference, namespacePrefix)
+	if !ok {
+		return "", reference, false
+	}
+
+	namespace, path, ok = strings.Cut(rest, ":")
+	if !ok {
+		return "", reference, false
+	}
+
+	return namespace, path, true
+}
+
+// namespacedPath returns the path prefixed with the namespace of the read if it has one,
+// so the reads of the same path in different namespaces are cached separately.
+func namespacedPath(ctx context.Context, path string) string {
+	if namespace, ok := ctx.Value(namespaceKey{}).(string); ok {
+		return namespacePrefix + namespace + ":" + path
+	}
+
+	return path
+}
+
+// parseSecretReference splits a path#key#version (or path#key#data for writes) reference.
+// A # in the key can be escaped with a backslash (e.g. secret/data/app#app\#1).
+func parseSecretReference(reference string, update bool) (path, key, versionOrData string, err error) {
+	split := splitReference(reference, 3)
+	path = split[0]
+
+	if len(split) < 2 {
+		return "", "", "", errors.New("secret data key or template not defined")
+	}
+
+	key = split[1]
+
+	versionOrData = "-1"
+	if update {
+		versionOrData = "{}"
+	}
+	if len(split) == 3 {
+		versionOrData = split[2]
+	}
+
+	return path, key, versionOrData, nil
+}
+
+// secretCacheKey returns the cache key of a read or a write of path. Writes are keyed by the digest of
+// their (compacted) data, so only the writes of the same payload within an injection share a result, and never a read's.
+func secretCacheKey(ctx context.Context, path, versionOrData string, update bool) string {
+	key := namespacedPath(ctx, path) + "#"
+	if !update {
+		return key + versionOrData
+	}
+
+	var data bytes.Buffer
+	if err := json.Compact(&data, []byte(versionOrData)); err != nil {
+		data.Reset()
+		data.WriteString(versionOrData)
+	}
+	sum := sha256.Sum256(data.Bytes())
+
+	return key + "write:" + hex.EncodeToString(sum[:])
+}
+
+// ValidateReference checks the syntax of a reference (e.g. bao:secret/data/app#password#2)
+// without connecting to Bao, so it can be used for linting offline. It's parsed like during the injection,
+// the {{.name}} placeholders of the path are only checked for their syntax, since the PathVars aren't known,
+// and only the built-in transforms are recognized in the pipelines.
+func ValidateReference(value string) error {
+	if HasInlineBaoDelimiters(value) {
+		for _, baoSecretReference := range FindInlineBaoDelimiters(value) {
+			if err := ValidateReference(baoSecretReference[1]); err != nil {
+				return errors.WithMessagef(err, "inline reference %s", baoSecretReference[0])
+			}
+		}
+
+		return nil
+	}
+
+	if strings.Contains(value, "${bao:") || strings.Contains(value, "${>>bao:") {
+		return errors.Errorf("unbalanced inline reference delimiters: %s", value)
+	}
+
+	update := strings.HasPrefix(value, ">>bao:")
+	if !IsValidPrefix(value) {
+		return errors.Errorf("reference must start with bao: or >>bao: %s", value)
+	}
+
+	value = strings.TrimPrefix(value, ">>")
+	valuePath := strings.TrimPrefix(value, "bao:")
+
+	if valuePath == loginReference || new(bao.Transit).IsEncrypted(value) {
+		return nil
+	}
+
+	if strings.Contains(valuePath, "{{") {
+		if _, err := parsePathTemplate(valuePath); err != nil {
+			return errors.WithMessagef(err, "reference %s", value)
+		}
+	}
+
+	ref, err := new(SecretInjector).parseReference(valuePath, update)
+	if err != nil {
+		return errors.WithMessagef(err, "reference %s", value)
+	}
+
+	if ref.hasNamespace && ref.namespace == "" {
+		return errors.Errorf("namespace is empty in reference: %s", value)
+	}
+
+	if ref.path == "" {
+		return errors.Errorf("secret path is empty in reference: %s", value)
+	}
+
+	if paths, ok := strings.CutPrefix(ref.path, mergePrefix); ok {
+		if update {
+			return errors.Errorf("merged paths can't be written in reference: %s", value)
+		}
+
+		for _, path := range strings.Split(paths, ",") {
+			if path == "" {
+				return errors.Errorf("merged path is empty in reference: %s", value)
+			}
+		}
+	}
+
+	if ref.key == "" {
+		return errors.Errorf("secret data key is empty in reference: %s", value)
+	}
+
+	templater := templater.NewTemplater(templater.DefaultLeftDelimiter, templater.DefaultRightDelimiter)
+	if templater.IsGoTemplate(ref.key) {
+		if err := templater.Validate(ref.key); err != nil {
+			return errors.WithMessagef(err, "invalid template key '%s' in reference %s", ref.key, value)
+		}
+	} else if isFieldSelector(ref.key) {
+		if _, err := parseFieldSelector(ref.key); err != nil {
+			return errors.WithMessagef(err, "reference %s", value)
+		}
+	}
+
+	if update {
+		if !json.Valid([]byte(ref.versionOrData)) {
+			return errors.Errorf("invalid JSON data '%s' in reference: %s", ref.versionOrData, value)
+		}
+
+		return nil
+	}
+
+	version := strings.TrimPrefix(ref.versionOrData, "~")
+	if n, err := strconv.Atoi(version); err != nil || (version != ref.versionOrData && n < 0) {
+		return errors.Errorf("invalid version '%s' in reference: %s", ref.versionOrData, value)
+	}
+
+	return nil
+}
+
+// typeHints are the types a value can be required to parse as, with a :type suffix on the key (e.g. #port:int).
+var typeHints = map[string]func(value string) error{
+	"int": func(value string) error {
+		_, err := strconv.ParseInt(value, 10, 64)
+
+		return err
+	},
+	"bool": func(value string) error {
+		_, err := strconv.ParseBool(value)
+
+		return err
+	},
+	"float": func(value string) error {
+		_, err := strconv.ParseFloat(value, 64)
+
+		return err
+	},
+	"duration": func(value string) error {
+		_, err := time.ParseDuration(value)
+
+		return err
+	},
+}
+
+// valueTransforms are the built-in transforms of the pipelines on keys (e.g. #certificate|base64decode|trimspace).
+var valueTransforms = map[string]func([]byte) ([]byte, error){
+	"base64decode": func(value []byte) ([]byte, error) {
+		return base64.StdEncoding.DecodeString(string(value))
+	},
+	"base64encode": func(value []byte) ([]byte, error) {
+		return []byte(base64.StdEncoding.EncodeToString(value)), nil
+	},
+	"urldecode": func(value []byte) ([]byte, error) {
+		decoded, err := url.QueryUnescape(string(value))
+
+		return []byte(decoded), err
+	},
+	"trimspace": func(value []byte) ([]byte, error) {
+		return bytes.TrimSpace(value), nil
+	},
+}
+
+// valueTransform returns the transform of the pipelines with the given name.
+func (i *SecretInjector) valueTransform(name string) (func([]byte) ([]byte, error), bool) {
+	if transform, ok := i.config.ValueTransforms[name]; ok {
+		return transform, true
+	}
+
+	transform, ok := valueTransforms[name]
+
+	return transform, ok
+}
+
+// parseTransforms splits the |transform suffixes off a key, in the order they have to be applied.
+// Only known transform names are split off, so a | in a key or in a template (${.a | upper}) stays in place,
+// a key ending with |name can be escaped with a backslash (#key\|trimspace).
+func (i *SecretInjector) parseTransforms(key string) (string, []string) {
+	var names []string
+
+	for {
+		index := strings.LastIndex(key, "|")
+		if index < 0 || (index > 0 && key[index-1] == '\\') {
+			break
+		}
+
+		name := key[index+1:]
+		if _, ok := i.valueTransform(name); !ok {
+			break
+		}
+
+		names = append([]string{name}, names...)
+		key = key[:index]
+	}
+
+	return strings.ReplaceAll(key, "\\|", "|"), names
+}
+
+// applyTransforms runs the value through the transforms, the error doesn't contain the value.
+func (i *SecretInjector) applyTransforms(value SecretString, names []string) (SecretString, error) {
+	transformed := []byte(value.Reveal())
+
+	for _, name := range names {
+		transform, _ := i.valueTransform(name)
+
+		var err error
+		if transformed, err = transform(transformed); err != nil {
+			return "", errors.Errorf("transform %s failed", name)
+		}
+	}
+
+	return SecretString(transformed), nil
+}
+
+var fieldSelectorStepRegex = regexp.MustCompile(`^([^.\[\]]*)((?:\[\d+\])*)$`)
+
+var fieldSelectorIndexRegex = regexp.MustCompile(`\[(\d+)\]`)
+
+// fieldSelectorStep is a step of a field selector, a field followed by list indexes (e.g. .hosts[0]).
+// The field is empty for the indexes right after the $.
+type fieldSelectorStep struct {
+	field   string
+	indexes []int
+}
+
+// isFieldSelector reports if a key is a field selector ($.a.b[0]) instead of a plain key.
+func isFieldSelector(key string) bool {
+	return key == "$" || strings.HasPrefix(key, "$.") || strings.HasPrefix(key, "$[")
+}
+
+// parseFieldSelector splits a field selector into its steps.
+func parseFieldSelector(key string) ([]fieldSelectorStep, error) {
+	selector := strings.TrimPrefix(key, "$")
+	if strings.HasPrefix(selector, "[") {
+		selector = "." + selector
+	}
+
+	var steps []fieldSelectorStep
+	for _, step := range strings.Split(selector, ".")[1:] {
+		match := fieldSelectorStepRegex.FindStringSubmatch(step)
+		if match == nil || (match[1] == "" && match[2] == "") {
+			return nil, errors.Errorf("invalid field selector: %s", key)
+		}
+
+		parsed := fieldSelectorStep{field: match[1]}
+		for _, index := range fieldSelectorIndexRegex.FindAllStringSubmatch(match[2], -1) {
+			n, _ := strconv.Atoi(index[1])
+			parsed.indexes = append(parsed.indexes, n)
+		}
+		steps = append(steps, parsed)
+	}
+
+	return steps, nil
+}
+
+// lookupKey returns the value of a plain key, or of a field selector ($.a.b[0]) in the secret data.
+func lookupKey(data map[string]interface{}, key string) (interface{}, bool, error) {
+	if !isFieldSelector(key) {
+		value, ok := data[key]
+
+		return value, ok, nil
+	}
+
+	steps, err := parseFieldSelector(key)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var value interface{} = data
+
+	for _, step := range steps {
+		if step.field != "" {
+			fields, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, false, nil
+			}
+
+			if value, ok = fields[step.field]; !ok {
+				return nil, false, nil
+			}
+		}
+
+		for _, n := range step.indexes {
+			items, ok := value.([]interface{})
+			if !ok {
+				return nil, false, nil
+			}
+
+			if n >= len(items) {
+				return nil, false, nil
+			}
+
+			value = items[n]
+		}
+	}
+
+	return value, true, nil
+}
+
+// parseTypeHint splits the :type suffix off a key, if the suffix is a supported type and its : isn't escaped
+// with a backslash (#timeout\:duration is the timeout:duration key), and unescapes the \: sequences in the key.
+func parseTypeHint(key string) (string, string) {
+	typeHint := ""
+	if index := strings.LastIndex(key, ":"); index >= 0 && (index == 0 || key[index-1] != '\\') {
+		if _, ok := typeHints[key[index+1:]]; ok {
+			key, typeHint = key[:index], key[index+1:]
+		}
+	}
+
+	return strings.ReplaceAll(key, "\\:", ":"), typeHint
+}
+
+// validateTypeHint checks if the value parses as the hinted type, the error doesn't contain the value.
+func validateTypeHint(value SecretString, typeHint string) error {
+	if typeHint == "" {
+		return nil
+	}
+
+	if err := typeHints[typeHint](value.Reveal()); err != nil {
+		return errors.Errorf("value is not a valid %s", typeHint)
+	}
+
+	return nil
+}
+
+// splitReference splits a reference into at most n parts at the # characters
+// which aren't escaped with a backslash, and unescapes the \# sequences in the parts.
+func splitReference(reference string, n int) []string {
+	parts := []string{}
+	part := strings.Builder{}
+
+	for pos := 0; pos < len(reference); pos++ {
+		switch {
+		case reference[pos] == '\\' && pos+1 < len(reference) && reference[pos+1] == '#':
+			part.WriteByte('#')
+			pos++
+		case reference[pos] == '#' && len(parts) < n-1:
+			parts = append(parts, part.String())
+			part.Reset()
+		default:
+			part.WriteByte(reference[pos])
+		}
+	}
+
+	return append(parts, part.String())
+}
+
+// parsePathReference splits a path#version#key1;key2 reference, keys is nil if all keys are requested.
+func parsePathReference(reference string) (path, version string, keys []string) {
+	split := splitReference(reference, 3)
+	path = split[0]
+
+	version = "-1"
+	if len(split) > 1 && split[1] != "" {
+		version = split[1]
+	}
+
+	if len(split) == 3 {
+		keys = strings.Split(split[2], ";")
+	}
+
+	return path, version, keys
+}
+
+type baoPathResult struct {
+	data  map[string]interface{}
+	lease *SecretLease
+	// version is the KV version 2 version of the data, 0 for other engines
+	version int
+}
+
+// readBaoPathOnce shares the result of a read between the concurrent callers of the same path and version,
+// writes are never shared.
+func (i *SecretInjector) readBaoPathOnce(ctx context.Context, path, versionOrData string, update bool) (baoPathResult, error) {
+	if update {
+		return i.readBaoPath(ctx, path, versionOrData, update)
+	}
+
+	// the shared read isn't cancelled with the context of the caller which started it, since the others
+	// are waiting for it as well, it's bounded by the timeouts instead. Each caller stops waiting
+	// once its own context is done.
+	results := i.reads.DoChan(namespacedPath(ctx, path)+"#"+versionOrData, func() (interface{}, error) {
+		sharedCtx := context.WithoutCancel(ctx)
+		if timeout := i.sharedReadTimeout(path); timeout > 0 {
+			var cancel context.CancelFunc
+			sharedCtx, cancel = context.WithTimeout(sharedCtx, timeout)
+			defer cancel()
+		}
+
+		return i.readBaoPath(sharedCtx, path, versionOrData, false)
+	})
+
+	var result singleflight.Result
+	select {
+	case <-ctx.Done():
+		return baoPathResult{}, ctx.Err()
+	case result = <-results:
+	}
+
+	if result.Err != nil {
+		return baoPathResult{}, result.Err
+	}
+
+	return result.Val.(baoPathResult), nil
+}
+
+// sharedReadTimeout bounds a shared read, which isn't cancelled by its callers: the timeout of a request
+// (Config.PathTimeouts or the client timeout) for the first read and for each MissingSecretRetry attempt,
+// plus the retry intervals. 0 means unbounded, if there is no timeout.
+func (i *SecretInjector) sharedReadTimeout(path string) time.Duration {
+	timeout := i.pathTimeout(path)
+	if timeout == 0 {
+		timeout = i.client.RawClient().ClientTimeout()
+	}
+	if timeout <= 0 {
+		return 0
+	}
+
+	retry := i.config.MissingSecretRetry
+
+	return time.Duration(retry.Attempts+1)*timeout + time.Duration(retry.Attempts)*retry.Interval
+}
+
+func (i *SecretInjector) readBaoPath(ctx context.Context, path, versionOrData string, update bool) (baoPathResult, error) {
+	if paths, ok := strings.CutPrefix(path, mergePrefix); ok {
+		if update {
+			return baoPathResult{}, errors.Errorf("merged paths can't be written: %s", path)
+		}
+
+		data, err := i.readMergedPaths(ctx, strings.Split(paths, ","), versionOrData)
+
+		return baoPathResult{data: data}, err
+	}
+
+	var secretData map[string]interface{}
+
+	var secret *baoapi.Secret
+	var err error
+
+	if update {
+		var data map[string]interface{}
+		err = json.Unmarshal([]byte(versionOrData), &data)
+		if err != nil {
+			return baoPathResult{}, errors.Wrap(err, "failed to unmarshal data for writing")
+		}
+
+		if i.config.WriteCAS {
+			secret, err = i.writeWithCAS(ctx, path, data)
+		} else {
+			secret, err = i.write(ctx, path, data)
+		}
+		if err != nil {
+			return baoPathResult{}, errors.Wrapf(err, "failed to write secret to path: %s", path)
 		}
 	} else {
-		secret, err = i.client.RawClient().Logical().ReadWithData(path, map[string][]string{"version": {versionOrData}})
+		if strings.HasPrefix(versionOrData, "~") {
+			versionOrData, err = i.resolveRelativeVersion(ctx, path, versionOrData)
+			if err != nil {
+				return baoPathResult{}, err
+			}
+		}
+
+		secret, err = i.readWithRetry(ctx, path, map[string][]string{"version": {versionOrData}})
 		if err != nil {
-			return nil, errors.Wrapf(err, "failed to read secret from path: %s", path)
+			return baoPathResult{}, errors.Wrapf(err, "failed to read secret from path: %s", path)
 		}
 	}
 
 	if i.config.DaemonMode && secret != nil && secret.LeaseDuration > 0 {
 		i.logger.Info("secret has a lease duration, starting renewal", slog.String("path", path), slog.Int("lease-duration", secret.LeaseDuration))
 
-		err = i.renewer.Renew(path, secret)
+		err = i.renewSecret(ctx, path, secret)
 		if err != nil {
-			return nil, errors.Wrap(err, "secret renewal can't be established")
+			return baoPathResult{}, errors.Wrap(err, "secret renewal can't be established")
 		}
 	}
 
 	if secret == nil {
-		return nil, nil
+		return baoPathResult{}, nil
 	}
 
-	for _, warning := range secret.Warnings {
-		i.logger.Warn(warning, slog.String("path", path))
+	if err := i.handleWarnings(path, secret.Warnings); err != nil {
+		return baoPathResult{}, err
 	}
 
+	var version int
+
 	v2Data, ok := secret.Data["data"]
 	if ok {
 		secretData = cast.ToStringMap(v2Data)
 
-		// Handle the case where "metadata" key is not present or is nil.
+		// Handle the case where "metadata" key is not present or is nil,
+		// some KV version 2 compatible implementations don't return it, then the version is unknown.
 		metadataRaw, ok := secret.Data["metadata"]
 		if metadataRaw == nil || !ok {
-			return nil, errors.New("metadata key not found or is nil in secret")
+			if i.config.StrictKVMetadata {
+				return baoPathResult{}, errors.New("metadata key not found or is nil in secret")
+			}
+
+			i.logger.Debug("metadata not found in secret, version is unknown", slog.String("path", path))
+			metadataRaw = map[string]interface{}{}
 		}
 
 		// Handle the case where the type assertion fails.
 		metadata, ok := metadataRaw.(map[string]interface{})
 		if !ok {
-			return nil, errors.New("metadata has an unexpected type")
+			return baoPathResult{}, errors.New("metadata has an unexpected type")
 		}
 
+		version = cast.ToInt(metadata["version"])
+
 		// Check if a given version of a path is destroyed
 		// Handle the case where "destroyed" key is not present or has an unexpected type.
 		destroyed, _ := metadata["destroyed"].(bool)
@@ -446,13 +1845,375 @@ func (i *SecretInjector) readBaoPath(path, versionOrData string, update bool) (m
 		secretData = cast.ToStringMap(secret.Data)
 	}
 
-	return secretData, nil
+	var lease *SecretLease
+	if secret.LeaseDuration > 0 {
+		duration := time.Duration(secret.LeaseDuration) * time.Second
+		lease = &SecretLease{
+			ID:        secret.LeaseID,
+			Duration:  duration,
+			ExpiresAt: time.Now().Add(duration),
+			Renewable: secret.Renewable,
+		}
+	}
+
+	return baoPathResult{data: secretData, lease: lease, version: version}, nil
+}
+
+// handleWarnings passes the warnings of a response to Config.WarningHandler, or logs them if it isn't set.
+func (i *SecretInjector) handleWarnings(path string, warnings []string) error {
+	if len(warnings) == 0 {
+		return nil
+	}
+
+	if i.config.WarningHandler == nil {
+		for _, warning := range warnings {
+			i.logger.Warn(warning, slog.String("path", path))
+		}
+
+		return nil
+	}
+
+	if err := i.config.WarningHandler(path, warnings); err != nil {
+		return errors.WithMessagef(err, "warnings of path: %s", path)
+	}
+
+	return nil
+}
+
+// pathTimeout returns the timeout of the longest prefix of path in Config.PathTimeouts, 0 if there is none.
+func (i *SecretInjector) pathTimeout(path string) time.Duration {
+	var timeout time.Duration
+	longest := -1
+
+	for prefix, prefixTimeout := range i.config.PathTimeouts {
+		if strings.HasPrefix(path, prefix) && len(prefix) > longest {
+			timeout = prefixTimeout
+			longest = len(prefix)
+		}
+	}
+
+	return timeout
+}
+
+// readMergedPaths reads the paths and merges their data, the later paths override the keys of the earlier ones.
+// The result is nil if none of the paths exist.
+func (i *SecretInjector) readMergedPaths(ctx context.Context, paths []string, version string) (map[string]interface{}, error) {
+	var merged map[string]interface{}
+
+	for _, path := range paths {
+		read, err := i.readBaoPath(ctx, path, version, false)
+		if err != nil {
+			return nil, err
+		}
+		data := read.data
+
+		if data == nil {
+			if !i.config.IgnoreMissingSecrets {
+				return nil, errors.Errorf("path not found: %s", path)
+			}
+			i.logMissing(fmt.Sprintf("path not found %s", path))
+
+			continue
+		}
+
+		if merged == nil {
+			merged = make(map[string]interface{}, len(data))
+		}
+
+		for key, value := range data {
+			merged[key] = value
+		}
+	}
+
+	return merged, nil
+}
+
+// readWithData reads from Bao, respecting the request and response size limits of the client.
+func (i *SecretInjector) readWithData(ctx context.Context, path string, data map[string][]string) (*baoapi.Secret, error) {
+	rawClient, err := i.rawClientFor(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	release, err := i.client.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	// unlike the parsed reads, the raw reads don't apply the timeout of the client
+	if timeout := rawClient.ClientTimeout(); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	resp, err := rawClient.Logical().ReadRawWithDataWithContext(ctx, path, data)
+	if limitErr := i.client.LimitResponseSize(resp); limitErr != nil {
+		return nil, errors.WithMessagef(limitErr, "path: %s", path)
+	}
+
+	if i.config.ServingNodeHeader == "" {
+		return rawClient.Logical().ParseRawResponseAndCloseBody(resp, err)
+	}
+
+	node := ""
+	if resp != nil {
+		node = resp.Header.Get(i.config.ServingNodeHeader)
+	}
+
+	secret, err := rawClient.Logical().ParseRawResponseAndCloseBody(resp, err)
+	if err != nil {
+		i.logger.Debug("secret read failed", slog.String("path", path), slog.String("bao-node", node))
+	} else {
+		i.logger.Debug("secret read", slog.String("path", path), slog.String("bao-node", node))
+	}
+
+	return secret, err
+}
+
+// rawClientFor returns the raw client for the requests to path, which is a copy with the timeout
+// of Config.PathTimeouts if the path has one, and with the namespace of the reference if it has one.
+// The shared client is never modified, so concurrent reads in other namespaces aren't affected.
+func (i *SecretInjector) rawClientFor(ctx context.Context, path string) (*baoapi.Client, error) {
+	rawClient := i.client.RawClient()
+
+	namespace, hasNamespace := ctx.Value(namespaceKey{}).(string)
+	timeout := i.pathTimeout(path)
+	if timeout == 0 && !hasNamespace {
+		return rawClient, nil
+	}
+
+	clone, err := rawClient.CloneWithHeaders()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to clone Bao client")
+	}
+
+	clone.SetToken(rawClient.Token())
+	if timeout != 0 {
+		clone.SetClientTimeout(timeout)
+	}
+	if hasNamespace {
+		clone.SetNamespace(namespace)
+	}
+
+	return clone, nil
+}
+
+// readWithRetry reads from Bao, retrying the read of a missing path as configured by Config.MissingSecretRetry.
+func (i *SecretInjector) readWithRetry(ctx context.Context, path string, data map[string][]string) (*baoapi.Secret, error) {
+	retry := i.config.MissingSecretRetry
+
+	for attempt := 1; ; attempt++ {
+		secret, err := i.readWithData(ctx, path, data)
+		if err != nil || secret != nil || attempt > retry.Attempts {
+			return secret, err
+		}
+
+		i.logger.Debug("path not found, retrying", slog.String("path", path), slog.Int("attempt", attempt))
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(retry.Interval):
+		}
+	}
+}
+
+// write writes to Bao, respecting the request limit of the client.
+func (i *SecretInjector) write(ctx context.Context, path string, data map[string]interface{}) (*baoapi.Secret, error) {
+	rawClient, err := i.rawClientFor(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	release, err := i.client.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	return rawClient.Logical().WriteWithContext(ctx, path, data)
+}
+
+// resolveRelativeVersion resolves a version relative to the latest one (e.g. ~1) to a concrete version number.
+func (i *SecretInjector) resolveRelativeVersion(ctx context.Context, path, version string) (string, error) {
+	offset, err := strconv.Atoi(strings.TrimPrefix(version, "~"))
+	if err != nil || offset < 0 {
+		return "", errors.Errorf("invalid relative version '%s' for path: %s", version, path)
+	}
+
+	currentVersion, err := i.currentKVVersion(ctx, path)
+	if err != nil {
+		return "", err
+	}
+
+	if currentVersion == 0 {
+		return "", errors.Errorf("path not found: %s", path)
+	}
+
+	resolved := currentVersion - offset
+	if resolved < 1 {
+		return "", errors.Errorf("relative version '%s' is before the first version of path: %s", version, path)
+	}
+
+	return strconv.Itoa(resolved), nil
+}
+
+// currentKVVersion returns the latest version of a KV version 2 path, or 0 if the path doesn't exist.
+func (i *SecretInjector) currentKVVersion(ctx context.Context, path string) (int, error) {
+	metadataPath, err := kvMetadataPath(path)
+	if err != nil {
+		return 0, err
+	}
+
+	metadata, err := i.readWithData(ctx, metadataPath, nil)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to read secret metadata from path: %s", metadataPath)
+	}
+
+	if metadata == nil {
+		return 0, nil
+	}
+
+	currentVersion, err := cast.ToIntE(metadata.Data["current_version"])
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to parse current version of path: %s", path)
+	}
+
+	return currentVersion, nil
+}
+
+// writeWithCAS writes a KV version 2 secret with check-and-set against its current version,
+// retrying with the new version if the secret has been changed in the meantime.
+func (i *SecretInjector) writeWithCAS(ctx context.Context, path string, data map[string]interface{}) (*baoapi.Secret, error) {
+	for attempt := 1; ; attempt++ {
+		version, err := i.currentKVVersion(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+
+		secret, err := i.write(ctx, path, bao.NewData(version, data))
+		if err == nil {
+			return secret, nil
+		}
+
+		if !strings.Contains(err.Error(), "check-and-set parameter did not match") {
+			return nil, err
+		}
+
+		if attempt > i.config.WriteCASRetries {
+			return nil, errors.Errorf("check-and-set failed after %d attempt(s), the secret keeps being changed concurrently", attempt)
+		}
+
+		i.logger.Warn("check-and-set version mismatch, retrying write", slog.String("path", path), slog.Int("version", version))
+	}
+}
+
+// kvMetadataPath returns the metadata path of a KV version 2 data path (e.g. secret/data/app -> secret/metadata/app).
+func kvMetadataPath(path string) (string, error) {
+	mount, secretPath, found := strings.Cut(path, "/data/")
+	if !found {
+		return "", errors.Errorf("not a KV version 2 data path: %s", path)
+	}
+
+	return mount + "/metadata/" + secretPath, nil
+}
+
+// renewSecret starts the renewal of the lease of a secret, unless it's already renewed
+// (e.g. because multiple references read it concurrently). The secret is read in the namespace of ctx,
+// the cached reads of the path in that namespace are dropped once the renewal stops.
+func (i *SecretInjector) renewSecret(ctx context.Context, path string, secret *baoapi.Secret) error {
+	leaseID := secret.LeaseID
+	if leaseID == "" {
+		leaseID = namespacedPath(ctx, path)
+	}
+
+	i.mu.Lock()
+	if i.renewals[leaseID] {
+		i.mu.Unlock()
+		i.logger.Debug("lease is already renewed, skipping renewal", slog.String("path", path))
+
+		return nil
+	}
+	i.renewals[leaseID] = true
+	i.mu.Unlock()
+
+	stopped := func() {
+		i.mu.Lock()
+		delete(i.renewals, leaseID)
+		i.mu.Unlock()
+	}
+
+	renewer, ok := i.renewer.(SecretRenewerWithDone)
+	if !ok {
+		// without a done channel the renewal is considered active forever
+		err := i.renewer.Renew(path, secret)
+		if err != nil {
+			stopped()
+		}
+
+		return err
+	}
+
+	done, err := renewer.RenewWithDone(path, secret)
+	if err != nil {
+		stopped()
+
+		return err
+	}
+
+	go func() {
+		err := <-done
+		i.logger.Warn("secret renewal stopped, dropping cached secret", slog.String("path", path), slog.Any("err", err))
+
+		stopped()
+		i.invalidateSecretCache(ctx, path)
+	}()
+
+	return nil
+}
+
+// invalidateSecretCache drops all cached versions of a path in the namespace of ctx,
+// and the merged reads containing it. The keys are matched as secretCacheKey builds them.
+func (i *SecretInjector) invalidateSecretCache(ctx context.Context, path string) {
+	pathKey := secretCacheKey(ctx, path, "", false)
+	mergedKey := strings.TrimSuffix(secretCacheKey(ctx, mergePrefix, "", false), "#")
+
+	i.uncacheSecrets(func(key string) bool {
+		if strings.HasPrefix(key, pathKey) {
+			return true
+		}
+
+		paths, ok := strings.CutPrefix(key, mergedKey)
+		if !ok {
+			return false
+		}
+		paths, _, _ = strings.Cut(paths, "#")
+
+		return slices.Contains(strings.Split(paths, ","), path)
+	})
 }
 
 func IsValidPrefix(value string) bool {
 	return strings.HasPrefix(value, "bao:") || strings.HasPrefix(value, ">>bao:")
 }
 
+// hasWriteReference reports if a value is a write (>>bao:) reference, or contains an inline one.
+func hasWriteReference(value string) bool {
+	if strings.HasPrefix(value, ">>bao:") {
+		return true
+	}
+
+	for _, reference := range FindInlineBaoDelimiters(value) {
+		if strings.HasPrefix(reference[1], ">>bao:") {
+			return true
+		}
+	}
+
+	return false
+}
+
 func HasInlineBaoDelimiters(value string) bool {
 	return len(FindInlineBaoDelimiters(value)) > 0
 }
@@ -462,11 +2223,199 @@ func FindInlineBaoDelimiters(value string) [][]string {
 }
 
 func (i *SecretInjector) GetDataFromBao(data map[string]string) (map[string]string, error) {
+	return i.getDataFromBao(context.Background(), data)
+}
+
+func (i *SecretInjector) getDataFromBao(ctx context.Context, data map[string]string) (map[string]string, error) {
 	baoData := make(map[string]string, len(data))
 
 	inject := func(key, value string) {
 		baoData[key] = value
 	}
 
-	return baoData, i.InjectSecretsFromBao(data, inject)
+	return baoData, i.injectSecrets(ctx, data, func(key, value string, _ *SecretLease) {
+		inject(key, value)
+	})
+}
+
+// Prefetch resolves the references without injecting them anywhere, so the secret and transit
+// caches are warm for the following injections. The write (>>bao:) references are skipped,
+// since their results aren't cached, they would only be executed twice.
+func (i *SecretInjector) Prefetch(ctx context.Context, references map[string]string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// the references are copied, since preprocessing removes the already decrypted ones
+	prefetched := make(map[string]string, len(references))
+	for name, value := range references {
+		if hasWriteReference(value) {
+			i.logger.Debug("skipping write reference in prefetch", slog.String("variable", name))
+
+			continue
+		}
+
+		prefetched[name] = value
+	}
+
+	return i.injectSecrets(ctx, prefetched, func(_, _ string, _ *SecretLease) {})
+}
+
+// Reload reads the references tracked in DaemonMode again, bypassing the secret cache,
+// and injects the values which changed since their last injection with the callbacks
+// they were originally injected with.
+// All references are resolved before anything is injected, so if any of them fails
+// nothing is injected and the previously injected (and cached) values stay in place.
+// Note that write (>>bao:) references are executed again as well.
+// Config.OnSecretChange is called for the paths whose data changed afterwards.
+func (i *SecretInjector) Reload() error {
+	return i.ReloadWithContext(context.Background())
+}
+
+// ReloadWithContext works like Reload, but the reads are cancelled once ctx is done.
+// The callbacks are called without holding any lock of the injector, so they may call it (e.g. Reload) as well.
+func (i *SecretInjector) ReloadWithContext(ctx context.Context) error {
+	injections, changes, err := i.reload(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, injection := range injections {
+		injection.inject(injection.name, injection.value.Reveal(), injection.lease)
+	}
+
+	if i.config.OnSecretChange == nil {
+		return nil
+	}
+
+	for _, key := range sortedKeys(changes) {
+		change := changes[key]
+		path, _, _ := strings.Cut(key, "#")
+
+		i.config.OnSecretChange(path, change.old, change.new)
+	}
+
+	return nil
+}
+
+// secretChange is the data of a cached path#version key before and after a reload.
+type secretChange struct {
+	old, new map[string]interface{}
+}
+
+// reloadedInjection is a changed value of a reload, to be injected once the lock of the reload is released.
+type reloadedInjection struct {
+	name   string
+	value  SecretString
+	lease  *SecretLease
+	inject SecretLeaseInjectorFunc
+}
+
+func (i *SecretInjector) reload(ctx context.Context) ([]reloadedInjection, map[string]secretChange, error) {
+	i.reloadMu.Lock()
+	defer i.reloadMu.Unlock()
+
+	if len(i.tracked) == 0 {
+		return nil, nil, nil
+	}
+
+	references := make(map[string]string, len(i.tracked))
+	for name, reference := range i.tracked {
+		references[name] = reference.value
+	}
+
+	var previous map[string]map[string]interface{}
+	if i.config.OnSecretChange != nil {
+		previous = i.cachedSecrets()
+	}
+
+	type reloadedValue struct {
+		value SecretString
+		lease *SecretLease
+	}
+
+	// the cached secrets are replaced by the reads, and are kept if the reload fails
+	reloaded := make(map[string]reloadedValue, len(references))
+	err := i.injectSecrets(context.WithValue(ctx, bypassCacheKey{}, true), references, func(key, value string, lease *SecretLease) {
+		reloaded[key] = reloadedValue{value: SecretString(value), lease: lease}
+	})
+	if err != nil {
+		return nil, nil, errors.WithMessage(err, "failed to reload secrets")
+	}
+
+	var injections []reloadedInjection
+	for _, name := range sortedKeys(reloaded) {
+		value := reloaded[name]
+		reference := i.tracked[name]
+
+		valueFingerprint := fingerprint(value.value.Reveal())
+		if valueFingerprint == reference.fingerprint {
+			i.logger.Debug("secret unchanged, skipping injection", slog.String("variable", name))
+
+			continue
+		}
+
+		reference.fingerprint = valueFingerprint
+		i.tracked[name] = reference
+
+		injections = append(injections, reloadedInjection{name: name, value: value.value, lease: value.lease, inject: reference.inject})
+	}
+
+	changes := map[string]secretChange{}
+	for key, data := range i.cachedSecrets() {
+		if old, ok := previous[key]; ok && !reflect.DeepEqual(old, data) {
+			changes[key] = secretChange{old: old, new: data}
+		}
+	}
+
+	return injections, changes, nil
+}
+
+// ReloadOnSignal calls Reload whenever the process receives one of the signals (e.g. syscall.SIGHUP),
+// until the context is done. Failed reloads are logged.
+func (i *SecretInjector) ReloadOnSignal(ctx context.Context, signals ...os.Signal) {
+	signalCh := make(chan os.Signal, 1)
+	signal.Notify(signalCh, signals...)
+	defer signal.Stop(signalCh)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-signalCh:
+			i.logger.Info("reloading secrets", slog.String("signal", sig.String()))
+
+			if err := i.ReloadWithContext(ctx); err != nil {
+				i.logger.Error(fmt.Sprintf("failed to reload secrets: %s", err))
+			}
+		}
+	}
+}
+
+// RenderEnvFile resolves the references and writes them to w in .env file format, sorted by name.
+// Values are double quoted with backslashes, quotes, dollar signs and newlines escaped.
+func (i *SecretInjector) RenderEnvFile(ctx context.Context, references map[string]string, w io.Writer) error {
+	return i.render(ctx, references, w, OutputFormatEnv)
+}
+
+// sortedKeys returns the keys of a map in order, so the injection order is the same on every run.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// fingerprint hashes an injected value, so its changes can be detected without keeping the value around.
+func fingerprint(value string) string {
+	sum := sha256.Sum256([]byte(value))
+
+	return hex.EncodeToString(sum[:])
+}
+
+func quoteEnvFileValue(value string) string {
+	return `"` + envFileValueReplacer.Replace(value) + `"`
 }
@@ -0,0 +1,99 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bao
+
+import (
+	"context"
+	"os"
+
+	"emperror.dev/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// LoadReferences loads the references from a manifest file, which maps the variable names to references
+// (or plain values) in YAML or JSON format, e.g.:
+//
+//	DB_PASSWORD: bao:secret/data/db#password
+//	DB_HOST: db.internal
+//
+// The references are validated with ValidateReference, the errors mention the line of the invalid entry.
+func LoadReferences(path string) (map[string]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read references file")
+	}
+
+	references, err := parseReferences(content)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "references file %s", path)
+	}
+
+	return references, nil
+}
+
+func parseReferences(content []byte) (map[string]string, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return nil, errors.Wrap(err, "failed to parse references")
+	}
+
+	references := map[string]string{}
+
+	// an empty file has no content node
+	if len(document.Content) == 0 {
+		return references, nil
+	}
+
+	root := document.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, errors.Errorf("line %d: references must be a mapping of variable names to references", root.Line)
+	}
+
+	for k := 0; k < len(root.Content); k += 2 {
+		name, value := root.Content[k], root.Content[k+1]
+
+		if name.Kind != yaml.ScalarNode || name.Value == "" {
+			return nil, errors.Errorf("line %d: variable name must be a non-empty string", name.Line)
+		}
+
+		if _, ok := references[name.Value]; ok {
+			return nil, errors.Errorf("line %d: duplicate variable name %s", name.Line, name.Value)
+		}
+
+		if value.Kind != yaml.ScalarNode {
+			return nil, errors.Errorf("line %d: reference of %s must be a string", value.Line, name.Value)
+		}
+
+		if IsValidPrefix(value.Value) || HasInlineBaoDelimiters(value.Value) {
+			if err := ValidateReference(value.Value); err != nil {
+				return nil, errors.WithMessagef(err, "line %d", value.Line)
+			}
+		}
+
+		references[name.Value] = value.Value
+	}
+
+	return references, nil
+}
+
+// InjectFromFile loads the references from a manifest file with LoadReferences, and injects them.
+func (i *SecretInjector) InjectFromFile(ctx context.Context, path string, inject SecretInjectorFunc) error {
+	references, err := LoadReferences(path)
+	if err != nil {
+		return err
+	}
+
+	return i.InjectSecretsFromBaoWithContext(ctx, references, inject)
+}
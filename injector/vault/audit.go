@@ -0,0 +1,107 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"emperror.dev/errors"
+)
+
+// AuditManifest is the record of an injection written to Config.AuditManifestPath,
+// it lists what was injected without the values.
+type AuditManifest struct {
+	// InjectedAt is the time the injection finished.
+	InjectedAt time.Time `json:"injectedAt"`
+	// Entries are the injected variables sorted by name.
+	Entries []AuditManifestEntry `json:"entries"`
+}
+
+// AuditManifestEntry is an injected variable of an AuditManifest.
+type AuditManifestEntry struct {
+	Name string `json:"name"`
+	// Reference is the reference the variable was injected from (e.g. vault:secret/data/app#password).
+	Reference string `json:"reference"`
+	// Path and Version are the path the variable was read from and its KV version 2 version,
+	// they are empty for transit encrypted values and the other references which aren't read from a path.
+	Path    string `json:"path,omitempty"`
+	Version int    `json:"version,omitempty"`
+	// SHA256 is the hex encoded SHA-256 hash of the injected value.
+	SHA256 string `json:"sha256"`
+}
+
+// auditInjections records the hashes of the injected values of references for the audit manifest.
+type auditInjections struct {
+	references map[string]string
+	hashes     map[string]string
+}
+
+func (a *auditInjections) recording(inject SecretLeaseInjectorFunc) SecretLeaseInjectorFunc {
+	return func(key, value string, lease *SecretLease) {
+		a.hashes[key] = fingerprint(value)
+
+		inject(key, value, lease)
+	}
+}
+
+// writeAuditManifest writes the manifest of the recorded injections to Config.AuditManifestPath.
+// The file is replaced atomically, so readers never see a partial manifest.
+func (i *SecretInjector) writeAuditManifest(injections *auditInjections) error {
+	i.mu.RLock()
+	manifest := AuditManifest{InjectedAt: time.Now().UTC(), Entries: make([]AuditManifestEntry, 0, len(injections.hashes))}
+	for _, name := range sortedKeys(injections.hashes) {
+		source := i.versions[name]
+		manifest.Entries = append(manifest.Entries, AuditManifestEntry{
+			Name:      name,
+			Reference: injections.references[name],
+			Path:      source.Path,
+			Version:   source.Version,
+			SHA256:    injections.hashes[name],
+		})
+	}
+	i.mu.RUnlock()
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal audit manifest")
+	}
+
+	path := i.config.AuditManifestPath
+
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return errors.Wrap(err, "failed to create audit manifest")
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		_ = file.Close()
+
+		return errors.Wrap(err, "failed to write audit manifest")
+	}
+
+	if err := file.Close(); err != nil {
+		return errors.Wrap(err, "failed to write audit manifest")
+	}
+
+	if err := os.Rename(file.Name(), path); err != nil {
+		return errors.Wrap(err, "failed to write audit manifest")
+	}
+
+	return nil
+}
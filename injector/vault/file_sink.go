@@ -0,0 +1,142 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"emperror.dev/errors"
+)
+
+// FileConflictPolicy decides what happens if a FileSink is asked to write the same file twice.
+type FileConflictPolicy string
+
+const (
+	// FileConflictError fails the second write, this is the default
+	FileConflictError FileConflictPolicy = "error"
+	// FileConflictLastWins overwrites the file with the last written value
+	FileConflictLastWins FileConflictPolicy = "last-wins"
+)
+
+// FileOwner is the owner user and group IDs of the files written by a FileSink.
+type FileOwner struct {
+	UID int
+	GID int
+}
+
+type FileSinkConfig struct {
+	// Mode is the permission of the written files, it defaults to 0o600.
+	Mode os.FileMode
+	// Owner changes the owner of the written files if set, which usually requires root privileges.
+	Owner *FileOwner
+	// ConflictPolicy decides what happens if the same file is written twice, it defaults to FileConflictError.
+	ConflictPolicy FileConflictPolicy
+}
+
+// FileSink writes every injected secret into a file named after the variable in a directory.
+// It's safe for concurrent use, the writes are serialized, and every file is replaced atomically
+// (written to a temporary file in the same directory, then renamed), so readers never see a partial value.
+//
+// Its Write method can be passed to InjectSecretsFromVaultE:
+//
+//	sink := NewFileSink("/vault/secrets", FileSinkConfig{})
+//	err := injector.InjectSecretsFromVaultE(references, sink.Write)
+type FileSink struct {
+	dir    string
+	config FileSinkConfig
+
+	mu      sync.Mutex
+	written map[string]bool
+}
+
+// NewFileSink creates a FileSink writing into dir, which has to exist.
+func NewFileSink(dir string, config FileSinkConfig) *FileSink {
+	if config.Mode == 0 {
+		config.Mode = 0o600
+	}
+
+	if config.ConflictPolicy == "" {
+		config.ConflictPolicy = FileConflictError
+	}
+
+	return &FileSink{
+		dir:     dir,
+		config:  config,
+		written: map[string]bool{},
+	}
+}
+
+// Write writes the value into the file called name.
+func (s *FileSink) Write(name, value string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return errors.Errorf("invalid file name: %s", name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.written[name] && s.config.ConflictPolicy != FileConflictLastWins {
+		return errors.Errorf("file already written: %s", name)
+	}
+
+	if err := s.writeFile(name, value); err != nil {
+		return errors.WithMessagef(err, "failed to write file: %s", name)
+	}
+
+	s.written[name] = true
+
+	return nil
+}
+
+func (s *FileSink) writeFile(name, value string) (err error) {
+	file, err := os.CreateTemp(s.dir, "."+name+".*.tmp")
+	if err != nil {
+		return errors.Wrap(err, "failed to create temporary file")
+	}
+
+	defer func() {
+		if err != nil {
+			_ = file.Close()
+			_ = os.Remove(file.Name())
+		}
+	}()
+
+	if err := file.Chmod(s.config.Mode); err != nil {
+		return errors.Wrap(err, "failed to set file mode")
+	}
+
+	if owner := s.config.Owner; owner != nil {
+		if err := file.Chown(owner.UID, owner.GID); err != nil {
+			return errors.Wrap(err, "failed to set file owner")
+		}
+	}
+
+	if _, err := file.WriteString(value); err != nil {
+		return errors.Wrap(err, "failed to write temporary file")
+	}
+
+	if err := file.Sync(); err != nil {
+		return errors.Wrap(err, "failed to sync temporary file")
+	}
+
+	if err := file.Close(); err != nil {
+		return errors.Wrap(err, "failed to close temporary file")
+	}
+
+	return errors.Wrap(os.Rename(file.Name(), filepath.Join(s.dir, name)), "failed to rename temporary file")
+}
@@ -15,14 +15,27 @@
 package vault
 
 import (
+	"context"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"io"
 	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"reflect"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"emperror.dev/errors"
 	vaultapi "github.com/hashicorp/vault/api"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -305,6 +318,437 @@ func TestSecretInjectorFromPath(t *testing.T) {
 	})
 }
 
+type doneRenewer struct {
+	done chan error
+}
+
+func (r doneRenewer) Renew(_ string, _ *vaultapi.Secret) error {
+	return nil
+}
+
+func (r doneRenewer) RenewWithDone(_ string, _ *vaultapi.Secret) (<-chan error, error) {
+	return r.done, nil
+}
+
+func TestSecretCacheInvalidatedOnRenewalStop(t *testing.T) {
+	t.Parallel()
+
+	renewer := doneRenewer{done: make(chan error)}
+	injector := NewSecretInjector(Config{DaemonMode: true}, nil, renewer, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	ctx := context.Background()
+	teamA := context.WithValue(ctx, namespaceKey{}, "team-a")
+	teamB := context.WithValue(ctx, namespaceKey{}, "team-b")
+
+	keys := map[string]string{
+		"app":          secretCacheKey(ctx, "database/creds/app", "-1", false),
+		"other":        secretCacheKey(ctx, "database/creds/other", "-1", false),
+		"merged":       secretCacheKey(ctx, "merge:secret/data/common,database/creds/app", "-1", false),
+		"mergedOther":  secretCacheKey(ctx, "merge:secret/data/common,database/creds/other", "-1", false),
+		"teamA":        secretCacheKey(teamA, "database/creds/app", "-1", false),
+		"teamAMerged":  secretCacheKey(teamA, "merge:secret/data/common,database/creds/app", "-1", false),
+		"teamB":        secretCacheKey(teamB, "database/creds/app", "-1", false),
+		"teamBMerged":  secretCacheKey(teamB, "merge:secret/data/common,database/creds/app", "-1", false),
+		"prefixedPath": secretCacheKey(ctx, "database/creds/app2", "-1", false),
+	}
+	for _, key := range keys {
+		require.NoError(t, injector.cacheSecret(key, map[string]interface{}{"password": "secret"}, nil))
+	}
+
+	cached := func() []string {
+		var names []string
+		for name, key := range keys {
+			if data, _ := injector.cachedSecret(key); data != nil {
+				names = append(names, name)
+			}
+		}
+		slices.Sort(names)
+
+		return names
+	}
+
+	err := injector.renewSecret(ctx, "database/creds/app", &vaultapi.Secret{LeaseDuration: 60})
+	require.NoError(t, err)
+
+	renewer.done <- errors.New("lease revoked")
+
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{"mergedOther", "other", "prefixedPath", "teamA", "teamAMerged", "teamB", "teamBMerged"}, cached())
+	}, time.Second, 10*time.Millisecond)
+
+	// the secrets of a namespace are only dropped in that namespace
+	err = injector.renewSecret(teamA, "database/creds/app", &vaultapi.Secret{LeaseDuration: 60})
+	require.NoError(t, err)
+
+	renewer.done <- errors.New("lease revoked")
+
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{"mergedOther", "other", "prefixedPath", "teamB", "teamBMerged"}, cached())
+	}, time.Second, 10*time.Millisecond)
+}
+
+type countingRenewer struct {
+	doneRenewer
+	renewals *atomic.Int32
+}
+
+func (r countingRenewer) RenewWithDone(path string, secret *vaultapi.Secret) (<-chan error, error) {
+	r.renewals.Add(1)
+
+	return r.doneRenewer.RenewWithDone(path, secret)
+}
+
+func TestLeaseRenewalDeduplicated(t *testing.T) {
+	t.Parallel()
+
+	renewer := countingRenewer{doneRenewer: doneRenewer{done: make(chan error)}, renewals: &atomic.Int32{}}
+	injector := NewSecretInjector(Config{DaemonMode: true}, nil, renewer, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	secret := &vaultapi.Secret{LeaseID: "database/creds/app/1", LeaseDuration: 60}
+	require.NoError(t, injector.renewSecret(context.Background(), "database/creds/app", secret))
+	require.NoError(t, injector.renewSecret(context.Background(), "database/creds/app", secret))
+	assert.Equal(t, int32(1), renewer.renewals.Load())
+
+	// the lease is renewed again once its renewal stopped
+	renewer.done <- errors.New("lease revoked")
+
+	assert.Eventually(t, func() bool {
+		require.NoError(t, injector.renewSecret(context.Background(), "database/creds/app", secret))
+
+		return renewer.renewals.Load() == 2
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, injector.renewSecret(context.Background(), "database/creds/app", &vaultapi.Secret{LeaseID: "database/creds/app/2", LeaseDuration: 60}))
+	assert.Equal(t, int32(3), renewer.renewals.Load())
+
+	// without a lease ID, the same path is renewed separately in each namespace
+	teamA := context.WithValue(context.Background(), namespaceKey{}, "team-a")
+	teamB := context.WithValue(context.Background(), namespaceKey{}, "team-b")
+	require.NoError(t, injector.renewSecret(teamA, "database/creds/app", &vaultapi.Secret{LeaseDuration: 60}))
+	require.NoError(t, injector.renewSecret(teamB, "database/creds/app", &vaultapi.Secret{LeaseDuration: 60}))
+	require.NoError(t, injector.renewSecret(teamB, "database/creds/app", &vaultapi.Secret{LeaseDuration: 60}))
+	assert.Equal(t, int32(5), renewer.renewals.Load())
+}
+
+func TestSharedCache(t *testing.T) {
+	t.Parallel()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cache := NewMemoryCache()
+
+	first := NewSecretInjector(Config{Cache: cache}, nil, nil, logger)
+	second := NewSecretInjector(Config{Cache: cache}, nil, nil, logger)
+
+	lease := &SecretLease{ID: "database/creds/app/1", Duration: time.Minute, Renewable: true}
+	require.NoError(t, first.cacheSecret("database/creds/app#-1", map[string]interface{}{"port": json.Number("5432")}, lease))
+
+	data, cachedLease := second.cachedSecret("database/creds/app#-1")
+	assert.Equal(t, map[string]interface{}{"port": json.Number("5432")}, data)
+	assert.Equal(t, lease.ID, cachedLease.ID)
+	assert.Equal(t, lease.Duration, cachedLease.Duration)
+
+	first.cacheTransitSecret("vault:v1:ciphertext", []byte("plaintext"))
+
+	plaintext, ok := second.cachedTransitSecret("vault:v1:ciphertext")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("plaintext"), plaintext)
+}
+
+func TestKVMetadataPath(t *testing.T) {
+	t.Parallel()
+
+	path, err := kvMetadataPath("secret/data/app/database")
+	require.NoError(t, err)
+	assert.Equal(t, "secret/metadata/app/database", path)
+
+	path, err = kvMetadataPath("team/kv/data/app")
+	require.NoError(t, err)
+	assert.Equal(t, "team/kv/metadata/app", path)
+
+	_, err = kvMetadataPath("database/creds/app")
+	assert.EqualError(t, err, "not a KV version 2 data path: database/creds/app")
+}
+
+func TestValidateReference(t *testing.T) {
+	t.Parallel()
+
+	valid := []string{
+		"vault:secret/data/account#password",
+		"vault:secret/data/account#password#1",
+		"vault:secret/data/account#password#~1",
+		"vault:secret/data/account#${.password | urlquery}",
+		">>vault:pki/root/generate/internal#certificate",
+		`>>vault:transit/decrypt/mykey#${.plaintext | b64dec}#{"ciphertext":"vault:v1:aGVsbG8="}`,
+		"vault:login",
+		"vault:ns=team-a:secret/data/account#password",
+		"vault:ns=team-a:secret/data/account#certificate|base64decode|trimspace#2",
+		"vault:secret/data/account#port:int|trimspace",
+		"vault:secret/data/db#$.hosts[0].address",
+		"vault:merge:secret/data/common,secret/data/account#password",
+		"vault:{{.mount}}/data/account#password",
+		"scheme://${vault:secret/data/account#username}:${vault:secret/data/account#password}@127.0.0.1:8080",
+	}
+
+	for _, reference := range valid {
+		assert.NoError(t, ValidateReference(reference), reference)
+	}
+
+	invalid := map[string]string{
+		"secret/data/account#password":                  "reference must start with vault: or >>vault: secret/data/account#password",
+		"vault:secret/data/account":                     "reference vault:secret/data/account: secret data key or template not defined",
+		"vault:#password":                               "secret path is empty in reference: vault:#password",
+		"vault:secret/data/account#password#latest":     "invalid version 'latest' in reference: vault:secret/data/account#password#latest",
+		"vault:secret/data/account#password#~-1":        "invalid version '~-1' in reference: vault:secret/data/account#password#~-1",
+		">>vault:pki/issue/role#certificate#{invalid}":  "invalid JSON data '{invalid}' in reference: vault:pki/issue/role#certificate#{invalid}",
+		"vault:ns=:secret/data/account#password":        "namespace is empty in reference: vault:ns=:secret/data/account#password",
+		"scheme://${vault:secret/data/account#username": "unbalanced inline reference delimiters: scheme://${vault:secret/data/account#username",
+		"vault:secret/data/db#$.hosts[x]":               "reference vault:secret/data/db#$.hosts[x]: invalid field selector: $.hosts[x]",
+		"vault:secret/data/account#|trimspace":          "secret data key is empty in reference: vault:secret/data/account#|trimspace",
+		"vault:merge:secret/data/common,#password":      "merged path is empty in reference: vault:merge:secret/data/common,#password",
+		">>vault:merge:pki/issue/a,pki/issue/b#key":     "merged paths can't be written in reference: vault:merge:pki/issue/a,pki/issue/b#key",
+	}
+
+	for reference, message := range invalid {
+		assert.EqualError(t, ValidateReference(reference), message, reference)
+	}
+
+	assert.ErrorContains(t, ValidateReference("vault:{{.mount/data/account#password"), "failed to parse path template")
+}
+
+func TestParseSecretReference(t *testing.T) {
+	t.Parallel()
+
+	path, key, version, err := parseSecretReference(`secret/data/app#app\#1#2`, false)
+	require.NoError(t, err)
+	assert.Equal(t, "secret/data/app", path)
+	assert.Equal(t, "app#1", key)
+	assert.Equal(t, "2", version)
+
+	path, key, data, err := parseSecretReference(`pki/issue/role#certificate#{"common_name":"a#b"}`, true)
+	require.NoError(t, err)
+	assert.Equal(t, "pki/issue/role", path)
+	assert.Equal(t, "certificate", key)
+	assert.Equal(t, `{"common_name":"a#b"}`, data)
+}
+
+func TestParsePathReference(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		reference string
+		path      string
+		version   string
+		keys      []string
+	}{
+		{reference: "secret/data/app", path: "secret/data/app", version: "-1"},
+		{reference: "secret/data/app#2", path: "secret/data/app", version: "2"},
+		{reference: "secret/data/app#2#key1;key2", path: "secret/data/app", version: "2", keys: []string{"key1", "key2"}},
+		{reference: "secret/data/app##key1", path: "secret/data/app", version: "-1", keys: []string{"key1"}},
+	}
+
+	for _, tt := range tests {
+		path, version, keys := parsePathReference(tt.reference)
+		assert.Equal(t, tt.path, path, tt.reference)
+		assert.Equal(t, tt.version, version, tt.reference)
+		assert.Equal(t, tt.keys, keys, tt.reference)
+	}
+}
+
+func TestAggregateErrors(t *testing.T) {
+	t.Parallel()
+
+	rawClient, err := vaultapi.NewClient(vaultapi.DefaultConfig())
+	require.NoError(t, err)
+
+	client, err := vault.NewClientFromRawClient(rawClient, vault.ClientToken("token"))
+	require.NoError(t, err)
+
+	injector := NewSecretInjector(Config{AggregateErrors: true}, client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	references := map[string]string{
+		"FIRST":  "vault:secret/data/first",
+		"SECOND": "vault:secret/data/second",
+		"PLAIN":  "plain",
+	}
+
+	results := map[string]string{}
+	err = injector.InjectSecretsFromVault(references, func(key, value string) {
+		results[key] = value
+	})
+
+	require.Error(t, err)
+	assert.Len(t, errors.GetErrors(err), 2)
+	assert.ErrorContains(t, err, "variable FIRST: secret data key or template not defined")
+	assert.ErrorContains(t, err, "variable SECOND: secret data key or template not defined")
+	assert.Equal(t, map[string]string{"PLAIN": "plain"}, results)
+}
+
+// newTestClient creates a client for a fake Vault server serving the requests with handler.
+func newTestClient(t *testing.T, handler http.HandlerFunc, opts ...vault.ClientOption) *vault.Client {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	config := vaultapi.DefaultConfig()
+	config.Address = server.URL
+
+	rawClient, err := vaultapi.NewClient(config)
+	require.NoError(t, err)
+
+	client, err := vault.NewClientFromRawClient(rawClient, append([]vault.ClientOption{vault.ClientToken("token")}, opts...)...)
+	require.NoError(t, err)
+
+	return client
+}
+
+func TestReload(t *testing.T) {
+	t.Parallel()
+
+	var password atomic.Value
+	password.Store("first")
+
+	client := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprintf(w, `{"data": {"data": {"password": %q}, "metadata": {"version": 1}}}`, password.Load())
+	})
+
+	injector := NewSecretInjector(Config{DaemonMode: true}, client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	results := map[string]string{}
+	err := injector.InjectSecretsFromVault(map[string]string{
+		"PASSWORD": "vault:secret/data/app#password",
+		"PLAIN":    "plain",
+	}, func(key, value string) {
+		results[key] = value
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"PASSWORD": "first", "PLAIN": "plain"}, results)
+
+	password.Store("second")
+
+	results = map[string]string{}
+	require.NoError(t, injector.Reload())
+	assert.Equal(t, map[string]string{"PASSWORD": "second"}, results, "only changed values are injected again")
+
+	results = map[string]string{}
+	require.NoError(t, injector.Reload())
+	assert.Empty(t, results)
+}
+
+func TestReloadFailureAndCallbacks(t *testing.T) {
+	t.Parallel()
+
+	var password atomic.Value
+	password.Store("first")
+	var failing atomic.Bool
+
+	client := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		if failing.Load() {
+			http.Error(w, `{"errors": ["internal error"]}`, http.StatusInternalServerError)
+
+			return
+		}
+		fmt.Fprintf(w, `{"data": {"data": {"password": %q}, "metadata": {"version": 1}}}`, password.Load())
+	})
+	client.RawClient().SetMaxRetries(0)
+
+	injector := NewSecretInjector(Config{DaemonMode: true}, client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	var injected []string
+	reentered := false
+	err := injector.InjectSecretsFromVault(map[string]string{"PASSWORD": "vault:secret/data/app#password"}, func(_, value string) {
+		injected = append(injected, value)
+
+		// the callbacks may call the injector, no lock of it is held
+		if value == "second" && !reentered {
+			reentered = true
+			assert.NoError(t, injector.Reload())
+		}
+	})
+	require.NoError(t, err)
+
+	// a failed reload keeps the cached secret
+	failing.Store(true)
+	require.Error(t, injector.Reload())
+
+	cached, _ := injector.cachedSecret("secret/data/app#-1")
+	assert.Equal(t, map[string]interface{}{"password": "first"}, cached)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, injector.ReloadWithContext(ctx), context.Canceled)
+
+	failing.Store(false)
+	password.Store("second")
+	require.NoError(t, injector.Reload())
+
+	assert.Equal(t, []string{"first", "second"}, injected)
+	assert.True(t, reentered)
+}
+
+func TestMissingValuePlaceholder(t *testing.T) {
+	t.Parallel()
+
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/secret/data/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors": []}`)
+
+			return
+		}
+
+		fmt.Fprint(w, `{"data": {"data": {"password": "secret"}, "metadata": {"version": 1}}}`)
+	})
+
+	placeholder := "<missing>"
+	injector := NewSecretInjector(
+		Config{IgnoreMissingSecrets: true, MissingValuePlaceholder: &placeholder},
+		client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)),
+	)
+
+	results := map[string]string{}
+	inject := func(key, value string) {
+		results[key] = value
+	}
+
+	err := injector.InjectSecretsFromVault(map[string]string{
+		"PASSWORD":     "vault:secret/data/app#password",
+		"USERNAME":     "vault:secret/data/app#username",
+		"MISSING_PATH": "vault:secret/data/missing#password",
+	}, inject)
+	require.NoError(t, err)
+
+	err = injector.InjectSecretsFromVaultPath("secret/data/app##password;username,secret/data/missing##token", inject)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{
+		"PASSWORD":     "secret",
+		"USERNAME":     "<missing>",
+		"MISSING_PATH": "<missing>",
+		"password":     "secret",
+		"username":     "<missing>",
+		"token":        "<missing>",
+	}, results)
+
+	// the placeholders of a missing path are subject to the name policy and the size limit
+	injector = NewSecretInjector(
+		Config{
+			IgnoreMissingSecrets:    true,
+			MissingValuePlaceholder: &placeholder,
+			EnvNamePolicy:           EnvNameSanitize,
+			MaxValueSize:            4,
+		},
+		client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)),
+	)
+
+	results = map[string]string{}
+	err = injector.InjectSecretsFromVaultPath("secret/data/missing##db.host", inject)
+	require.Error(t, err)
+
+	var oversized *OversizedValueError
+	require.ErrorAs(t, err, &oversized)
+	assert.Equal(t, "db_host", oversized.Name)
+	assert.Empty(t, results)
+}
+
 func TestPaginate(t *testing.T) {
 	t.Parallel()
 
@@ -354,3 +798,1741 @@ func TestPaginate(t *testing.T) {
 		})
 	}
 }
+
+func TestQuoteEnvFileValue(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		"simple":           `"simple"`,
+		"with space":       `"with space"`,
+		`say "hi"`:         `"say \"hi\""`,
+		"line1\nline2":     `"line1\nline2"`,
+		`C:\path`:          `"C:\\path"`,
+		"$HOME and ${VAR}": `"\$HOME and \${VAR}"`,
+	}
+
+	for value, want := range tests {
+		assert.Equal(t, want, quoteEnvFileValue(value))
+	}
+}
+
+func TestSecretString(t *testing.T) {
+	t.Parallel()
+
+	secret := SecretString("password")
+
+	assert.Equal(t, "password", secret.Reveal())
+	for _, format := range []string{"%s", "%v", "%+v", "%#v", "%q", "%x", "%d"} {
+		assert.Equal(t, "[REDACTED]", fmt.Sprintf(format, secret), format)
+	}
+
+	logs := strings.Builder{}
+	slog.New(slog.NewTextHandler(&logs, nil)).Info("resolved", slog.Any("value", secret))
+	assert.NotContains(t, logs.String(), "password")
+
+	_, err := toSecretString([]string{"password"})
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "password")
+}
+
+func TestRenderPathTemplate(t *testing.T) {
+	t.Parallel()
+
+	injector := NewSecretInjector(Config{PathVars: map[string]string{"mount": "secret-prod"}}, nil, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	rendered, err := injector.renderPathTemplate("{{.mount}}/data/app#${.user}#2")
+	require.NoError(t, err)
+	assert.Equal(t, "secret-prod/data/app#${.user}#2", rendered)
+
+	rendered, err = injector.renderPathTemplate("secret/data/app#password")
+	require.NoError(t, err)
+	assert.Equal(t, "secret/data/app#password", rendered)
+
+	_, err = injector.renderPathTemplate("{{.env}}/data/app#password")
+	assert.ErrorContains(t, err, "failed to render path template")
+}
+
+func TestValidateTransitKeyNotFound(t *testing.T) {
+	t.Parallel()
+
+	client := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"errors": []}`)
+	})
+
+	injector := NewSecretInjector(Config{TransitKeyID: "app"}, client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	err := injector.Validate(context.Background())
+	assert.EqualError(t, err, "transit key 'app' not found at path 'transit'")
+}
+
+func TestTypeHints(t *testing.T) {
+	t.Parallel()
+
+	client := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `{"data": {"data": {"port": "5432", "debug": "yes", "timeout": "30s", "timeout:duration": "slow", "retry:int": "10s"}, "metadata": {"version": 1}}}`)
+	})
+
+	injector := NewSecretInjector(Config{}, client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	results := map[string]string{}
+	err := injector.InjectSecretsFromVault(map[string]string{
+		"PORT":    "vault:secret/data/app#port:int",
+		"TIMEOUT": "vault:secret/data/app#timeout:duration",
+	}, func(key, value string) {
+		results[key] = value
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "5432", results["PORT"])
+	assert.Equal(t, "30s", results["TIMEOUT"])
+
+	err = injector.InjectSecretsFromVault(map[string]string{
+		"DEBUG": "vault:secret/data/app#debug:bool",
+	}, func(key, value string) {
+		results[key] = value
+	})
+	assert.EqualError(t, err, "key 'debug' under path: secret/data/app: value is not a valid bool")
+
+	// the : of a key ending with a type name is escaped
+	results = map[string]string{}
+	err = injector.InjectSecretsFromVault(map[string]string{
+		"TIMEOUT_NAME": `vault:secret/data/app#timeout\:duration`,
+		"RETRY":        `vault:secret/data/app#retry\:int:duration`,
+	}, func(key, value string) {
+		results[key] = value
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"TIMEOUT_NAME": "slow", "RETRY": "10s"}, results)
+
+	err = injector.InjectSecretsFromVault(map[string]string{
+		"TIMEOUT_NAME": `vault:secret/data/app#timeout\:duration:duration`,
+	}, func(key, value string) {
+		results[key] = value
+	})
+	assert.EqualError(t, err, "key 'timeout:duration' under path: secret/data/app: value is not a valid duration")
+}
+
+func TestMergedPaths(t *testing.T) {
+	t.Parallel()
+
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/secret/data/common":
+			fmt.Fprint(w, `{"data": {"data": {"host": "db.internal", "user": "common"}, "metadata": {"version": 1}}}`)
+		case "/v1/secret/data/app":
+			fmt.Fprint(w, `{"data": {"data": {"user": "app", "password": "secret"}, "metadata": {"version": 1}}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors": []}`)
+		}
+	})
+
+	injector := NewSecretInjector(Config{}, client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	results := map[string]string{}
+	inject := func(key, value string) {
+		results[key] = value
+	}
+
+	err := injector.InjectSecretsFromVault(map[string]string{
+		"HOST": "vault:merge:secret/data/common,secret/data/app#host",
+		"USER": "vault:merge:secret/data/common,secret/data/app#user",
+	}, inject)
+	require.NoError(t, err)
+
+	err = injector.InjectSecretsFromVaultPath("merge:secret/data/common,secret/data/app", inject)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{
+		"HOST":     "db.internal",
+		"USER":     "app",
+		"host":     "db.internal",
+		"user":     "app",
+		"password": "secret",
+	}, results)
+
+	err = injector.InjectSecretsFromVaultPath("merge:secret/data/common,secret/data/missing", inject)
+	assert.EqualError(t, err, "path not found: secret/data/missing")
+}
+
+func TestMissingSecretLogLevel(t *testing.T) {
+	t.Parallel()
+
+	client := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"errors": []}`)
+	})
+
+	debug := slog.LevelDebug
+	none := LogLevelNone
+
+	tests := []struct {
+		name  string
+		level *slog.Level
+		logs  string
+	}{
+		{name: "default", level: nil, logs: "level=WARN"},
+		{name: "debug", level: &debug, logs: "level=DEBUG"},
+		{name: "none", level: &none, logs: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logs := strings.Builder{}
+			logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug - 1}))
+
+			injector := NewSecretInjector(Config{IgnoreMissingSecrets: true, MissingSecretLogLevel: test.level}, client, nil, logger)
+
+			err := injector.InjectSecretsFromVault(map[string]string{"OPTIONAL": "vault:secret/data/optional#key"}, func(_, _ string) {})
+			require.NoError(t, err)
+
+			if test.logs == "" {
+				assert.NotContains(t, logs.String(), "path not found")
+			} else {
+				assert.Contains(t, logs.String(), test.logs+` msg="path not found secret/data/optional"`)
+			}
+		})
+	}
+}
+
+func TestTransitBatchSize(t *testing.T) {
+	t.Parallel()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	secrets := []string{strings.Repeat("a", 100-transitBatchItemOverhead), strings.Repeat("a", 300-transitBatchItemOverhead)}
+
+	configured := NewSecretInjector(Config{TransitBatchSize: 25}, nil, nil, logger)
+	assert.Equal(t, 25, configured.transitBatchSize(secrets))
+
+	auto := NewSecretInjector(Config{TransitMaxRequestSize: 4000}, nil, nil, logger)
+	assert.Equal(t, 10, auto.transitBatchSize(secrets), "half of 4000 bytes for items of 200 bytes on average")
+
+	tiny := NewSecretInjector(Config{TransitBatchSize: -1, TransitMaxRequestSize: 100}, nil, nil, logger)
+	assert.Equal(t, 1, tiny.transitBatchSize(secrets))
+
+	defaults := NewSecretInjector(Config{}, nil, nil, logger)
+	assert.Equal(t, defaultTransitMaxRequestSize/2/200, defaults.transitBatchSize(secrets))
+}
+
+func TestEnvNamePolicy(t *testing.T) {
+	t.Parallel()
+
+	client := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `{"data": {"data": {"DB_HOST": "db.internal", "db.port": "5432", "1password": "secret"}, "metadata": {"version": 1}}}`)
+	})
+
+	tests := []struct {
+		policy  EnvNamePolicy
+		results map[string]string
+		err     string
+	}{
+		{
+			policy:  "",
+			results: map[string]string{"DB_HOST": "db.internal", "db.port": "5432", "1password": "secret"},
+		},
+		{
+			policy: EnvNameError,
+			err:    "invalid environment variable name",
+		},
+		{
+			policy:  EnvNameSkip,
+			results: map[string]string{"DB_HOST": "db.internal"},
+		},
+		{
+			policy:  EnvNameSanitize,
+			results: map[string]string{"DB_HOST": "db.internal", "db_port": "5432", "_1password": "secret"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.policy), func(t *testing.T) {
+			injector := NewSecretInjector(Config{EnvNamePolicy: test.policy}, client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+			results := map[string]string{}
+			err := injector.InjectSecretsFromVaultPath("secret/data/app", func(key, value string) {
+				results[key] = value
+			})
+
+			if test.err != "" {
+				assert.ErrorContains(t, err, test.err)
+
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.results, results)
+		})
+	}
+}
+
+func TestEnvNameSanitizeCollision(t *testing.T) {
+	t.Parallel()
+
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/secret/data/app":
+			fmt.Fprint(w, `{"data": {"data": {"DB.HOST": "db.internal", "DB_HOST": "db.other"}, "metadata": {"version": 1}}}`)
+		case "/v1/secret/data/digits":
+			fmt.Fprint(w, `{"data": {"data": {"1X": "one"}, "metadata": {"version": 1}}}`)
+		default:
+			fmt.Fprint(w, `{"data": {"data": {"_1X": "other", "DB_HOST": "db.internal"}, "metadata": {"version": 1}}}`)
+		}
+	})
+
+	injector := NewSecretInjector(Config{EnvNamePolicy: EnvNameSanitize}, client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	inject := func(string, string) {}
+
+	err := injector.InjectSecretsFromVaultPath("secret/data/app", inject)
+	assert.ErrorContains(t, err, "DB.HOST and DB_HOST are both injected as DB_HOST")
+
+	err = injector.InjectSecretsFromVaultPath("secret/data/digits,secret/data/other", inject)
+	assert.ErrorContains(t, err, "1X and _1X are both injected as _1X")
+
+	err = injector.InjectSecretsFromVault(map[string]string{
+		"DB.HOST": "vault:secret/data/other#DB_HOST",
+		"DB_HOST": "vault:secret/data/other#DB_HOST",
+	}, inject)
+	assert.ErrorContains(t, err, "DB.HOST and DB_HOST are both injected as DB_HOST")
+
+	// the same key of several paths isn't a collision, the later path overrides it
+	results := map[string]string{}
+	err = injector.InjectSecretsFromVaultPath("secret/data/other,secret/data/more", func(key, value string) {
+		results[key] = value
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"_1X": "other", "DB_HOST": "db.internal"}, results)
+}
+
+func TestConcurrentReadsDeduplicated(t *testing.T) {
+	t.Parallel()
+
+	var requests atomic.Int32
+	arrived := make(chan struct{})
+	release := make(chan struct{})
+
+	client := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		if requests.Add(1) == 1 {
+			close(arrived)
+		}
+		<-release
+		fmt.Fprint(w, `{"data": {"data": {"password": "secret"}, "metadata": {"version": 1}}}`)
+	})
+
+	injector := NewSecretInjector(Config{}, client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	const readers = 10
+
+	var wg sync.WaitGroup
+	errs := make(chan error, readers)
+	for range readers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			errs <- injector.InjectSecretsFromVault(map[string]string{"PASSWORD": "vault:secret/data/app#password"}, func(string, string) {})
+		}()
+	}
+
+	<-arrived
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(1), requests.Load())
+}
+
+func TestSlowReadDoesNotBlockOtherPaths(t *testing.T) {
+	t.Parallel()
+
+	arrived := make(chan struct{})
+	release := make(chan struct{})
+
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/slow") {
+			close(arrived)
+			<-release
+		}
+		fmt.Fprint(w, `{"data": {"data": {"password": "secret"}, "metadata": {"version": 1}}}`)
+	})
+
+	injector := NewSecretInjector(Config{}, client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	slow := make(chan error, 1)
+	go func() {
+		slow <- injector.InjectSecretsFromVault(map[string]string{"SLOW": "vault:secret/data/slow#password"}, func(string, string) {})
+	}()
+
+	<-arrived
+
+	fast := make(chan error, 1)
+	go func() {
+		fast <- injector.InjectSecretsFromVault(map[string]string{"FAST": "vault:secret/data/fast#password"}, func(string, string) {})
+	}()
+
+	select {
+	case err := <-fast:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("injection blocked by a slow read of another path")
+	}
+
+	close(release)
+	require.NoError(t, <-slow)
+}
+
+func TestMissingSecretRetry(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		status   int
+		failures int32
+		requests int32
+		err      string
+	}{
+		{name: "appears", status: http.StatusNotFound, failures: 2, requests: 3},
+		{name: "never appears", status: http.StatusNotFound, failures: 10, requests: 4, err: "path not found"},
+		{name: "permission denied", status: http.StatusForbidden, failures: 10, requests: 1, err: "failed to read secret"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			var requests atomic.Int32
+			client := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+				if requests.Add(1) <= test.failures {
+					w.WriteHeader(test.status)
+					fmt.Fprint(w, `{"errors": []}`)
+
+					return
+				}
+				fmt.Fprint(w, `{"data": {"data": {"password": "secret"}, "metadata": {"version": 1}}}`)
+			})
+
+			config := Config{MissingSecretRetry: MissingSecretRetry{Attempts: 3, Interval: time.Millisecond}}
+			injector := NewSecretInjector(config, client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+			results := map[string]string{}
+			err := injector.InjectSecretsFromVault(map[string]string{"PASSWORD": "vault:secret/data/app#password"}, func(key, value string) {
+				results[key] = value
+			})
+
+			if test.err != "" {
+				assert.ErrorContains(t, err, test.err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, map[string]string{"PASSWORD": "secret"}, results)
+			}
+			assert.Equal(t, test.requests, requests.Load())
+		})
+	}
+}
+
+func TestServingNodeLogged(t *testing.T) {
+	t.Parallel()
+
+	client := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("X-Vault-Node", "vault-1")
+		fmt.Fprint(w, `{"data": {"data": {"password": "secret"}, "metadata": {"version": 1}}}`)
+	})
+
+	logs := strings.Builder{}
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	injector := NewSecretInjector(Config{ServingNodeHeader: "X-Vault-Node"}, client, nil, logger)
+
+	err := injector.InjectSecretsFromVault(map[string]string{"PASSWORD": "vault:secret/data/app#password"}, func(string, string) {})
+	require.NoError(t, err)
+
+	assert.Contains(t, logs.String(), "vault-node=vault-1")
+}
+
+func TestTransitValueTransform(t *testing.T) {
+	t.Parallel()
+
+	client := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		plaintext := base64.StdEncoding.EncodeToString([]byte(base64.StdEncoding.EncodeToString([]byte("binary"))))
+		fmt.Fprintf(w, `{"data": {"batch_results": [{"plaintext": %q}]}}`, plaintext)
+	})
+
+	decode := func(value []byte) ([]byte, error) {
+		return base64.StdEncoding.DecodeString(string(value))
+	}
+
+	injector := NewSecretInjector(Config{TransitKeyID: "mykey", TransitValueTransform: decode}, client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	out, err := injector.FetchTransitSecrets([]string{"ciphertext"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"ciphertext": []byte("binary")}, out)
+
+	cached, ok := injector.cachedTransitSecret("ciphertext")
+	require.True(t, ok)
+	assert.Equal(t, []byte("binary"), cached)
+
+	failing := NewSecretInjector(Config{
+		TransitKeyID: "mykey",
+		TransitValueTransform: func([]byte) ([]byte, error) {
+			return nil, errors.New("not base64")
+		},
+	}, client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	_, err = failing.FetchTransitSecrets([]string{"ciphertext"})
+	assert.ErrorContains(t, err, "failed to transform decrypted transit value")
+}
+
+func TestInjectSecretsFromVaultE(t *testing.T) {
+	t.Parallel()
+
+	var requests atomic.Int32
+	client := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		fmt.Fprint(w, `{"data": {"data": {"user": "admin", "password": "secret"}, "metadata": {"version": 1}}}`)
+	})
+
+	injector := NewSecretInjector(Config{}, client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	references := map[string]string{
+		"USER":     "vault:secret/data/user#user",
+		"PASSWORD": "vault:secret/data/password#password",
+	}
+
+	calls := 0
+	err := injector.InjectSecretsFromVaultE(references, func(string, string) error {
+		calls++
+
+		return errors.New("disk full")
+	})
+
+	require.ErrorContains(t, err, "disk full")
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, int32(1), requests.Load())
+
+	results := map[string]string{}
+	err = injector.InjectSecretsFromVaultE(references, func(key, value string) error {
+		results[key] = value
+
+		return nil
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"USER": "admin", "PASSWORD": "secret"}, results)
+}
+
+func TestFieldSelector(t *testing.T) {
+	t.Parallel()
+
+	client := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `{"data": {"data": {"password": "plain", "connection": {"password": "nested", "port": 5432, "hosts": [{"address": "db-0"}, {"address": "db-1"}]}}, "metadata": {"version": 1}}}`)
+	})
+
+	injector := NewSecretInjector(Config{}, client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	tests := []struct {
+		key  string
+		want string
+		err  string
+	}{
+		{key: "password", want: "plain"},
+		{key: "$.password", want: "plain"},
+		{key: "$.connection.password", want: "nested"},
+		{key: "$.connection.port:int", want: "5432"},
+		{key: "$.connection.hosts[1].address", want: "db-1"},
+		{key: "$.connection.hosts[2].address", err: "not found"},
+		{key: "$.connection.user", err: "not found"},
+		{key: "$.connection..password", err: "invalid field selector"},
+		{key: "$.connection", err: "can't be cast to a string"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.key, func(t *testing.T) {
+			var value string
+			err := injector.InjectSecretsFromVault(map[string]string{"VALUE": "vault:secret/data/db#" + test.key}, func(_, v string) {
+				value = v
+			})
+
+			if test.err != "" {
+				assert.ErrorContains(t, err, test.err)
+
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.want, value)
+		})
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	sink := NewFileSink(dir, FileSinkConfig{Mode: 0o640})
+
+	var wg sync.WaitGroup
+	for n := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			assert.NoError(t, sink.Write(fmt.Sprintf("SECRET_%d", n), "value"))
+		}()
+	}
+	wg.Wait()
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 10, "no temporary files are left behind")
+
+	info, err := os.Stat(filepath.Join(dir, "SECRET_0"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o640), info.Mode().Perm())
+
+	assert.ErrorContains(t, sink.Write("SECRET_0", "other"), "file already written: SECRET_0")
+	assert.ErrorContains(t, sink.Write("../SECRET", "value"), "invalid file name")
+
+	lastWins := NewFileSink(dir, FileSinkConfig{ConflictPolicy: FileConflictLastWins})
+	require.NoError(t, lastWins.Write("PASSWORD", "first"))
+	require.NoError(t, lastWins.Write("PASSWORD", "second"))
+
+	content, err := os.ReadFile(filepath.Join(dir, "PASSWORD"))
+	require.NoError(t, err)
+	assert.Equal(t, "second", string(content))
+
+	info, err = os.Stat(filepath.Join(dir, "PASSWORD"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+}
+
+func TestEmptySecretPolicy(t *testing.T) {
+	t.Parallel()
+
+	client := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `{"data": {"data": {}, "metadata": {"version": 2}}}`)
+	})
+
+	placeholder := "unset"
+
+	tests := []struct {
+		name       string
+		config     Config
+		results    map[string]string
+		emptyError bool
+		err        string
+	}{
+		{
+			name:       "default",
+			config:     Config{},
+			emptyError: true,
+		},
+		{
+			name:       "error",
+			config:     Config{EmptySecretPolicy: EmptySecretFail, IgnoreMissingSecrets: true},
+			emptyError: true,
+		},
+		{
+			name:   "missing",
+			config: Config{EmptySecretPolicy: EmptySecretAsMissing},
+			err:    "path not found: secret/data/app",
+		},
+		{
+			name:    "missing ignored",
+			config:  Config{EmptySecretPolicy: EmptySecretAsMissing, IgnoreMissingSecrets: true, MissingValuePlaceholder: &placeholder},
+			results: map[string]string{"PASSWORD": "unset"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			injector := NewSecretInjector(test.config, client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+			results := map[string]string{}
+			err := injector.InjectSecretsFromVault(map[string]string{"PASSWORD": "vault:secret/data/app#password"}, func(key, value string) {
+				results[key] = value
+			})
+
+			switch {
+			case test.emptyError:
+				var emptyErr *EmptySecretError
+				require.ErrorAs(t, err, &emptyErr)
+				assert.Equal(t, "secret/data/app", emptyErr.Path)
+			case test.err != "":
+				assert.ErrorContains(t, err, test.err)
+			default:
+				require.NoError(t, err)
+				assert.Equal(t, test.results, results)
+			}
+		})
+	}
+
+	injector := NewSecretInjector(Config{}, client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, injector.InjectSecretsFromVaultPath("secret/data/app", func(string, string) {}))
+
+	injector = NewSecretInjector(Config{EmptySecretPolicy: EmptySecretFail}, client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	var emptyErr *EmptySecretError
+	assert.ErrorAs(t, injector.InjectSecretsFromVaultPath("secret/data/app", func(string, string) {}), &emptyErr)
+}
+
+func TestDeterministicOrder(t *testing.T) {
+	t.Parallel()
+
+	client := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `{"data": {"data": {"c": "3", "a": "1", "d": "4", "b": "2", "e": "5"}, "metadata": {"version": 1}}}`)
+	})
+
+	injector := NewSecretInjector(Config{}, client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	for range 5 {
+		var keys []string
+		err := injector.InjectSecretsFromVaultPath("secret/data/app", func(key, _ string) {
+			keys = append(keys, key)
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a", "b", "c", "d", "e"}, keys)
+
+		var names []string
+		err = injector.InjectSecretsFromVault(map[string]string{
+			"E": "vault:secret/data/app#e",
+			"C": "vault:secret/data/app#c",
+			"A": "vault:secret/data/app#a",
+			"D": "vault:secret/data/app#d",
+			"B": "vault:secret/data/app#b",
+		}, func(name, _ string) {
+			names = append(names, name)
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"A", "B", "C", "D", "E"}, names)
+	}
+}
+
+func TestInjectionCancelled(t *testing.T) {
+	t.Parallel()
+
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(10 * time.Second):
+		}
+		fmt.Fprint(w, `{"data": {"data": {"password": "secret"}, "metadata": {"version": 1}}}`)
+	})
+	// the shared reads aren't cancelled by their callers, they end with the client timeout
+	client.RawClient().SetClientTimeout(time.Second)
+
+	injector := NewSecretInjector(Config{}, client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	tests := map[string]func(ctx context.Context) error{
+		"references": func(ctx context.Context) error {
+			return injector.InjectSecretsFromVaultWithContext(ctx, map[string]string{
+				"PASSWORD": "vault:secret/data/app#password",
+				"INLINE":   "password=${vault:secret/data/inline#password}",
+			}, func(string, string) {})
+		},
+		"path": func(ctx context.Context) error {
+			return injector.InjectSecretsFromVaultPathWithContext(ctx, "secret/data/app", func(string, string) {})
+		},
+	}
+
+	for name, inject := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+
+			start := time.Now()
+			err := inject(ctx)
+
+			assert.ErrorIs(t, err, context.DeadlineExceeded)
+			assert.Less(t, time.Since(start), 5*time.Second)
+		})
+	}
+}
+
+func TestLoadReferences(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		content    string
+		references map[string]string
+		err        string
+	}{
+		{
+			name:       "yaml",
+			content:    "DB_PASSWORD: vault:secret/data/db#password\nDB_HOST: db.internal\n",
+			references: map[string]string{"DB_PASSWORD": "vault:secret/data/db#password", "DB_HOST": "db.internal"},
+		},
+		{
+			name:       "json",
+			content:    `{"DB_PASSWORD": "vault:secret/data/db#password#2"}`,
+			references: map[string]string{"DB_PASSWORD": "vault:secret/data/db#password#2"},
+		},
+		{
+			name:       "empty",
+			content:    "",
+			references: map[string]string{},
+		},
+		{
+			name:    "syntax error",
+			content: "DB_HOST: db.internal\nDB_PASSWORD: [\n",
+			err:     "line 2",
+		},
+		{
+			name:    "invalid reference",
+			content: "DB_HOST: db.internal\nDB_PASSWORD: vault:secret/data/db\n",
+			err:     "line 2: reference vault:secret/data/db: secret data key or template not defined",
+		},
+		{
+			name:    "not a string",
+			content: "DB_HOSTS:\n  - db-0\n",
+			err:     "line 2: reference of DB_HOSTS must be a string",
+		},
+		{
+			name:    "duplicate",
+			content: "DB_HOST: db-0\nDB_HOST: db-1\n",
+			err:     "line 2: duplicate variable name DB_HOST",
+		},
+		{
+			name:    "not a mapping",
+			content: "- DB_HOST\n",
+			err:     "line 1: references must be a mapping",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(t.TempDir(), "secrets.yaml")
+			require.NoError(t, os.WriteFile(path, []byte(test.content), 0o600))
+
+			references, err := LoadReferences(path)
+			if test.err != "" {
+				assert.ErrorContains(t, err, test.err)
+
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.references, references)
+		})
+	}
+}
+
+func TestInjectFromFile(t *testing.T) {
+	t.Parallel()
+
+	client := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `{"data": {"data": {"password": "secret"}, "metadata": {"version": 1}}}`)
+	})
+
+	path := filepath.Join(t.TempDir(), "secrets.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("DB_PASSWORD: vault:secret/data/db#password\nDB_HOST: db.internal\n"), 0o600))
+
+	injector := NewSecretInjector(Config{}, client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	results := map[string]string{}
+	err := injector.InjectFromFile(context.Background(), path, func(key, value string) {
+		results[key] = value
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"DB_PASSWORD": "secret", "DB_HOST": "db.internal"}, results)
+}
+
+func TestTokenPassthroughName(t *testing.T) {
+	t.Parallel()
+
+	client := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"errors": []}`)
+	})
+
+	tests := []struct {
+		name   string
+		config Config
+		target string
+	}{
+		{name: "default", config: Config{}, target: "VAULT_TOKEN"},
+		{name: "custom", config: Config{TokenPassthroughName: "APP_VAULT_TOKEN"}, target: "APP_VAULT_TOKEN"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			injector := NewSecretInjector(test.config, client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+			results := map[string]string{}
+			err := injector.InjectSecretsFromVault(map[string]string{test.target: "vault:login"}, func(key, value string) {
+				results[key] = value
+			})
+			require.NoError(t, err)
+			assert.Equal(t, map[string]string{test.target: "token"}, results)
+
+			err = injector.InjectSecretsFromVault(map[string]string{"OTHER_TOKEN": "vault:login"}, func(string, string) {})
+			assert.Error(t, err, "only the configured variable receives the token")
+		})
+	}
+}
+
+func TestPathTimeouts(t *testing.T) {
+	t.Parallel()
+
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(300 * time.Millisecond):
+		}
+		fmt.Fprint(w, `{"data": {"username": "user", "password": "secret"}}`)
+	})
+	client.RawClient().SetClientTimeout(100 * time.Millisecond)
+
+	injector := NewSecretInjector(Config{
+		PathTimeouts: map[string]time.Duration{
+			"database/":            50 * time.Millisecond,
+			"database/creds/slow/": 5 * time.Second,
+		},
+	}, client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	tests := []struct {
+		reference string
+		err       bool
+	}{
+		{reference: "vault:database/creds/slow/app#password"},
+		{reference: "vault:database/creds/app#password", err: true},
+		{reference: "vault:kv/app#password", err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.reference, func(t *testing.T) {
+			t.Parallel()
+
+			err := injector.InjectSecretsFromVault(map[string]string{"PASSWORD": test.reference}, func(string, string) {})
+			if test.err {
+				assert.ErrorIs(t, err, context.DeadlineExceeded)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestOnSecretChange(t *testing.T) {
+	t.Parallel()
+
+	var password atomic.Value
+	password.Store("first")
+
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/secret/data/static" {
+			fmt.Fprint(w, `{"data": {"data": {"user": "app"}, "metadata": {"version": 1}}}`)
+
+			return
+		}
+
+		fmt.Fprintf(w, `{"data": {"data": {"password": %q}, "metadata": {"version": 1}}}`, password.Load())
+	})
+
+	type change struct {
+		path     string
+		old, new map[string]interface{}
+	}
+
+	var injector SecretInjector
+	var changes []change
+	injector = NewSecretInjector(Config{
+		DaemonMode: true,
+		OnSecretChange: func(path string, old, new map[string]interface{}) {
+			changes = append(changes, change{path: path, old: old, new: new})
+
+			// no lock of the injector is held during the callback
+			_, err := injector.GetDataFromVault(map[string]string{"USER": "vault:secret/data/static#user"})
+			assert.NoError(t, err)
+		},
+	}, client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	err := injector.InjectSecretsFromVault(map[string]string{
+		"PASSWORD": "vault:secret/data/app#password",
+		"USER":     "vault:secret/data/static#user",
+	}, func(string, string) {})
+	require.NoError(t, err)
+
+	require.NoError(t, injector.Reload())
+	assert.Empty(t, changes)
+
+	password.Store("second")
+
+	require.NoError(t, injector.Reload())
+	assert.Equal(t, []change{{
+		path: "secret/data/app",
+		old:  map[string]interface{}{"password": "first"},
+		new:  map[string]interface{}{"password": "second"},
+	}}, changes)
+}
+
+func TestMaxValueSize(t *testing.T) {
+	t.Parallel()
+
+	client := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `{"data": {"data": {"password": "secret", "certificate": "0123456789abcdef"}, "metadata": {"version": 1}}}`)
+	})
+
+	references := map[string]string{
+		"PASSWORD":    "vault:secret/data/app#password",
+		"CERTIFICATE": "vault:secret/data/app#certificate",
+	}
+
+	t.Run("error", func(t *testing.T) {
+		t.Parallel()
+
+		injector := NewSecretInjector(Config{MaxValueSize: 10}, client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+		results := map[string]string{}
+		err := injector.InjectSecretsFromVault(references, func(key, value string) {
+			results[key] = value
+		})
+
+		var oversized *OversizedValueError
+		require.ErrorAs(t, err, &oversized)
+		assert.Equal(t, OversizedValueError{Name: "CERTIFICATE", Size: 16, MaxSize: 10}, *oversized)
+		assert.NotContains(t, results, "CERTIFICATE")
+
+		err = injector.InjectSecretsFromVaultPath("secret/data/app", func(string, string) {})
+		require.ErrorAs(t, err, &oversized)
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		t.Parallel()
+
+		injector := NewSecretInjector(
+			Config{MaxValueSize: 10, OversizedValuePolicy: OversizedValueSkip},
+			client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)),
+		)
+
+		results := map[string]string{}
+		err := injector.InjectSecretsFromVault(references, func(key, value string) {
+			results[key] = value
+		})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"PASSWORD": "secret"}, results)
+
+		results = map[string]string{}
+		err = injector.InjectSecretsFromVaultPath("secret/data/app", func(key, value string) {
+			results[key] = value
+		})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"password": "secret"}, results)
+	})
+
+	t.Run("unlimited", func(t *testing.T) {
+		t.Parallel()
+
+		injector := NewSecretInjector(Config{}, client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+		results := map[string]string{}
+		err := injector.InjectSecretsFromVault(references, func(key, value string) {
+			results[key] = value
+		})
+		require.NoError(t, err)
+		assert.Len(t, results, 2)
+	})
+}
+
+func TestKVValueTransform(t *testing.T) {
+	t.Parallel()
+
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/v1/transit/") {
+			fmt.Fprintf(w, `{"data": {"batch_results": [{"plaintext": %q}]}}`, base64.StdEncoding.EncodeToString([]byte("plaintext")))
+
+			return
+		}
+
+		fmt.Fprint(w, `{"data": {"data": {"password": "secret"}, "metadata": {"version": 1}}}`)
+	})
+
+	prefix := func(prefix string) func([]byte) ([]byte, error) {
+		return func(value []byte) ([]byte, error) {
+			return append([]byte(prefix), value...), nil
+		}
+	}
+
+	injector := NewSecretInjector(Config{
+		TransitKeyID:          "mykey",
+		TransitValueTransform: prefix("transit:"),
+		KVValueTransform:      prefix("kv:"),
+	}, client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	results := map[string]string{}
+	inject := func(key, value string) {
+		results[key] = value
+	}
+
+	err := injector.InjectSecretsFromVault(map[string]string{
+		"PASSWORD": "vault:secret/data/app#password",
+		"TEMPLATE": "vault:secret/data/app#${.password}",
+	}, inject)
+	require.NoError(t, err)
+
+	err = injector.InjectSecretsFromVaultPath("secret/data/app", inject)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{"PASSWORD": "kv:secret", "TEMPLATE": "kv:secret", "password": "kv:secret"}, results)
+
+	out, err := injector.FetchTransitSecrets([]string{"ciphertext"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"ciphertext": []byte("transit:plaintext")}, out)
+
+	failing := NewSecretInjector(Config{
+		KVValueTransform: func([]byte) ([]byte, error) {
+			return nil, errors.New("not base64")
+		},
+	}, client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	err = failing.InjectSecretsFromVault(map[string]string{"PASSWORD": "vault:secret/data/app#password"}, inject)
+	assert.ErrorContains(t, err, "failed to transform secret value")
+}
+
+func TestTransformPipeline(t *testing.T) {
+	t.Parallel()
+
+	client := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprintf(w, `{"data": {"data": {"certificate": %q, "port": " 5432 ", "password": "secret", "a|trimspace": "pipe"}, "metadata": {"version": 1}}}`,
+			base64.StdEncoding.EncodeToString([]byte("  pem\n")))
+	})
+
+	injector := NewSecretInjector(Config{
+		ValueTransforms: map[string]func([]byte) ([]byte, error){
+			"reverse": func(value []byte) ([]byte, error) {
+				slices.Reverse(value)
+
+				return value, nil
+			},
+		},
+	}, client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	results := map[string]string{}
+	err := injector.InjectSecretsFromVault(map[string]string{
+		"CERTIFICATE": "vault:secret/data/app#certificate|base64decode|trimspace",
+		"PORT":        "vault:secret/data/app#port:int|trimspace",
+		"PASSWORD":    "vault:secret/data/app#password|reverse|base64encode#1",
+		"TEMPLATE":    "vault:secret/data/app#${.password | upper}|reverse",
+		"PIPE":        "vault:secret/data/app#a\\|trimspace",
+	}, func(key, value string) {
+		results[key] = value
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{
+		"CERTIFICATE": "pem",
+		"PORT":        "5432",
+		"PASSWORD":    base64.StdEncoding.EncodeToString([]byte("terces")),
+		"TEMPLATE":    "TERCES",
+		"PIPE":        "pipe",
+	}, results)
+
+	err = injector.InjectSecretsFromVault(map[string]string{"PASSWORD": "vault:secret/data/app#password|base64decode"}, func(string, string) {})
+	assert.ErrorContains(t, err, "transform base64decode failed")
+}
+
+func TestSharedClient(t *testing.T) {
+	t.Parallel()
+
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/v1/transit/") {
+			fmt.Fprintf(w, `{"data": {"batch_results": [{"plaintext": %q}]}}`, base64.StdEncoding.EncodeToString([]byte("plaintext")))
+
+			return
+		}
+
+		fmt.Fprintf(w, `{"data": {"data": {"password": %q}, "metadata": {"version": 1}}}`, r.URL.Path)
+	})
+
+	var wg sync.WaitGroup
+	for n := 0; n < 20; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			config := Config{TransitKeyID: "mykey", DaemonMode: n%2 == 0}
+			if n%3 == 0 {
+				config.PathTimeouts = map[string]time.Duration{"secret/": 5 * time.Second}
+			}
+			injector := NewSecretInjector(config, client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+			results := map[string]string{}
+			err := injector.InjectSecretsFromVault(map[string]string{
+				"PASSWORD": fmt.Sprintf("vault:secret/data/app%d#password", n),
+				"SHARED":   "vault:secret/data/shared#password",
+			}, func(key, value string) {
+				results[key] = value
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, map[string]string{
+				"PASSWORD": fmt.Sprintf("/v1/secret/data/app%d", n),
+				"SHARED":   "/v1/secret/data/shared",
+			}, results)
+
+			out, err := injector.FetchTransitSecrets([]string{fmt.Sprintf("ciphertext%d", n)})
+			assert.NoError(t, err)
+			assert.Equal(t, []byte("plaintext"), out[fmt.Sprintf("ciphertext%d", n)])
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, "token", client.RawClient().Token())
+	assert.Equal(t, 60*time.Second, client.RawClient().ClientTimeout())
+}
+
+func TestRenderFile(t *testing.T) {
+	t.Parallel()
+
+	client := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `{"data": {"data": {"password": "p\"a\\ss\nw=rd", "greeting": " héllo\t😀"}, "metadata": {"version": 1}}}`)
+	})
+
+	references := map[string]string{
+		"PASSWORD":     "vault:secret/data/app#password",
+		"app.greeting": "vault:secret/data/app#greeting",
+	}
+
+	for _, test := range []struct {
+		format   OutputFormat
+		expected string
+	}{
+		{
+			format:   "",
+			expected: "PASSWORD=\"p\\\"a\\\\ss\\nw=rd\"\napp.greeting=\" héllo\t\U0001F600\"\n",
+		},
+		{
+			format:   OutputFormatProperties,
+			expected: "PASSWORD=p\"a\\\\ss\\nw\\=rd\napp.greeting=\\ h\\u00E9llo\\t\\uD83D\\uDE00\n",
+		},
+		{
+			format:   OutputFormatINI,
+			expected: "PASSWORD = \"p\\\"a\\\\ss\\nw=rd\"\napp.greeting = \" héllo\t\U0001F600\"\n",
+		},
+		{
+			format:   OutputFormatTOML,
+			expected: "PASSWORD = \"p\\\"a\\\\ss\\nw=rd\"\n\"app.greeting\" = \" héllo\\t\U0001F600\"\n",
+		},
+	} {
+		t.Run(string(test.format), func(t *testing.T) {
+			t.Parallel()
+
+			injector := NewSecretInjector(Config{OutputFormat: test.format}, client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+			var out strings.Builder
+			require.NoError(t, injector.RenderFile(context.Background(), references, &out))
+			assert.Equal(t, test.expected, out.String())
+		})
+	}
+
+	t.Run("custom", func(t *testing.T) {
+		t.Parallel()
+
+		injector := NewSecretInjector(Config{
+			OutputFormat: "shell",
+			OutputEncoders: map[OutputFormat]OutputEncoder{
+				"shell": func(name, value string) (string, error) {
+					return fmt.Sprintf("export %s=%q", strings.ReplaceAll(name, ".", "_"), value), nil
+				},
+			},
+		}, client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+		var out strings.Builder
+		require.NoError(t, injector.RenderFile(context.Background(), map[string]string{"app.greeting": "plain"}, &out))
+		assert.Equal(t, "export app_greeting=\"plain\"\n", out.String())
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		t.Parallel()
+
+		injector := NewSecretInjector(Config{OutputFormat: "yaml"}, client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+		assert.EqualError(t, injector.RenderFile(context.Background(), references, io.Discard), "unsupported output format: yaml")
+
+		injector = NewSecretInjector(Config{OutputFormat: OutputFormatINI}, client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+		err := injector.RenderFile(context.Background(), map[string]string{"[section]": "plain"}, io.Discard)
+		assert.EqualError(t, err, "failed to encode variable [section]: invalid INI key: [section]")
+	})
+}
+
+func TestResolvedVersions(t *testing.T) {
+	t.Parallel()
+
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/kv1/app" {
+			fmt.Fprint(w, `{"data": {"password": "v1"}}`)
+
+			return
+		}
+
+		version := r.URL.Query().Get("version")
+		if version == "" || version == "-1" {
+			version = "3"
+		}
+		fmt.Fprintf(w, `{"data": {"data": {"password": "secret"}, "metadata": {"version": %s}}}`, version)
+	})
+
+	injector := NewSecretInjector(Config{RecordVersions: true}, client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	references := map[string]string{
+		"LATEST": "vault:secret/data/app#password",
+		"PINNED": "vault:secret/data/app#password#2",
+		"KV1":    "vault:kv1/app#password",
+	}
+	require.NoError(t, injector.InjectSecretsFromVault(references, func(string, string) {}))
+	require.NoError(t, injector.InjectSecretsFromVaultPath("secret/data/other", func(string, string) {}))
+
+	expected := map[string]ResolvedVersion{
+		"LATEST":   {Path: "secret/data/app", Version: 3},
+		"PINNED":   {Path: "secret/data/app", Version: 2},
+		"password": {Path: "secret/data/other", Version: 3},
+	}
+	assert.Equal(t, expected, injector.ResolvedVersions())
+
+	// the versions of the cached secrets are recorded as well
+	cached := NewSecretInjector(Config{RecordVersions: true, Cache: injector.cache}, client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, cached.InjectSecretsFromVault(references, func(string, string) {}))
+	assert.Equal(t, map[string]ResolvedVersion{"LATEST": expected["LATEST"], "PINNED": expected["PINNED"]}, cached.ResolvedVersions())
+
+	disabled := NewSecretInjector(Config{}, client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, disabled.InjectSecretsFromVault(references, func(string, string) {}))
+	assert.Empty(t, disabled.ResolvedVersions())
+}
+
+func TestTransitKeyCache(t *testing.T) {
+	t.Parallel()
+
+	var lookups atomic.Int32
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		lookups.Add(1)
+
+		if r.URL.Path != "/v1/transit/keys/mykey" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors": []}`)
+
+			return
+		}
+
+		fmt.Fprint(w, `{"data": {"name": "mykey", "type": "aes256-gcm96"}}`)
+	})
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cache := NewMemoryCache()
+
+	// the lookup is shared by the injectors with the same cache, e.g. the runs of a job with a persistent cache
+	for n := 0; n < 3; n++ {
+		injector := NewSecretInjector(Config{TransitKeyID: "mykey", Cache: cache}, client, nil, logger)
+		require.NoError(t, injector.Validate(context.Background()))
+	}
+	assert.Equal(t, int32(1), lookups.Load())
+
+	// missing keys aren't cached
+	missing := NewSecretInjector(Config{TransitKeyID: "missing", Cache: cache}, client, nil, logger)
+	require.Error(t, missing.Validate(context.Background()))
+	require.Error(t, missing.Validate(context.Background()))
+	assert.Equal(t, int32(3), lookups.Load())
+
+	// expired lookups are repeated
+	expiring := NewSecretInjector(Config{TransitKeyID: "mykey", Cache: cache, TransitKeyCacheTTL: time.Nanosecond}, client, nil, logger)
+	require.NoError(t, expiring.Validate(context.Background()))
+	assert.Equal(t, int32(4), lookups.Load())
+}
+
+func TestTransitKeyCacheClockSkew(t *testing.T) {
+	t.Parallel()
+
+	var lookups atomic.Int32
+	client := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		lookups.Add(1)
+		fmt.Fprint(w, `{"data": {"name": "mykey", "type": "aes256-gcm96"}}`)
+	})
+
+	cache := NewMemoryCache()
+	injector := NewSecretInjector(Config{
+		TransitKeyID:       "mykey",
+		Cache:              cache,
+		TransitKeyCacheTTL: time.Hour,
+		ClockSkewTolerance: time.Minute,
+	}, client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	// lookups cached by hosts with clocks ahead within and beyond the tolerance, and one close to its expiry
+	for checkedAt, cached := range map[time.Duration]bool{
+		30 * time.Second:            true,
+		2 * time.Minute:             false,
+		-time.Hour + 30*time.Second: false,
+	} {
+		cache.Set(transitKeyCacheKey("", "mykey"), []byte(time.Now().Add(checkedAt).Format(time.RFC3339Nano)))
+
+		before := lookups.Load()
+		require.NoError(t, injector.Validate(context.Background()))
+
+		if cached {
+			assert.Equal(t, before, lookups.Load(), checkedAt)
+		} else {
+			assert.Equal(t, before+1, lookups.Load(), checkedAt)
+		}
+	}
+}
+
+func TestWarningHandler(t *testing.T) {
+	t.Parallel()
+
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		warnings := `[]`
+		if r.URL.Path == "/v1/database/creds/app" {
+			warnings = `["TTL of \"768h\" exceeded the effective max_ttl of \"24h\"; TTL value is capped accordingly"]`
+		}
+
+		fmt.Fprintf(w, `{"data": {"password": "secret"}, "warnings": %s}`, warnings)
+	})
+
+	var handled []string
+	injector := NewSecretInjector(Config{
+		WarningHandler: func(path string, warnings []string) error {
+			handled = append(handled, path)
+
+			for _, warning := range warnings {
+				if strings.Contains(warning, "max_ttl") {
+					return errors.New(warning)
+				}
+			}
+
+			return nil
+		},
+	}, client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	err := injector.InjectSecretsFromVault(map[string]string{"PASSWORD": "vault:kv/app#password"}, func(string, string) {})
+	require.NoError(t, err)
+	assert.Empty(t, handled, "the handler is only called with warnings")
+
+	err = injector.InjectSecretsFromVault(map[string]string{"PASSWORD": "vault:database/creds/app#password"}, func(string, string) {})
+	assert.ErrorContains(t, err, "warnings of path: database/creds/app: TTL of \"768h\" exceeded the effective max_ttl")
+	assert.Equal(t, []string{"database/creds/app"}, handled)
+
+	var logs strings.Builder
+	logging := NewSecretInjector(Config{}, client, nil, slog.New(slog.NewTextHandler(&logs, nil)))
+	err = logging.InjectSecretsFromVault(map[string]string{"PASSWORD": "vault:database/creds/app#password"}, func(string, string) {})
+	require.NoError(t, err)
+	assert.Contains(t, logs.String(), "exceeded the effective max_ttl")
+}
+
+func TestNamespacePerReference(t *testing.T) {
+	t.Parallel()
+
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"data": {"namespace": %q}}`, r.Header.Get(vaultapi.NamespaceHeaderName))
+	})
+	client.RawClient().SetNamespace("root-team")
+
+	injector := NewSecretInjector(Config{}, client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	references := map[string]string{
+		"DEFAULT": "vault:secret/app#namespace",
+		"TEAM_A":  "vault:ns=team-a:secret/app#namespace",
+		"TEAM_B":  "vault:ns=team-b/sub:secret/app#namespace",
+	}
+
+	injected := map[string]string{}
+	err := injector.InjectSecretsFromVault(references, func(key, value string) {
+		injected[key] = value
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{"DEFAULT": "root-team", "TEAM_A": "team-a", "TEAM_B": "team-b/sub"}, injected)
+	assert.Equal(t, "root-team", client.RawClient().Namespace(), "the namespace of the shared client is kept")
+}
+
+func TestMaxResponseSize(t *testing.T) {
+	t.Parallel()
+
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		value := "secret"
+		if r.URL.Path == "/v1/kv/huge" {
+			value = strings.Repeat("x", 4096)
+		}
+
+		fmt.Fprintf(w, `{"data": {"value": %q}}`, value)
+	}, vault.ClientMaxResponseSize(1024))
+
+	injector := NewSecretInjector(Config{}, client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	injected := map[string]string{}
+	err := injector.InjectSecretsFromVault(map[string]string{"VALUE": "vault:kv/app#value"}, func(key, value string) {
+		injected[key] = value
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"VALUE": "secret"}, injected)
+
+	err = injector.InjectSecretsFromVault(map[string]string{"VALUE": "vault:kv/huge#value"}, func(string, string) {})
+
+	var tooLarge *vault.ResponseTooLargeError
+	require.ErrorAs(t, err, &tooLarge)
+	assert.Equal(t, int64(1024), tooLarge.MaxSize)
+}
+
+func TestAuditManifest(t *testing.T) {
+	t.Parallel()
+
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/kv1/app" {
+			fmt.Fprint(w, `{"data": {"username": "user"}}`)
+
+			return
+		}
+
+		fmt.Fprint(w, `{"data": {"data": {"password": "secret"}, "metadata": {"version": 3}}}`)
+	})
+
+	path := filepath.Join(t.TempDir(), "manifest.json")
+	injector := NewSecretInjector(Config{AuditManifestPath: path}, client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	references := map[string]string{
+		"PASSWORD": "vault:secret/data/app#password",
+		"USERNAME": "vault:kv1/app#username",
+		"PLAIN":    "plain",
+	}
+	require.NoError(t, injector.InjectSecretsFromVault(references, func(string, string) {}))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), `"secret"`)
+
+	var manifest AuditManifest
+	require.NoError(t, json.Unmarshal(data, &manifest))
+	assert.False(t, manifest.InjectedAt.IsZero())
+
+	hash := func(value string) string {
+		sum := sha256.Sum256([]byte(value))
+
+		return hex.EncodeToString(sum[:])
+	}
+	expected := []AuditManifestEntry{
+		{Name: "PASSWORD", Reference: "vault:secret/data/app#password", Path: "secret/data/app", Version: 3, SHA256: hash("secret")},
+		{Name: "PLAIN", Reference: "plain", SHA256: hash("plain")},
+		{Name: "USERNAME", Reference: "vault:kv1/app#username", Path: "kv1/app", SHA256: hash("user")},
+	}
+	assert.Equal(t, expected, manifest.Entries)
+	assert.Empty(t, injector.ResolvedVersions(), "the versions are only returned with RecordVersions")
+
+	// a failed injection still records what was injected
+	err = injector.InjectSecretsFromVault(map[string]string{"INJECTED": "plain", "MISSING": "vault:kv1/app#missing"}, func(string, string) {})
+	require.Error(t, err)
+
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+
+	var failed AuditManifest
+	require.NoError(t, json.Unmarshal(data, &failed))
+	assert.Equal(t, []AuditManifestEntry{{Name: "INJECTED", Reference: "plain", SHA256: hash("plain")}}, failed.Entries)
+}
+
+func TestStrictKVMetadata(t *testing.T) {
+	t.Parallel()
+
+	client := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `{"data": {"data": {"password": "secret"}}}`)
+	})
+
+	references := map[string]string{"PASSWORD": "vault:secret/data/app#password"}
+
+	lenient := NewSecretInjector(Config{RecordVersions: true}, client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	injected := map[string]string{}
+	err := lenient.InjectSecretsFromVault(references, func(key, value string) {
+		injected[key] = value
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"PASSWORD": "secret"}, injected)
+	assert.Empty(t, lenient.ResolvedVersions(), "the version is unknown without metadata")
+
+	strict := NewSecretInjector(Config{StrictKVMetadata: true}, client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	err = strict.InjectSecretsFromVault(references, func(string, string) {})
+	assert.EqualError(t, err, "metadata key not found or is nil in secret")
+}
+
+func TestDistinctWritesToSamePath(t *testing.T) {
+	t.Parallel()
+
+	var writes atomic.Int32
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			fmt.Fprint(w, `{"data": {"certificate": "read"}}`)
+			return
+		}
+
+		writes.Add(1)
+		var data map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, `{"data": {"certificate": %q}}`, data["common_name"])
+	})
+
+	injector := NewSecretInjector(Config{}, client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	references := map[string]string{
+		"CERT_A":       `>>vault:pki/issue/role#certificate#{"common_name":"a"}`,
+		"CERT_A_AGAIN": `>>vault:pki/issue/role#certificate#{ "common_name": "a" }`,
+		"CERT_B":       `>>vault:pki/issue/role#certificate#{"common_name":"b"}`,
+		"CERT_READ":    "vault:pki/issue/role#certificate",
+	}
+
+	injected := map[string]string{}
+	err := injector.InjectSecretsFromVault(references, func(key, value string) {
+		injected[key] = value
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{
+		"CERT_A":       "a",
+		"CERT_A_AGAIN": "a",
+		"CERT_B":       "b",
+		"CERT_READ":    "read",
+	}, injected)
+	assert.EqualValues(t, 2, writes.Load(), "only the writes of the same payload should share a result")
+
+	// the writes aren't cached, the next injection writes again
+	err = injector.InjectSecretsFromVault(map[string]string{"CERT_A": references["CERT_A"]}, func(string, string) {})
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, writes.Load())
+}
+
+func TestTransitConcurrency(t *testing.T) {
+	t.Parallel()
+
+	var inFlight, maxInFlight atomic.Int32
+	unblock := make(chan struct{})
+	client := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		current := inFlight.Add(1)
+		defer inFlight.Add(-1)
+
+		for {
+			observed := maxInFlight.Load()
+			if current <= observed || maxInFlight.CompareAndSwap(observed, current) {
+				break
+			}
+		}
+
+		<-unblock
+		fmt.Fprintf(w, `{"data": {"batch_results": [{"plaintext": %q}]}}`, base64.StdEncoding.EncodeToString([]byte("plaintext")))
+	})
+
+	release := sync.OnceFunc(func() { close(unblock) })
+	t.Cleanup(release)
+
+	injector := NewSecretInjector(Config{TransitKeyID: "mykey", TransitConcurrency: 2}, client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	var wg sync.WaitGroup
+	for n := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			_, err := injector.FetchTransitSecrets([]string{fmt.Sprintf("vault:v1:%d", n)})
+			assert.NoError(t, err)
+		}()
+	}
+
+	require.Eventually(t, func() bool { return inFlight.Load() == 2 }, 5*time.Second, 10*time.Millisecond)
+
+	// all the slots are taken, so the wait for one is cancelled
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := injector.FetchTransitSecretsWithContext(ctx, []string{"vault:v1:cancelled"})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorContains(t, err, "waiting for a free transit decryption slot")
+
+	release()
+	wg.Wait()
+
+	assert.EqualValues(t, 2, maxInFlight.Load())
+}
+
+func TestSharedReadOutlivesCancelledCaller(t *testing.T) {
+	t.Parallel()
+
+	var requests atomic.Int32
+	started := make(chan struct{}, 1)
+	unblock := make(chan struct{})
+	release := sync.OnceFunc(func() { close(unblock) })
+	t.Cleanup(release)
+
+	client := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		started <- struct{}{}
+		<-unblock
+		fmt.Fprint(w, `{"data": {"data": {"password": "secret"}, "metadata": {"version": 1}}}`)
+	})
+
+	injector := NewSecretInjector(Config{}, client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	references := map[string]string{"PASSWORD": "vault:secret/data/app#password"}
+
+	firstCtx, cancelFirst := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		firstErr <- injector.InjectSecretsFromVaultWithContext(firstCtx, references, func(string, string) {})
+	}()
+	<-started
+
+	var injected atomic.Value
+	secondErr := make(chan error, 1)
+	go func() {
+		secondErr <- injector.InjectSecretsFromVaultWithContext(context.Background(), references, func(_, value string) {
+			injected.Store(value)
+		})
+	}()
+
+	// give the second caller the time to join the read of the first one
+	time.Sleep(100 * time.Millisecond)
+	cancelFirst()
+	require.ErrorIs(t, <-firstErr, context.Canceled)
+
+	release()
+	require.NoError(t, <-secondErr)
+	assert.Equal(t, "secret", injected.Load())
+	assert.EqualValues(t, 1, requests.Load(), "the read should be shared")
+}
+
+func TestPrefetchSkipsWrites(t *testing.T) {
+	t.Parallel()
+
+	var reads, writes atomic.Int32
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			reads.Add(1)
+			fmt.Fprint(w, `{"data": {"data": {"password": "secret"}, "metadata": {"version": 1}}}`)
+
+			return
+		}
+
+		writes.Add(1)
+		fmt.Fprintf(w, `{"data": {"certificate": "cert-%d"}}`, writes.Load())
+	})
+
+	injector := NewSecretInjector(Config{}, client, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	references := map[string]string{
+		"PASSWORD":    "vault:secret/data/app#password",
+		"CERT":        ">>vault:pki/issue/role#certificate",
+		"INLINE_CERT": "cert=${>>vault:pki/issue/role#certificate}",
+	}
+
+	require.NoError(t, injector.Prefetch(context.Background(), references))
+	assert.EqualValues(t, 1, reads.Load())
+	assert.EqualValues(t, 0, writes.Load(), "writes aren't prefetched")
+
+	injected := map[string]string{}
+	err := injector.InjectSecretsFromVault(references, func(key, value string) {
+		injected[key] = value
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{"PASSWORD": "secret", "CERT": "cert-1", "INLINE_CERT": "cert=cert-1"}, injected)
+	assert.EqualValues(t, 1, reads.Load(), "the read is served from the prefetched cache")
+	assert.EqualValues(t, 1, writes.Load())
+}
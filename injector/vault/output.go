@@ -0,0 +1,179 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+
+	"emperror.dev/errors"
+)
+
+// OutputFormat is a file format RenderFile can write the secrets in.
+type OutputFormat string
+
+const (
+	// OutputFormatEnv is the .env format of RenderEnvFile
+	OutputFormatEnv OutputFormat = "env"
+	// OutputFormatProperties is the Java .properties format, non-ASCII characters are written as \uXXXX escapes
+	OutputFormatProperties OutputFormat = "properties"
+	// OutputFormatINI writes name = "value" lines, with backslashes, quotes and newlines escaped with a backslash
+	OutputFormatINI OutputFormat = "ini"
+	// OutputFormatTOML writes the secrets as TOML basic strings
+	OutputFormatTOML OutputFormat = "toml"
+)
+
+// OutputEncoder encodes a secret as one line (without the line break) of a file format.
+type OutputEncoder func(name, value string) (string, error)
+
+var outputEncoders = map[OutputFormat]OutputEncoder{
+	OutputFormatEnv: func(name, value string) (string, error) {
+		return name + "=" + quoteEnvFileValue(value), nil
+	},
+	OutputFormatProperties: func(name, value string) (string, error) {
+		return escapeProperty(name, true) + "=" + escapeProperty(value, false), nil
+	},
+	OutputFormatINI: func(name, value string) (string, error) {
+		if strings.ContainsAny(name, "=:;#[]\n\r") || strings.TrimSpace(name) != name {
+			return "", errors.Errorf("invalid INI key: %s", name)
+		}
+
+		return name + ` = "` + iniValueReplacer.Replace(value) + `"`, nil
+	},
+	OutputFormatTOML: func(name, value string) (string, error) {
+		if !tomlBareKeyRegex.MatchString(name) {
+			name = quoteTOML(name)
+		}
+
+		return name + " = " + quoteTOML(value), nil
+	},
+}
+
+var iniValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`)
+
+var tomlBareKeyRegex = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// escapeProperty escapes a key or value of a .properties file, as read by java.util.Properties.load.
+func escapeProperty(s string, key bool) string {
+	var b strings.Builder
+
+	for pos, r := range s {
+		switch {
+		case r == '\\':
+			b.WriteString(`\\`)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\f':
+			b.WriteString(`\f`)
+		case r == ' ' && (key || pos == 0):
+			b.WriteString(`\ `)
+		case r == '=' || r == ':' || r == '#' || r == '!':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r > 0x7e:
+			for _, unit := range utf16.Encode([]rune{r}) {
+				fmt.Fprintf(&b, `\u%04X`, unit)
+			}
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+// quoteTOML quotes a string as a TOML basic string.
+func quoteTOML(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+
+	for _, r := range s {
+		switch r {
+		case '\\':
+			b.WriteString(`\\`)
+		case '"':
+			b.WriteString(`\"`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\r':
+			b.WriteString(`\r`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\u%04X`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+
+	b.WriteByte('"')
+
+	return b.String()
+}
+
+// RenderFile resolves the references and writes them to w in the Config.OutputFormat, sorted by name.
+func (i *SecretInjector) RenderFile(ctx context.Context, references map[string]string, w io.Writer) error {
+	format := i.config.OutputFormat
+	if format == "" {
+		format = OutputFormatEnv
+	}
+
+	return i.render(ctx, references, w, format)
+}
+
+func (i *SecretInjector) render(ctx context.Context, references map[string]string, w io.Writer, format OutputFormat) error {
+	encode, ok := i.config.OutputEncoders[format]
+	if !ok {
+		if encode, ok = outputEncoders[format]; !ok {
+			return errors.Errorf("unsupported output format: %s", format)
+		}
+	}
+
+	data, err := i.getDataFromVault(ctx, references)
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	for _, name := range sortedKeys(data) {
+		line, err := encode(name, data[name])
+		if err != nil {
+			return errors.WithMessagef(err, "failed to encode variable %s", name)
+		}
+
+		if _, err := io.WriteString(w, line+"\n"); err != nil {
+			return errors.Wrapf(err, "failed to write %s file", format)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,67 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"fmt"
+	"log/slog"
+
+	"emperror.dev/errors"
+	"github.com/spf13/cast"
+)
+
+const redacted = "[REDACTED]"
+
+// SecretString is a resolved secret value which redacts itself when it's formatted or logged,
+// so it can't leak into log messages and wrapped errors by accident. Use Reveal to get the value.
+// The injector holds the resolved values (KV values, templates, transit plaintexts) as SecretStrings
+// through the transforms and checks, they are only revealed for the transforms and the inject callback.
+type SecretString string
+
+// Reveal returns the secret value.
+func (s SecretString) Reveal() string {
+	return string(s)
+}
+
+func (s SecretString) String() string {
+	return redacted
+}
+
+func (s SecretString) GoString() string {
+	return redacted
+}
+
+// Format redacts the value for all verbs, including %s, %v, %q and %x.
+func (s SecretString) Format(f fmt.State, _ rune) {
+	_, _ = fmt.Fprint(f, redacted)
+}
+
+func (s SecretString) LogValue() slog.Value {
+	return slog.StringValue(redacted)
+}
+
+func (s SecretString) MarshalText() ([]byte, error) {
+	return []byte(redacted), nil
+}
+
+// toSecretString casts a secret value read from Vault to a string, without mentioning the value in the error.
+func toSecretString(value interface{}) (SecretString, error) {
+	s, err := cast.ToStringE(value)
+	if err != nil {
+		return "", errors.Errorf("value of type %T can't be cast to a string", value)
+	}
+
+	return SecretString(s), nil
+}
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"sort"
 	"strings"
 	"text/template"
 
@@ -46,10 +47,11 @@ const (
 
 const templateName = "config"
 
-// Templater is used to hold the delimeters used to configure the template engine
+// Templater is used to hold the delimeters and extra functions used to configure the template engine
 type Templater struct {
 	leftDelimiter  string
 	rightDelimiter string
+	funcs          template.FuncMap
 }
 
 // NewTemplater initializes a new templater object
@@ -60,6 +62,40 @@ func NewTemplater(leftDelimiter, rightDelimiter string) Templater {
 	}
 }
 
+// WithFuncs returns a copy of the templater which can use the given functions as well,
+// functions with the same name as a default function override the default one
+func (t Templater) WithFuncs(funcs template.FuncMap) Templater {
+	merged := make(template.FuncMap, len(t.funcs)+len(funcs))
+	for name, fn := range t.funcs {
+		merged[name] = fn
+	}
+	for name, fn := range funcs {
+		merged[name] = fn
+	}
+	t.funcs = merged
+
+	return t
+}
+
+// FuncNames returns the sorted names of all functions available in templates:
+// the Sprig functions, the custom functions (awskms, gcpkms, file, blob, accessor) and the extra ones
+func (t Templater) FuncNames() []string {
+	names := []string{}
+	seen := map[string]bool{}
+
+	for _, funcs := range []map[string]interface{}{sprig.TxtFuncMap(), customFuncs(), t.funcs} {
+		for name := range funcs {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
 // EnvTemplate interpolates environment variables in a configuration text
 func (t Templater) EnvTemplate(templateText string) (*bytes.Buffer, error) {
 	var env struct {
@@ -77,13 +113,9 @@ func (t Templater) EnvTemplate(templateText string) (*bytes.Buffer, error) {
 
 // Template interpolates a data structure in a template
 func (t Templater) Template(templateText string, data interface{}) (*bytes.Buffer, error) {
-	configTemplate, err := template.New(templateName).
-		Funcs(sprig.TxtFuncMap()).
-		Funcs(customFuncs()).
-		Delims(t.leftDelimiter, t.rightDelimiter).
-		Parse(templateText)
+	configTemplate, err := t.parse(templateText)
 	if err != nil {
-		return nil, errors.WrapIf(err, "error parsing template")
+		return nil, err
 	}
 
 	buffer := bytes.NewBuffer(nil)
@@ -96,6 +128,27 @@ func (t Templater) Template(templateText string, data interface{}) (*bytes.Buffe
 	return buffer, nil
 }
 
+// Validate checks if a template can be parsed, without executing it
+func (t Templater) Validate(templateText string) error {
+	_, err := t.parse(templateText)
+
+	return err
+}
+
+func (t Templater) parse(templateText string) (*template.Template, error) {
+	configTemplate, err := template.New(templateName).
+		Funcs(sprig.TxtFuncMap()).
+		Funcs(customFuncs()).
+		Funcs(t.funcs).
+		Delims(t.leftDelimiter, t.rightDelimiter).
+		Parse(templateText)
+	if err != nil {
+		return nil, errors.WrapIf(err, "error parsing template")
+	}
+
+	return configTemplate, nil
+}
+
 func customFuncs() template.FuncMap {
 	return funcMap()
 }
@@ -18,26 +18,42 @@ import (
 	"context"
 	"crypto/sha256"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
 	"cloud.google.com/go/compute/metadata"
 	"emperror.dev/errors"
+	"github.com/Masterminds/semver/v3"
 	"github.com/fsnotify/fsnotify"
 	vaultapi "github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/api/auth/approle"
 	"github.com/hashicorp/vault/api/auth/aws"
 	"github.com/hashicorp/vault/api/auth/azure"
 	"github.com/hashicorp/vault/api/auth/gcp"
 	"github.com/hashicorp/vault/api/auth/kubernetes"
+	"github.com/hashicorp/vault/api/auth/ldap"
+	"github.com/spf13/cast"
 )
 
 const (
 	defaultJWTFile       = "/var/run/secrets/kubernetes.io/serviceaccount/token"
 	sessionCacheCapacity = 64
+
+	// credentialSettleTime is waited after a credential file change before logging in again,
+	// so a file which is still being written isn't used
+	credentialSettleTime = 500 * time.Millisecond
 )
 
 // NewData is a helper function for Vault KV Version two secret data creation
@@ -49,16 +65,50 @@ func NewData(cas int, data map[string]interface{}) map[string]interface{} {
 }
 
 type clientOptions struct {
-	url            string
-	role           string
-	authPath       string
-	tokenPath      string
-	token          string
-	timeout        time.Duration
-	logger         Logger
-	authMethod     ClientAuthMethod
-	existingSecret string
-	vaultNamespace string
+	url              string
+	role             string
+	defaultRole      bool
+	authPath         string
+	authPaths        map[ClientAuthMethod]string
+	authChain        []ClientAuthMethod
+	tokenPath        string
+	token            string
+	timeout          time.Duration
+	logger           Logger
+	authMethod       ClientAuthMethod
+	existingSecret   string
+	vaultNamespace   string
+	authNamespace    string
+	loginSecret      *vaultapi.Secret
+	minVersion       string
+	jwtProvider      func(ctx context.Context) (string, error)
+	jwtAudience      string
+	jwtFiles         []string
+	maxRequests      int
+	roleID           string
+	secretID         string
+	roleIDFile       string
+	secretIDFile     string
+	secretIDWrapped  bool
+	username         string
+	password         string
+	passwordFile     string
+	maxLoginAttempts int
+	maxLoginDuration time.Duration
+	transitCacheSize int
+	mountCacheTTL    time.Duration
+	tlsMinVersion    uint16
+	tlsCipherSuites  []uint16
+	asyncAuth        bool
+	idleConnTimeout  time.Duration
+	maxIdleConns     int
+	keepAlive        time.Duration
+	onTokenRenew     func(secret *vaultapi.Secret)
+	maxResponseSize  int64
+	httpClient       *http.Client
+	caCertPEM        []byte
+	proxyURL         string
+	loginMetadata    map[string]string
 }
 
 // ClientOption configures a Vault client using the functional options paradigm popularized by Rob Pike and Dave Cheney.
@@ -90,6 +140,53 @@ func (co ClientAuthPath) apply(o *clientOptions) {
 	o.authPath = string(co)
 }
 
+// ClientAuthPaths are the mount paths of the auth methods, if several of them are enabled
+// (e.g. kubernetes at k8s-prod and approle at approle). ClientAuthPath takes precedence for the auth method of the client.
+type ClientAuthPaths map[ClientAuthMethod]string
+
+func (co ClientAuthPaths) apply(o *clientOptions) {
+	o.authPaths = co
+}
+
+// authPathOf returns the mount path of an auth method, from ClientAuthPaths or the default one.
+func (o *clientOptions) authPathOf(method ClientAuthMethod) string {
+	if path, ok := o.authPaths[method]; ok {
+		return path
+	}
+
+	if method == AppRoleAuthMethod {
+		return "approle"
+	}
+
+	if method == CertAuthMethod {
+		return "cert"
+	}
+
+	if method == LDAPAuthMethod {
+		return "ldap"
+	}
+
+	return "kubernetes"
+}
+
+// authMethods returns the auth methods to log in with, in order.
+func (o *clientOptions) authMethods() []ClientAuthMethod {
+	if len(o.authChain) > 0 {
+		return o.authChain
+	}
+
+	return []ClientAuthMethod{o.authMethod}
+}
+
+// authMethodPath returns the mount path to log in with an auth method at, after the defaults are resolved.
+func (o *clientOptions) authMethodPath(method ClientAuthMethod) string {
+	if method == o.authMethod {
+		return o.authPath
+	}
+
+	return o.authPathOf(method)
+}
+
 // ClientTokenPath file where the Vault token can be found.
 type ClientTokenPath string
 
@@ -131,6 +228,16 @@ func (co ClientAuthMethod) apply(o *clientOptions) {
 	o.authMethod = co
 }
 
+// ClientAuthMethodChain is an ordered list of auth methods to log in with, the first one which succeeds is used,
+// so the same binary works in different environments (e.g. kubernetes in a cluster, approle in CI).
+// It overrides ClientAuthMethod. ClientAuthPath applies to its first method, the paths of the others
+// are taken from ClientAuthPaths, or are the default ones.
+type ClientAuthMethodChain []ClientAuthMethod
+
+func (co ClientAuthMethodChain) apply(o *clientOptions) {
+	o.authChain = co
+}
+
 type ExistingSecret string
 
 func (co ExistingSecret) apply(o *clientOptions) {
@@ -146,6 +253,305 @@ func (co VaultNamespace) apply(o *clientOptions) {
 	o.vaultNamespace = string(co)
 }
 
+// ClientAuthNamespace is the Vault Enterprise Namespace where the auth method is enabled, if it differs
+// from VaultNamespace (e.g. centralized auth with the secrets in team namespaces).
+// It's only used for logging in, all other requests use VaultNamespace.
+type ClientAuthNamespace string
+
+func (co ClientAuthNamespace) apply(o *clientOptions) {
+	o.authNamespace = string(co)
+}
+
+// ClientMinVersion is the minimum Vault server version the client works with (e.g. 1.15.0).
+// Creating the client fails if the server is older than this.
+type ClientMinVersion string
+
+func (co ClientMinVersion) apply(o *clientOptions) {
+	o.minVersion = string(co)
+}
+
+// ClientJWTProvider sets a function which returns the JWT for the JWT/Kubernetes auth methods,
+// instead of reading it from a file. It's called on every login, so rotated tokens are picked up.
+func ClientJWTProvider(provider func(ctx context.Context) (string, error)) clientJWTProvider { //nolint:revive
+	return clientJWTProvider{provider: provider}
+}
+
+type clientJWTProvider struct {
+	provider func(ctx context.Context) (string, error)
+}
+
+func (co clientJWTProvider) apply(o *clientOptions) {
+	o.jwtProvider = co.provider
+}
+
+// ClientJWTAudience selects the JWT for the JWT/Kubernetes auth methods by its audience (aud claim),
+// among the given token files (e.g. multiple projected ServiceAccount tokens), or the default token file if none are given.
+// Use it if the Vault role is bound to an audience which the default ServiceAccount token doesn't have.
+func ClientJWTAudience(audience string, files ...string) clientJWTAudience { //nolint:revive
+	return clientJWTAudience{audience: audience, files: files}
+}
+
+type clientJWTAudience struct {
+	audience string
+	files    []string
+}
+
+func (co clientJWTAudience) apply(o *clientOptions) {
+	o.jwtAudience = co.audience
+	o.jwtFiles = co.files
+}
+
+// ClientMaxConcurrentRequests limits the number of Vault requests the client (and its Transit wrapper)
+// has in flight at the same time, further requests wait for a free slot.
+type ClientMaxConcurrentRequests int
+
+func (co ClientMaxConcurrentRequests) apply(o *clientOptions) {
+	o.maxRequests = int(co)
+}
+
+// ClientTransitCacheSize enables caching the results of Transit.Decrypt, Transit.DecryptBatch and Transit.DecryptBatchOrdered,
+// keeping at most this many of the most recently used plaintexts in memory.
+type ClientTransitCacheSize int
+
+func (co ClientTransitCacheSize) apply(o *clientOptions) {
+	o.transitCacheSize = int(co)
+}
+
+// ClientMountCacheTTL is how long the results of Client.MountInfo are cached, 5 minutes by default.
+// A negative value disables the caching.
+type ClientMountCacheTTL time.Duration
+
+func (co ClientMountCacheTTL) apply(o *clientOptions) {
+	o.mountCacheTTL = time.Duration(co)
+}
+
+// ClientTLSMinVersion is the minimum TLS version of the connection to Vault (tls.VersionTLS12 or tls.VersionTLS13).
+type ClientTLSMinVersion uint16
+
+func (co ClientTLSMinVersion) apply(o *clientOptions) {
+	o.tlsMinVersion = uint16(co)
+}
+
+// ClientTLSCipherSuites restricts the TLS 1.2 cipher suites of the connection to Vault (e.g. tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384).
+// TLS 1.3 cipher suites aren't configurable in Go.
+func ClientTLSCipherSuites(suites ...uint16) clientTLSCipherSuites { //nolint:revive
+	return clientTLSCipherSuites{suites: suites}
+}
+
+type clientTLSCipherSuites struct {
+	suites []uint16
+}
+
+func (co clientTLSCipherSuites) apply(o *clientOptions) {
+	o.tlsCipherSuites = co.suites
+}
+
+// ClientCACertPEM is the PEM encoded CA certificate (or bundle) Vault's certificate is verified with,
+// instead of the CA certificates of the system or VAULT_CACERT, e.g. if the CA certificate is only available in memory.
+// The CA certificate of VAULT_CACERT isn't reloaded if it's set.
+func ClientCACertPEM(pemBytes []byte) clientCACertPEM { //nolint:revive
+	return clientCACertPEM{pem: pemBytes}
+}
+
+type clientCACertPEM struct {
+	pem []byte
+}
+
+func (co clientCACertPEM) apply(o *clientOptions) {
+	o.caCertPEM = co.pem
+}
+
+// ClientIdleConnTimeout is the time after which idle connections to Vault are closed,
+// set it below the idle timeout of firewalls and load balancers between the client and Vault.
+type ClientIdleConnTimeout time.Duration
+
+func (co ClientIdleConnTimeout) apply(o *clientOptions) {
+	o.idleConnTimeout = time.Duration(co)
+}
+
+// ClientMaxIdleConns is the maximum number of idle connections kept open to Vault.
+type ClientMaxIdleConns int
+
+func (co ClientMaxIdleConns) apply(o *clientOptions) {
+	o.maxIdleConns = int(co)
+}
+
+// ClientKeepAlive is the interval of the TCP keep-alive probes on new connections to Vault,
+// a negative value disables them.
+type ClientKeepAlive time.Duration
+
+func (co ClientKeepAlive) apply(o *clientOptions) {
+	o.keepAlive = time.Duration(co)
+}
+
+// ClientMaxResponseSize is the maximum size of the body of a read response in bytes, larger responses
+// fail with a *ResponseTooLargeError without being read into memory. It applies to ReadWithHeaders and
+// the reads of the secret injector, the raw responses of other requests can be limited with LimitResponseSize.
+// It's unlimited by default, but in memory constrained environments a cap well above the largest
+// expected secret (e.g. 1 MiB) is recommended, to guard against a misconfigured path returning a huge response.
+type ClientMaxResponseSize int64
+
+func (co ClientMaxResponseSize) apply(o *clientOptions) {
+	o.maxResponseSize = int64(co)
+}
+
+// ClientHTTPClient is the HTTP client the Vault client sends its requests with (e.g. with a custom transport
+// for a proxy, or tuned connection pooling), instead of the one of the Vault configuration.
+// It only applies to NewClientWithOptions and NewClientFromConfig, the raw client of NewClientFromRawClient has its HTTP client already.
+// The TLS settings of the HTTP client are used as is: the TLS settings of the environment (e.g. VAULT_CACERT)
+// aren't applied to it, and the CA certificate isn't reloaded when it changes.
+func ClientHTTPClient(httpClient *http.Client) clientHTTPClient { //nolint:revive
+	return clientHTTPClient{httpClient: httpClient}
+}
+
+type clientHTTPClient struct {
+	httpClient *http.Client
+}
+
+func (co clientHTTPClient) apply(o *clientOptions) {
+	o.httpClient = co.httpClient
+}
+
+// ClientProxyURL is the URL of the proxy the requests to Vault are sent through,
+// an HTTP(S) proxy (e.g. http://bastion:3128) or a SOCKS5 proxy (e.g. socks5://bastion:1080).
+// If it isn't set, the proxy of the environment is used (HTTPS_PROXY, HTTP_PROXY and NO_PROXY, or VAULT_PROXY_ADDR),
+// if it's set, NO_PROXY doesn't apply.
+type ClientProxyURL string
+
+func (co ClientProxyURL) apply(o *clientOptions) {
+	o.proxyURL = string(co)
+}
+
+// ClientAsyncAuth makes the client creation return right away instead of waiting for the initial login
+// (and failing after ClientTimeout). The client keeps logging in in the background, wait for Authenticated
+// before making requests which need a token.
+type ClientAsyncAuth bool
+
+func (co ClientAsyncAuth) apply(o *clientOptions) {
+	o.asyncAuth = bool(co)
+}
+
+// ClientRoleID is the AppRole role_id.
+type ClientRoleID string
+
+func (co ClientRoleID) apply(o *clientOptions) {
+	o.roleID = string(co)
+}
+
+// ClientSecretID is the AppRole secret_id, prefer ClientSecretIDFile to not keep it in the environment.
+type ClientSecretID string
+
+func (co ClientSecretID) apply(o *clientOptions) {
+	o.secretID = string(co)
+}
+
+// ClientSecretIDWrapped means that the AppRole secret_id is a response wrapping token, which is unwrapped at login.
+// A wrapping token can be unwrapped only once, so for the later logins (e.g. after a failed renewal)
+// it has to come from a ClientSecretIDFile, which is updated with a new token.
+type ClientSecretIDWrapped bool
+
+func (co ClientSecretIDWrapped) apply(o *clientOptions) {
+	o.secretIDWrapped = bool(co)
+}
+
+// ClientRoleIDFile is a file containing the AppRole role_id.
+type ClientRoleIDFile string
+
+func (co ClientRoleIDFile) apply(o *clientOptions) {
+	o.roleIDFile = string(co)
+}
+
+// ClientSecretIDFile is a file containing the AppRole secret_id.
+// The file is watched, and the client logs in again when the secret_id gets rotated.
+type ClientSecretIDFile string
+
+func (co ClientSecretIDFile) apply(o *clientOptions) {
+	o.secretIDFile = string(co)
+}
+
+// ClientUsername is the username of the LDAP auth method.
+type ClientUsername string
+
+func (co ClientUsername) apply(o *clientOptions) {
+	o.username = string(co)
+}
+
+// ClientPassword is the password of the LDAP auth method, prefer ClientPasswordFile to not keep it in the environment.
+type ClientPassword string
+
+func (co ClientPassword) apply(o *clientOptions) {
+	o.password = string(co)
+}
+
+// ClientPasswordFile is a file containing the password of the LDAP auth method, it's read at every login.
+type ClientPasswordFile string
+
+func (co ClientPasswordFile) apply(o *clientOptions) {
+	o.passwordFile = string(co)
+}
+
+// ClientMaxLoginAttempts is the number of consecutive failed login attempts
+// after which the client gives up logging in, and reports the failure on LoginError.
+type ClientMaxLoginAttempts int
+
+func (co ClientMaxLoginAttempts) apply(o *clientOptions) {
+	o.maxLoginAttempts = int(co)
+}
+
+// ClientMaxLoginDuration is the time after the first of consecutive failed login attempts
+// after which the client gives up logging in, and reports the failure on LoginError.
+type ClientMaxLoginDuration time.Duration
+
+func (co ClientMaxLoginDuration) apply(o *clientOptions) {
+	o.maxLoginDuration = time.Duration(co)
+}
+
+// ClientLoginMetadata identifies the workload in the logins of the client (e.g. {"X-Workload-ID": "billing-7f9c"}),
+// so the logins of many workloads sharing the same role (typically of the AWS and GCP auth methods) can be told apart.
+// The auth methods don't accept metadata from the client for the identity alias, so it's sent as HTTP headers
+// of the login requests, which show up in the audit log once they are configured as audited request headers
+// (see https://developer.hashicorp.com/vault/api-docs/system/config-auditing).
+func ClientLoginMetadata(metadata map[string]string) clientLoginMetadata { //nolint:revive
+	return clientLoginMetadata{metadata: metadata}
+}
+
+type clientLoginMetadata struct {
+	metadata map[string]string
+}
+
+func (co clientLoginMetadata) apply(o *clientOptions) {
+	o.loginMetadata = co.metadata
+}
+
+// ClientLoginSecret is a login response obtained outside of the client (e.g. by a separate component).
+// The client takes the token from it and manages its renewal, skipping its own authentication.
+func ClientLoginSecret(secret *vaultapi.Secret) clientLoginSecret { //nolint:revive
+	return clientLoginSecret{secret: secret}
+}
+
+type clientLoginSecret struct {
+	secret *vaultapi.Secret
+}
+
+func (co clientLoginSecret) apply(o *clientOptions) {
+	o.loginSecret = co.secret
+}
+
+// ClientOnTokenRenew sets a function which is called with the login secret when the client gets its initial token,
+// and with the renewed secret on every renewal of it, e.g. to refresh connections using the token.
+// It runs on the renewal goroutine, so it shouldn't block.
+func ClientOnTokenRenew(fn func(secret *vaultapi.Secret)) clientOnTokenRenew { //nolint:revive
+	return clientOnTokenRenew{fn: fn}
+}
+
+type clientOnTokenRenew struct {
+	fn func(secret *vaultapi.Secret)
+}
+
+func (co clientOnTokenRenew) apply(o *clientOptions) {
+	o.onTokenRenew = co.fn
+}
+
 const (
 	// AWSEC2AuthMethod is used for the Vault AWS EC2 auth method
 	// as described here: https://www.vaultproject.io/docs/auth/aws#ec2-auth-method
@@ -177,10 +583,25 @@ const (
 
 	// NamespacedSecretAuthMethod is used for per namespace secrets
 	NamespacedSecretAuthMethod ClientAuthMethod = "namespaced"
+
+	// AppRoleAuthMethod is used for the Vault AppRole auth method
+	// as described here: https://www.vaultproject.io/docs/auth/approle
+	AppRoleAuthMethod ClientAuthMethod = "approle"
+
+	// CertAuthMethod is used for the Vault TLS certificates auth method, with the client certificate
+	// configured in the TLS settings of the client (e.g. VAULT_CLIENT_CERT and VAULT_CLIENT_KEY)
+	// as described here: https://developer.hashicorp.com/vault/docs/auth/cert
+	CertAuthMethod ClientAuthMethod = "cert"
+
+	// LDAPAuthMethod is used for the Vault LDAP auth method, with ClientUsername and ClientPassword (or ClientPasswordFile)
+	// as described here: https://developer.hashicorp.com/vault/docs/auth/ldap
+	LDAPAuthMethod ClientAuthMethod = "ldap"
 )
 
 // Client is a Vault client with Kubernetes support, token automatic renewing and
-// access to Transit Secret Engine wrapper
+// access to Transit Secret Engine wrapper.
+// It's safe for concurrent use, so one client (and its connection pool) can be shared by many users,
+// e.g. by the SecretInjectors of a server.
 type Client struct {
 	// Easy to use wrapper for transit secret engine calls
 	Transit *Transit
@@ -190,8 +611,79 @@ type Client struct {
 	tokenWatcher *vaultapi.Renewer
 	closed       bool
 	watch        *fsnotify.Watcher
+	credWatch    *fsnotify.Watcher
 	mu           sync.Mutex
 	logger       Logger
+	limiter      requestLimiter
+	loginErr     chan error
+	mounts       *mountCache
+
+	authenticated     chan struct{}
+	authenticatedOnce sync.Once
+
+	tokenChangeHandlers []func(token string)
+	onTokenRenew        func(secret *vaultapi.Secret)
+	maxResponseSize     int64
+
+	statsMu      sync.Mutex
+	renewalStats RenewalStats
+
+	// config is the part of EffectiveConfig resolved at creation
+	config ClientConfigSnapshot
+}
+
+// ClientConfigSnapshot is the effective configuration of a client, without secret material,
+// e.g. to log where and how the client connects at startup.
+type ClientConfigSnapshot struct {
+	// Address is the URL of Vault.
+	Address string
+	// Namespace is the Vault Enterprise namespace of the requests, empty if none.
+	Namespace string
+	// AuthMethod, AuthPath, AuthNamespace and Role are used for logging in,
+	// they are only relevant if TokenSource is "login".
+	AuthMethod    ClientAuthMethod
+	AuthPath      string
+	AuthNamespace string
+	Role          string
+	// TokenSource is where the token of the client comes from:
+	// "token" (ClientToken or VAULT_TOKEN), "login-secret", "token-file" or "login".
+	TokenSource string
+	// TokenPath is the token file which was looked up.
+	TokenPath string
+	// Timeout is the time to wait for a token, RequestTimeout is the timeout of the requests to Vault.
+	Timeout        time.Duration
+	RequestTimeout time.Duration
+	// TLSVerify is false if the verification of the certificate of Vault is disabled (e.g. with VAULT_SKIP_VERIFY).
+	TLSVerify bool
+}
+
+// Fields returns the snapshot as log fields, to be logged in one line.
+func (c ClientConfigSnapshot) Fields() map[string]interface{} {
+	return map[string]interface{}{
+		"address":         c.Address,
+		"namespace":       c.Namespace,
+		"auth-method":     c.AuthMethod,
+		"auth-path":       c.AuthPath,
+		"auth-namespace":  c.AuthNamespace,
+		"role":            c.Role,
+		"token-source":    c.TokenSource,
+		"token-path":      c.TokenPath,
+		"timeout":         c.Timeout,
+		"request-timeout": c.RequestTimeout,
+		"tls-verify":      c.TLSVerify,
+	}
+}
+
+// RenewalStats are the statistics of the renewals of the token managed by the client since its creation.
+type RenewalStats struct {
+	// Renewals is the number of successful renewals.
+	Renewals int
+	// Failures is the number of renewals which failed, each of them is followed by a new login.
+	Failures int
+	// LastRenewal is the time of the last successful renewal, zero if there was none.
+	LastRenewal time.Time
+	// LastTTL is the TTL of the token after the last successful renewal.
+	LastTTL time.Duration
 }
 
 // NewClient creates a new Vault client.
@@ -215,19 +707,38 @@ func NewClientWithConfig(config *vaultapi.Config, role, path string) (*Client, e
 }
 
 // NewClientFromConfig creates a new Vault client from custom configuration.
+// The client is created from a copy of the configuration and its HTTP client (and of the HTTP client of ClientHTTPClient),
+// so the TLS, proxy and connection options don't change the configuration and the HTTP client of the caller.
 func NewClientFromConfig(config *vaultapi.Config, opts ...ClientOption) (*Client, error) {
+	return NewClientFromConfigWithContext(context.Background(), config, opts...)
+}
+
+// NewClientFromConfigWithContext works like NewClientFromConfig, but stops waiting for the initial token once ctx is done.
+func NewClientFromConfigWithContext(ctx context.Context, config *vaultapi.Config, opts ...ClientOption) (*Client, error) {
+	o := &clientOptions{}
+	for _, opt := range opts {
+		opt.apply(o)
+	}
+
+	config, err := copyConfig(config, o.httpClient)
+	if err != nil {
+		return nil, err
+	}
+
 	rawClient, err := vaultapi.NewClient(config)
 	if err != nil {
 		return nil, err
 	}
 
-	client, err := NewClientFromRawClient(rawClient, opts...)
+	client, err := NewClientFromRawClientWithContext(ctx, rawClient, opts...)
 	if err != nil {
 		return nil, err
 	}
 
 	caCertPath := os.Getenv(vaultapi.EnvVaultCACert)
-	caCertReload := os.Getenv("VAULT_CACERT_RELOAD") != "false"
+	// the TLS settings of a custom HTTP client are never reloaded from the environment,
+	// neither is the CA certificate if it's given as PEM
+	caCertReload := os.Getenv("VAULT_CACERT_RELOAD") != "false" && o.httpClient == nil && o.caCertPEM == nil
 
 	if caCertPath != "" && caCertReload {
 		watch, err := fsnotify.NewWatcher()
@@ -274,17 +785,57 @@ func NewClientFromConfig(config *vaultapi.Config, opts ...ClientOption) (*Client
 	return client, nil
 }
 
+// copyConfig returns a copy of config, with a copy of the custom HTTP client if defined, or of the one of config,
+// and a copy of its transport, so they can be configured without affecting the ones of the caller.
+func copyConfig(config *vaultapi.Config, httpClient *http.Client) (*vaultapi.Config, error) {
+	source, err := vaultapi.NewClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	copied := source.CloneConfig()
+	if config != nil {
+		// the fields CloneConfig doesn't copy
+		copied.OutputCurlString = config.OutputCurlString
+		copied.OutputPolicy = config.OutputPolicy
+		copied.CloneTLSConfig = config.CloneTLSConfig
+		copied.DisableRedirects = config.DisableRedirects
+	}
+
+	if httpClient != nil {
+		httpClient := *httpClient
+		copied.HttpClient = &httpClient
+	}
+
+	if transport, ok := copied.HttpClient.Transport.(*http.Transport); ok {
+		copied.HttpClient.Transport = transport.Clone()
+	}
+
+	return copied, nil
+}
+
 // NewClientFromRawClient creates a new Vault client from custom raw client.
 func NewClientFromRawClient(rawClient *vaultapi.Client, opts ...ClientOption) (*Client, error) {
+	return NewClientFromRawClientWithContext(context.Background(), rawClient, opts...)
+}
+
+// NewClientFromRawClientWithContext works like NewClientFromRawClient, but stops waiting for the server version check
+// (ClientMinVersion) and the initial token once ctx is done (e.g. on shutdown during startup), closing the client
+// and returning the error of ctx.
+// The context isn't used after the client is created.
+func NewClientFromRawClientWithContext(ctx context.Context, rawClient *vaultapi.Client, opts ...ClientOption) (*Client, error) {
 	logical := rawClient.Logical()
 	transit := &Transit{
 		client: rawClient,
 	}
 	client := &Client{
-		Transit: transit,
-		client:  rawClient,
-		logical: logical,
-		logger:  noopLogger{},
+		Transit:  transit,
+		client:   rawClient,
+		logical:  logical,
+		logger:   noopLogger{},
+		loginErr: make(chan error, 1),
+
+		authenticated: make(chan struct{}),
 	}
 
 	var tokenWatcher *vaultapi.Renewer
@@ -300,6 +851,55 @@ func NewClientFromRawClient(rawClient *vaultapi.Client, opts ...ClientOption) (*
 		client.logger = o.logger
 	}
 
+	client.onTokenRenew = o.onTokenRenew
+
+	// Limit concurrent requests if defined
+	if o.maxRequests > 0 {
+		client.limiter = make(requestLimiter, o.maxRequests)
+		transit.limiter = client.limiter
+	}
+
+	// Cache transit decryption results if defined
+	if o.transitCacheSize > 0 {
+		transit.cache = newTransitCache(o.transitCacheSize)
+	}
+
+	client.mounts = newMountCache(o.mountCacheTTL)
+
+	// Harden TLS if defined
+	if o.tlsMinVersion != 0 || len(o.tlsCipherSuites) > 0 {
+		if err := configureTLS(rawClient, o); err != nil {
+			return nil, err
+		}
+	}
+
+	// Trust the CA certificate if defined
+	if o.caCertPEM != nil {
+		if err := configureCACert(rawClient, o.caCertPEM); err != nil {
+			return nil, err
+		}
+	}
+
+	// Use the proxy if defined
+	if o.proxyURL != "" {
+		if err := configureProxy(rawClient, o.proxyURL); err != nil {
+			return nil, err
+		}
+	}
+
+	// Tune connections if defined
+	if o.idleConnTimeout != 0 || o.maxIdleConns != 0 || o.keepAlive != 0 {
+		if err := configureConnections(rawClient, o); err != nil {
+			return nil, err
+		}
+	}
+
+	// Limit the response size if defined
+	if o.maxResponseSize < 0 {
+		return nil, errors.New("maximum response size can't be negative")
+	}
+	client.maxResponseSize = o.maxResponseSize
+
 	// Set URL if defined
 	if o.url != "" {
 		err := rawClient.SetAddress(o.url)
@@ -311,17 +911,22 @@ func NewClientFromRawClient(rawClient *vaultapi.Client, opts ...ClientOption) (*
 	// Default role
 	if o.role == "" {
 		o.role = "default"
+		o.defaultRole = true
 	}
 
-	// Default auth path
-	if o.authPath == "" {
-		o.authPath = "kubernetes"
+	if len(o.authChain) > 0 {
+		o.authMethod = o.authChain[0]
 	}
 
 	if o.authMethod == "" {
 		o.authMethod = JWTAuthMethod
 	}
 
+	// Default auth path
+	if o.authPath == "" {
+		o.authPath = o.authPathOf(o.authMethod)
+	}
+
 	// Default token path
 	if o.tokenPath == "" {
 		o.tokenPath = os.Getenv("HOME") + "/.vault-token"
@@ -346,14 +951,60 @@ func NewClientFromRawClient(rawClient *vaultapi.Client, opts ...ClientOption) (*
 		}
 	}
 
+	// Validate the server version if a minimum is defined
+	if o.minVersion != "" {
+		versionCtx, cancel := context.WithTimeout(ctx, o.timeout)
+		err := client.checkServerVersion(versionCtx, o.minVersion)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	client.config = ClientConfigSnapshot{
+		AuthMethod:    o.authMethod,
+		AuthPath:      o.authPath,
+		AuthNamespace: o.authNamespace,
+		Role:          o.role,
+		TokenSource:   "token",
+		TokenPath:     o.tokenPath,
+		Timeout:       o.timeout,
+	}
+
 	// Add token if set
 	if o.token != "" {
 		rawClient.SetToken(o.token)
+	} else if o.loginSecret != nil {
+		if o.loginSecret.Auth == nil || o.loginSecret.Auth.ClientToken == "" {
+			return nil, errors.New("login secret doesn't contain a Vault token")
+		}
+
+		client.config.TokenSource = "login-secret"
+		rawClient.SetToken(o.loginSecret.Auth.ClientToken)
+
+		var err error
+		tokenWatcher, err = rawClient.NewLifetimeWatcher(&vaultapi.LifetimeWatcherInput{Secret: o.loginSecret})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to watch Vault token")
+		}
+
+		client.tokenWatcher = tokenWatcher
+
+		go tokenWatcher.Start()
+
+		go func() {
+			client.tokenRenewed(o.loginSecret)
+			client.runRenewChecker(tokenWatcher)
+			client.logger.Info("Vault token renewal closed")
+		}()
 	} else if rawClient.Token() == "" {
 		token, err := os.ReadFile(o.tokenPath)
 		if err == nil {
+			client.config.TokenSource = "token-file"
 			rawClient.SetToken(string(token))
 		} else {
+			client.config.TokenSource = "login"
+
 			// If VAULT_TOKEN, VAULT_TOKEN_PATH or ~/.vault-token wasn't provided,
 			// attempt to get one with supported JWT-based authentication methods
 			// (such as Kubernetes ServiceAccount JWT).
@@ -365,10 +1016,41 @@ func NewClientFromRawClient(rawClient *vaultapi.Client, opts ...ClientOption) (*
 				jwtFile = file
 			}
 
-			initialTokenArrived := make(chan string, 1)
-			initialTokenSent := false
+			if slices.Contains(o.authMethods(), AppRoleAuthMethod) && o.secretIDFile != "" {
+				if err := client.watchCredentialFiles(o.secretIDFile, o.roleIDFile); err != nil {
+					return nil, errors.Wrap(err, "failed to watch AppRole credential files")
+				}
+			}
 
 			go func() {
+				var failedAttempts int
+				var firstFailure time.Time
+
+				// giveUp records a failed login attempt, and reports whether the configured bounds are exceeded
+				giveUp := func(err error) bool {
+					if failedAttempts == 0 {
+						firstFailure = time.Now()
+					}
+					failedAttempts++
+
+					if (o.maxLoginAttempts > 0 && failedAttempts >= o.maxLoginAttempts) ||
+						(o.maxLoginDuration > 0 && time.Since(firstFailure) >= o.maxLoginDuration) {
+						err = errors.WithMessagef(err, "giving up logging in to Vault after %d attempt(s) in %s", failedAttempts, time.Since(firstFailure).Round(time.Second))
+						client.logger.Error("failed to log in to Vault permanently", map[string]interface{}{"err": err})
+
+						select {
+						case client.loginErr <- err:
+						default:
+						}
+
+						return true
+					}
+
+					time.Sleep(1 * time.Second)
+
+					return false
+				}
+
 				for {
 					client.mu.Lock()
 					if client.closed {
@@ -377,32 +1059,39 @@ func NewClientFromRawClient(rawClient *vaultapi.Client, opts ...ClientOption) (*
 					}
 					client.mu.Unlock()
 
-					secret, err := client.getVaultAPISecret(jwtFile, o)
+					release, _ := client.Acquire(context.Background())
+					secret, method, err := client.getVaultAPISecret(jwtFile, o)
+					release()
 					if err != nil {
 						client.logger.Error("failed to request new Vault token", map[string]interface{}{"err": err})
-						time.Sleep(1 * time.Second)
+						if giveUp(err) {
+							break
+						}
 						continue
 					}
 
 					if secret == nil {
 						client.logger.Debug("received empty answer from Vault, retrying")
-						time.Sleep(1 * time.Second)
+						if giveUp(errors.New("received empty answer from Vault")) {
+							break
+						}
 						continue
 					}
 
+					failedAttempts = 0
+
 					client.logger.Info("received new Vault token", map[string]interface{}{
-						"addr": o.url,
-						"role": o.role,
-						"path": o.authPath,
+						"addr":   o.url,
+						"role":   o.role,
+						"method": method,
+						"path":   o.authMethodPath(method),
 					})
 
 					// Set the first token from the response
 					rawClient.SetToken(secret.Auth.ClientToken)
+					client.notifyTokenChange()
 
-					if !initialTokenSent {
-						initialTokenArrived <- secret.LeaseID
-						initialTokenSent = true
-					}
+					client.markAuthenticated()
 
 					// Start the renewing process
 					tokenWatcher, err = rawClient.NewLifetimeWatcher(&vaultapi.LifetimeWatcherInput{Secret: secret})
@@ -417,56 +1106,263 @@ func NewClientFromRawClient(rawClient *vaultapi.Client, opts ...ClientOption) (*
 
 					go tokenWatcher.Start()
 
+					client.tokenRenewed(secret)
 					client.runRenewChecker(tokenWatcher)
 				}
 
 				client.logger.Info("Vault token renewal closed")
 			}()
 
+			if o.asyncAuth {
+				return client, nil
+			}
+
 			select {
-			case <-initialTokenArrived:
+			case <-client.authenticated:
 				client.logger.Info("initial Vault token arrived")
 
+			case err := <-client.loginErr:
+				client.Close()
+				return nil, err
+
 			case <-time.After(o.timeout):
 				client.Close()
 				return nil, errors.Errorf("timeout [%s] during waiting for Vault token", o.timeout)
+
+			case <-ctx.Done():
+				client.Close()
+				return nil, errors.Wrap(ctx.Err(), "cancelled during waiting for Vault token")
 			}
+
+			return client, nil
 		}
 	}
 
+	client.markAuthenticated()
+
 	return client, nil
 }
 
-func (client *Client) getVaultAPISecret(jwtFile string, o *clientOptions) (*vaultapi.Secret, error) {
-	switch o.authMethod { //nolint:exhaustive
-	case AWSEC2AuthMethod:
-		jwt, err := os.ReadFile(jwtFile)
+// configureTLS validates and sets the TLS minimum version and cipher suites on the transport of the raw client.
+func configureTLS(rawClient *vaultapi.Client, o *clientOptions) error {
+	if o.tlsMinVersion != 0 && o.tlsMinVersion != tls.VersionTLS12 && o.tlsMinVersion != tls.VersionTLS13 {
+		return errors.Errorf("unsupported TLS minimum version %s, use TLS 1.2 or TLS 1.3", tls.VersionName(o.tlsMinVersion))
+	}
+
+	if len(o.tlsCipherSuites) > 0 && o.tlsMinVersion == tls.VersionTLS13 {
+		return errors.New("TLS cipher suites can't be configured with TLS 1.3 as the minimum version")
+	}
+
+	secureSuites := map[uint16]bool{}
+	for _, suite := range tls.CipherSuites() {
+		for _, version := range suite.SupportedVersions {
+			if version == tls.VersionTLS12 {
+				secureSuites[suite.ID] = true
+			}
+		}
+	}
+
+	for _, suite := range o.tlsCipherSuites {
+		if !secureSuites[suite] {
+			return errors.Errorf("unsupported or insecure TLS 1.2 cipher suite: %s", tls.CipherSuiteName(suite))
+		}
+	}
+
+	transport, err := rawTransport(rawClient)
+	if err != nil {
+		return err
+	}
+
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	if o.tlsMinVersion != 0 {
+		transport.TLSClientConfig.MinVersion = o.tlsMinVersion
+	}
+
+	if len(o.tlsCipherSuites) > 0 {
+		transport.TLSClientConfig.CipherSuites = o.tlsCipherSuites
+	}
+
+	return nil
+}
+
+// configureConnections sets the connection pooling and keep-alive settings on the transport of the raw client.
+func configureConnections(rawClient *vaultapi.Client, o *clientOptions) error {
+	if o.idleConnTimeout < 0 || o.maxIdleConns < 0 {
+		return errors.New("idle connection timeout and maximum idle connections can't be negative")
+	}
+
+	transport, err := rawTransport(rawClient)
+	if err != nil {
+		return err
+	}
+
+	if o.idleConnTimeout != 0 {
+		transport.IdleConnTimeout = o.idleConnTimeout
+	}
+
+	if o.maxIdleConns != 0 {
+		transport.MaxIdleConns = o.maxIdleConns
+		transport.MaxIdleConnsPerHost = o.maxIdleConns
+	}
+
+	if o.keepAlive != 0 {
+		transport.DialContext = (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: o.keepAlive,
+		}).DialContext
+	}
+
+	return nil
+}
+
+// configureCACert sets the CA certificates of the PEM as the root CAs on the transport of the raw client.
+func configureCACert(rawClient *vaultapi.Client, pemBytes []byte) error {
+	pool := x509.NewCertPool()
+	certs := 0
+
+	for block, rest := pem.Decode(pemBytes); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return errors.Wrapf(err, "failed to parse certificate %d of the CA certificate PEM", certs+1)
+		}
+
+		pool.AddCert(cert)
+		certs++
+	}
+
+	if certs == 0 {
+		return errors.New("CA certificate PEM doesn't contain any certificates")
+	}
+
+	transport, err := rawTransport(rawClient)
+	if err != nil {
+		return err
+	}
+
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	transport.TLSClientConfig.RootCAs = pool
+
+	return nil
+}
+
+// configureProxy sends the requests of the raw client through the proxy.
+func configureProxy(rawClient *vaultapi.Client, proxyURL string) error {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return errors.Wrap(err, "invalid proxy URL")
+	}
+
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return errors.Errorf("unsupported proxy scheme %q, use http, https or socks5", u.Scheme)
+	}
+
+	if u.Host == "" {
+		return errors.Errorf("proxy URL has no host: %s", proxyURL)
+	}
+
+	transport, err := rawTransport(rawClient)
+	if err != nil {
+		return err
+	}
+
+	transport.Proxy = http.ProxyURL(u)
+
+	return nil
+}
+
+// rawTransport returns the transport of the raw client, which is shared with the client's configuration.
+func rawTransport(rawClient *vaultapi.Client) (*http.Transport, error) {
+	transport, ok := rawClient.CloneConfig().HttpClient.Transport.(*http.Transport)
+	if !ok {
+		return nil, errors.New("transport settings require an *http.Transport in the Vault client")
+	}
+
+	return transport, nil
+}
+
+// getVaultAPISecret logs in with the auth methods in order, and returns the secret of the first one which succeeds.
+func (client *Client) getVaultAPISecret(jwtFile string, o *clientOptions) (*vaultapi.Secret, ClientAuthMethod, error) {
+	methods := o.authMethods()
+
+	var errs []error
+	for _, method := range methods {
+		secret, err := client.login(jwtFile, method, o.authMethodPath(method), o)
+		if len(methods) == 1 || (err == nil && secret != nil) {
+			return secret, method, err
+		}
+
+		if err == nil {
+			err = errors.New("received empty answer from Vault")
+		}
+
+		client.logger.Debug("failed to log in with auth method, trying the next one", map[string]interface{}{"method": method, "err": err})
+		errs = append(errs, errors.WithMessagef(err, "auth method %s", method))
+	}
+
+	return nil, "", errors.WithMessage(errors.Combine(errs...), "all auth methods failed")
+}
+
+// login logs in with an auth method mounted at path.
+func (client *Client) login(jwtFile string, method ClientAuthMethod, path string, o *clientOptions) (*vaultapi.Secret, error) {
+	loginClient := client.RawClient()
+	if o.authNamespace != "" {
+		loginClient = loginClient.WithNamespace(o.authNamespace)
+	}
+
+	if len(o.loginMetadata) > 0 {
+		clone, err := loginClient.CloneWithHeaders()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to clone Vault client for login")
+		}
+
+		for name, value := range o.loginMetadata {
+			clone.AddHeader(name, value)
+		}
+
+		loginClient = clone
+	}
+
+	switch method { //nolint:exhaustive
+	case AWSEC2AuthMethod:
+		jwt, err := os.ReadFile(jwtFile)
 		if err != nil {
 			return nil, err
 		}
 		nonce := fmt.Sprintf("%x", sha256.Sum256(jwt))
 
-		awsAuth, err := aws.NewAWSAuth(aws.WithRole(o.role), aws.WithMountPath(o.authPath), aws.WithEC2Auth(), aws.WithPKCS7Signature(), aws.WithNonce(nonce))
+		awsAuth, err := aws.NewAWSAuth(aws.WithRole(o.role), aws.WithMountPath(path), aws.WithEC2Auth(), aws.WithPKCS7Signature(), aws.WithNonce(nonce))
 		if err != nil {
 			return nil, err
 		}
 
-		return awsAuth.Login(context.Background(), client.RawClient())
+		return awsAuth.Login(context.Background(), loginClient)
 
 	case AWSIAMAuthMethod:
-		awsAuth, err := aws.NewAWSAuth(aws.WithRole(o.role), aws.WithMountPath(o.authPath), aws.WithIAMAuth())
+		awsAuth, err := aws.NewAWSAuth(aws.WithRole(o.role), aws.WithMountPath(path), aws.WithIAMAuth())
 		if err != nil {
 			return nil, err
 		}
 
-		return awsAuth.Login(context.Background(), client.RawClient())
+		return awsAuth.Login(context.Background(), loginClient)
 
 	case GCPGCEAuthMethod:
-		gcpAuth, err := gcp.NewGCPAuth(o.role, gcp.WithGCEAuth(), gcp.WithMountPath(o.authPath))
+		gcpAuth, err := gcp.NewGCPAuth(o.role, gcp.WithGCEAuth(), gcp.WithMountPath(path))
 		if err != nil {
 			return nil, err
 		}
-		return gcpAuth.Login(context.Background(), client.RawClient())
+		return gcpAuth.Login(context.Background(), loginClient)
 
 	case GCPIAMAuthMethod:
 		serviceAccountEmail, err := metadata.EmailWithContext(context.Background(), "default")
@@ -474,41 +1370,275 @@ func (client *Client) getVaultAPISecret(jwtFile string, o *clientOptions) (*vaul
 			return nil, err
 		}
 
-		gcpAuth, err := gcp.NewGCPAuth(o.role, gcp.WithIAMAuth(serviceAccountEmail), gcp.WithMountPath(o.authPath))
+		gcpAuth, err := gcp.NewGCPAuth(o.role, gcp.WithIAMAuth(serviceAccountEmail), gcp.WithMountPath(path))
 		if err != nil {
 			return nil, err
 		}
-		return gcpAuth.Login(context.Background(), client.RawClient())
+		return gcpAuth.Login(context.Background(), loginClient)
 
 	case AzureMSIAuthMethod:
-		azureAuth, err := azure.NewAzureAuth(o.role, azure.WithMountPath(o.authPath))
+		azureAuth, err := azure.NewAzureAuth(o.role, azure.WithMountPath(path))
+		if err != nil {
+			return nil, err
+		}
+		return azureAuth.Login(context.Background(), loginClient)
+
+	case AppRoleAuthMethod:
+		if (o.roleID == "" && o.roleIDFile == "") || (o.secretID == "" && o.secretIDFile == "") {
+			return nil, errors.New("AppRole auth method requires a role_id and a secret_id, or files containing them")
+		}
+
+		roleID, err := credential(o.roleID, o.roleIDFile)
+		if err != nil {
+			return nil, err
+		}
+
+		secretID, err := credential(o.secretID, o.secretIDFile)
+		if err != nil {
+			return nil, err
+		}
+
+		loginOptions := []approle.LoginOption{approle.WithMountPath(path)}
+		if o.secretIDWrapped {
+			loginOptions = append(loginOptions, approle.WithWrappingToken())
+		}
+
+		appRoleAuth, err := approle.NewAppRoleAuth(roleID, &approle.SecretID{FromString: secretID}, loginOptions...)
 		if err != nil {
 			return nil, err
 		}
-		return azureAuth.Login(context.Background(), client.RawClient())
+		return appRoleAuth.Login(context.Background(), loginClient)
+
+	case CertAuthMethod:
+		transport, err := rawTransport(loginClient)
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConfig := transport.TLSClientConfig
+		if tlsConfig == nil || (len(tlsConfig.Certificates) == 0 && tlsConfig.GetClientCertificate == nil) {
+			return nil, errors.New("cert auth method requires a client certificate in the TLS configuration")
+		}
+
+		// the role is optional, Vault tries all roles matching the certificate without it
+		data := map[string]interface{}{}
+		if !o.defaultRole {
+			data["name"] = o.role
+		}
+
+		return loginClient.Logical().Write("auth/"+path+"/login", data)
+
+	case LDAPAuthMethod:
+		if o.username == "" || (o.password == "" && o.passwordFile == "") {
+			return nil, errors.New("LDAP auth method requires a username and a password, or a file containing it")
+		}
+
+		password := &ldap.Password{FromString: o.password}
+		if o.password == "" {
+			password = &ldap.Password{FromFile: o.passwordFile}
+		}
+
+		ldapAuth, err := ldap.NewLDAPAuth(o.username, password, ldap.WithMountPath(path))
+		if err != nil {
+			return nil, err
+		}
+		return ldapAuth.Login(context.Background(), loginClient)
 
 	case NamespacedSecretAuthMethod:
 		if len(o.existingSecret) > 0 {
-			kubernetesAuth, err := kubernetes.NewKubernetesAuth(o.role, kubernetes.WithServiceAccountToken(o.existingSecret), kubernetes.WithMountPath(o.authPath))
+			kubernetesAuth, err := kubernetes.NewKubernetesAuth(o.role, kubernetes.WithServiceAccountToken(o.existingSecret), kubernetes.WithMountPath(path))
 			if err != nil {
 				return nil, err
 			}
-			return kubernetesAuth.Login(context.Background(), client.RawClient())
+			return kubernetesAuth.Login(context.Background(), loginClient)
 		}
 		fallthrough
 
 	// 'jwt' or 'kubernetes', ends up doing JWT as it also works for Kubernetes
 	default:
-		jwt, err := os.ReadFile(jwtFile)
+		jwt, err := readJWT(context.Background(), jwtFile, o)
 		if err != nil {
 			return nil, err
 		}
 
-		kubernetesAuth, err := kubernetes.NewKubernetesAuth(o.role, kubernetes.WithServiceAccountToken(string(jwt)), kubernetes.WithMountPath(o.authPath))
+		kubernetesAuth, err := kubernetes.NewKubernetesAuth(o.role, kubernetes.WithServiceAccountToken(jwt), kubernetes.WithMountPath(path))
 		if err != nil {
 			return nil, err
 		}
-		return kubernetesAuth.Login(context.Background(), client.RawClient())
+		return kubernetesAuth.Login(context.Background(), loginClient)
+	}
+}
+
+// credential returns the value of a credential option, or reads it from its file option if it's empty.
+func credential(value, file string) (string, error) {
+	if value != "" {
+		return value, nil
+	}
+
+	return readCredentialFile(file)
+}
+
+// readCredentialFile reads a credential from a file, an empty file is an error,
+// since it's most likely in the middle of being rotated.
+func readCredentialFile(file string) (string, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+
+	credential := strings.TrimSpace(string(content))
+	if credential == "" {
+		return "", errors.Errorf("credential file is empty: %s", file)
+	}
+
+	return credential, nil
+}
+
+// watchCredentialFiles makes the client log in again when one of the files changes.
+func (client *Client) watchCredentialFiles(files ...string) error {
+	watch, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	watched := map[string]bool{}
+	for _, file := range files {
+		if file == "" {
+			continue
+		}
+
+		file = filepath.Clean(file)
+		watched[file] = true
+
+		dir, _ := filepath.Split(file)
+		_ = watch.Add(dir)
+	}
+
+	client.mu.Lock()
+	client.credWatch = watch
+	client.mu.Unlock()
+
+	go func() {
+		var relogin *time.Timer
+
+		for {
+			select {
+			case event, ok := <-watch.Events:
+				if !ok {
+					return
+				}
+
+				// we only care about the credential files or the Secret mount directory (if in Kubernetes)
+				if watched[filepath.Clean(event.Name)] || filepath.Base(event.Name) == "..data" {
+					if event.Op&fsnotify.Write == fsnotify.Write || event.Op&fsnotify.Create == fsnotify.Create {
+						// wait for the writes to settle before logging in with the new credentials
+						if relogin != nil {
+							relogin.Stop()
+						}
+						relogin = time.AfterFunc(credentialSettleTime, client.relogin)
+					}
+				}
+			case err, ok := <-watch.Errors:
+				if !ok {
+					return
+				}
+				client.logger.Error("watcher error", map[string]interface{}{"err": err})
+			}
+		}
+	}()
+
+	return nil
+}
+
+// relogin stops the renewal of the current token, so the token goroutine logs in again.
+func (client *Client) relogin() {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	if client.closed || client.tokenWatcher == nil {
+		return
+	}
+
+	client.logger.Info("credentials changed, logging in to Vault again")
+	client.tokenWatcher.Stop()
+}
+
+// readJWT returns the JWT from the configured provider, or from jwtFile if there is none.
+func readJWT(ctx context.Context, jwtFile string, o *clientOptions) (string, error) {
+	if o.jwtProvider != nil {
+		jwt, err := o.jwtProvider(ctx)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to get JWT from provider")
+		}
+
+		return jwt, nil
+	}
+
+	if o.jwtAudience != "" {
+		files := o.jwtFiles
+		if len(files) == 0 {
+			files = []string{jwtFile}
+		}
+
+		return readJWTWithAudience(files, o.jwtAudience)
+	}
+
+	jwt, err := os.ReadFile(jwtFile)
+	if err != nil {
+		return "", err
+	}
+
+	return string(jwt), nil
+}
+
+// readJWTWithAudience returns the first JWT from the files whose aud claim contains the audience.
+// The JWTs aren't verified, Vault does that on login.
+func readJWTWithAudience(files []string, audience string) (string, error) {
+	for _, file := range files {
+		jwt, err := os.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+
+		audiences, err := jwtAudiences(strings.TrimSpace(string(jwt)))
+		if err != nil {
+			return "", errors.WithMessagef(err, "JWT file: %s", file)
+		}
+
+		if slices.Contains(audiences, audience) {
+			return string(jwt), nil
+		}
+	}
+
+	return "", errors.Errorf("no JWT with audience '%s' found in: %s", audience, strings.Join(files, ", "))
+}
+
+// jwtAudiences returns the aud claim of a JWT, which is either a string or a list of strings.
+func jwtAudiences(jwt string) ([]string, error) {
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed JWT")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode JWT payload")
+	}
+
+	var claims struct {
+		Audience interface{} `json:"aud"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal JWT claims")
+	}
+
+	switch aud := claims.Audience.(type) {
+	case string:
+		return []string{aud}, nil
+	case []interface{}:
+		return cast.ToStringSlice(aud), nil
+	default:
+		return nil, nil
 	}
 }
 
@@ -518,15 +1648,205 @@ func (client *Client) runRenewChecker(tokenWatcher *vaultapi.Renewer) {
 		case err := <-tokenWatcher.DoneCh():
 			if err != nil {
 				client.logger.Error("error in Vault token renewal", map[string]interface{}{"err": err})
+				client.recordRenewalFailure()
 			}
 			return
 		case o := <-tokenWatcher.RenewCh():
 			ttl, _ := o.Secret.TokenTTL()
 			client.logger.Info("renewed Vault token", map[string]interface{}{"ttl": ttl})
+			client.recordRenewal(o.RenewedAt, ttl)
+			client.notifyTokenChange()
+			client.tokenRenewed(o.Secret)
 		}
 	}
 }
 
+// tokenRenewed calls the ClientOnTokenRenew callback, it must be called without holding client.mu,
+// as the callback may call the client.
+func (client *Client) tokenRenewed(secret *vaultapi.Secret) {
+	if client.onTokenRenew != nil {
+		client.onTokenRenew(secret)
+	}
+}
+
+// EffectiveConfig returns the effective configuration of the client, after the defaults and
+// the environment are applied. It never contains the token or other credentials.
+func (client *Client) EffectiveConfig() ClientConfigSnapshot {
+	config := client.config
+	config.Address = client.client.Address()
+	config.Namespace = client.client.Namespace()
+	config.RequestTimeout = client.client.ClientTimeout()
+
+	config.TLSVerify = true
+	if transport, err := rawTransport(client.client); err == nil && transport.TLSClientConfig != nil {
+		config.TLSVerify = !transport.TLSClientConfig.InsecureSkipVerify
+	}
+
+	return config
+}
+
+// RenewalStats returns the statistics of the token renewals, e.g. to report the token health on a status endpoint.
+func (client *Client) RenewalStats() RenewalStats {
+	client.statsMu.Lock()
+	defer client.statsMu.Unlock()
+
+	return client.renewalStats
+}
+
+func (client *Client) recordRenewal(renewedAt time.Time, ttl time.Duration) {
+	client.statsMu.Lock()
+	defer client.statsMu.Unlock()
+
+	client.renewalStats.Renewals++
+	client.renewalStats.LastRenewal = renewedAt
+	client.renewalStats.LastTTL = ttl
+}
+
+func (client *Client) recordRenewalFailure() {
+	client.statsMu.Lock()
+	defer client.statsMu.Unlock()
+
+	client.renewalStats.Failures++
+}
+
+// Authenticated returns a channel which is closed once the client has a Vault token,
+// which is right away unless the client was created with ClientAsyncAuth.
+func (client *Client) Authenticated() <-chan struct{} {
+	return client.authenticated
+}
+
+func (client *Client) markAuthenticated() {
+	client.authenticatedOnce.Do(func() {
+		close(client.authenticated)
+	})
+}
+
+// LoginError returns a channel which receives the error if the client gives up logging in to Vault,
+// because ClientMaxLoginAttempts or ClientMaxLoginDuration was exceeded. The client stops retrying then.
+func (client *Client) LoginError() <-chan error {
+	return client.loginErr
+}
+
+// OnTokenChange registers a function which is called with the current token
+// after every login and token renewal. If the client already holds a token,
+// fn is called with it right away.
+func (client *Client) OnTokenChange(fn func(token string)) {
+	client.mu.Lock()
+	client.tokenChangeHandlers = append(client.tokenChangeHandlers, fn)
+	client.mu.Unlock()
+
+	if token := client.client.Token(); token != "" {
+		fn(token)
+	}
+}
+
+// notifyTokenChange calls the registered token change handlers outside of the client lock,
+// so the handlers are free to call back into the client.
+func (client *Client) notifyTokenChange() {
+	client.mu.Lock()
+	handlers := make([]func(string), len(client.tokenChangeHandlers))
+	copy(handlers, client.tokenChangeHandlers)
+	client.mu.Unlock()
+
+	token := client.client.Token()
+	for _, fn := range handlers {
+		fn(token)
+	}
+}
+
+// HealthCheck returns the health of the Vault server as reported by sys/health, including its seal and standby status.
+// The request is limited by the timeout of the client.
+func (client *Client) HealthCheck(ctx context.Context) (*vaultapi.HealthResponse, error) {
+	release, err := client.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	health, err := client.client.Sys().HealthWithContext(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get Vault server health")
+	}
+
+	return health, nil
+}
+
+// IsReady reports whether the Vault server can serve secrets, i.e. it's initialized, unsealed and not a standby node.
+// Performance standby nodes are ready, since they serve reads.
+func (client *Client) IsReady(ctx context.Context) (bool, error) {
+	health, err := client.HealthCheck(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	if !health.Initialized || health.Sealed || (health.Standby && !health.PerformanceStandby) {
+		client.logger.Info("Vault server isn't ready", map[string]interface{}{
+			"initialized": health.Initialized,
+			"sealed":      health.Sealed,
+			"standby":     health.Standby,
+		})
+
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// ServerVersion returns the version of the Vault server as reported by sys/health.
+func (client *Client) ServerVersion(ctx context.Context) (string, error) {
+	health, err := client.HealthCheck(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return health.Version, nil
+}
+
+func (client *Client) checkServerVersion(ctx context.Context, minVersion string) error {
+	minimum, err := semver.NewVersion(minVersion)
+	if err != nil {
+		return errors.Wrapf(err, "could not parse minimum Vault version: %s", minVersion)
+	}
+
+	serverVersion, err := client.ServerVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	current, err := semver.NewVersion(serverVersion)
+	if err != nil {
+		return errors.Wrapf(err, "could not parse Vault server version: %s", serverVersion)
+	}
+
+	if current.LessThan(minimum) {
+		return errors.Errorf("Vault server version %s is older than the required minimum version %s", serverVersion, minVersion)
+	}
+
+	return nil
+}
+
+// Acquire waits for a free request slot if ClientMaxConcurrentRequests is set, and returns
+// a function which releases it. Use it to limit requests made directly with RawClient as well.
+func (client *Client) Acquire(ctx context.Context) (release func(), err error) {
+	return client.limiter.acquire(ctx)
+}
+
+// requestLimiter is a semaphore limiting the number of in-flight requests, nil means unlimited.
+type requestLimiter chan struct{}
+
+func (l requestLimiter) acquire(ctx context.Context) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case l <- struct{}{}:
+		return func() { <-l }, nil
+	case <-ctx.Done():
+		return nil, errors.Wrap(ctx.Err(), "waiting for a free Vault request slot")
+	}
+}
+
 // Vault returns the underlying hashicorp Vault client.
 // Deprecated: use RawClient instead.
 func (client *Client) Vault() *vaultapi.Client {
@@ -552,6 +1872,10 @@ func (client *Client) Close() {
 	if client.watch != nil {
 		_ = client.watch.Close()
 	}
+
+	if client.credWatch != nil {
+		_ = client.credWatch.Close()
+	}
 }
 
 // NewRawClient creates a new raw Vault client.
@@ -0,0 +1,1063 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	vaultapi "github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOnTokenChange(t *testing.T) {
+	rawClient, err := vaultapi.NewClient(vaultapi.DefaultConfig())
+	require.NoError(t, err)
+
+	client, err := NewClientFromRawClient(rawClient, ClientToken("initial"))
+	require.NoError(t, err)
+	defer client.Close()
+
+	var tokens []string
+	client.OnTokenChange(func(token string) {
+		tokens = append(tokens, token)
+	})
+
+	rawClient.SetToken("renewed")
+	client.notifyTokenChange()
+
+	assert.Equal(t, []string{"initial", "renewed"}, tokens)
+}
+
+func TestRequestLimiter(t *testing.T) {
+	limiter := make(requestLimiter, 1)
+
+	release, err := limiter.acquire(context.Background())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err = limiter.acquire(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	release()
+
+	release, err = limiter.acquire(context.Background())
+	require.NoError(t, err)
+	release()
+}
+
+func TestMaxLoginAttempts(t *testing.T) {
+	var attempts atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		attempts.Add(1)
+		http.Error(w, `{"errors": ["invalid role name"]}`, http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	config := vaultapi.DefaultConfig()
+	config.Address = server.URL
+
+	rawClient, err := vaultapi.NewClient(config)
+	require.NoError(t, err)
+	rawClient.ClearToken()
+
+	_, err = NewClientFromRawClient(
+		rawClient,
+		ClientTokenPath(filepath.Join(t.TempDir(), "missing")),
+		ClientJWTProvider(func(context.Context) (string, error) { return "jwt", nil }),
+		ClientMaxLoginAttempts(2),
+		ClientTimeout(time.Minute),
+	)
+
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "giving up logging in to Vault after 2 attempt(s)")
+	assert.Equal(t, int32(2), attempts.Load())
+}
+
+func TestJWTProvider(t *testing.T) {
+	var jwts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		jwts = append(jwts, body["jwt"])
+
+		if body["jwt"] != "jwt-2" {
+			http.Error(w, `{"errors": ["permission denied"]}`, http.StatusForbidden)
+
+			return
+		}
+
+		fmt.Fprint(w, `{"auth": {"client_token": "jwt-token", "renewable": false, "lease_duration": 3600}}`)
+	}))
+	defer server.Close()
+
+	t.Setenv(vaultapi.EnvVaultAddress, server.URL)
+	t.Setenv(vaultapi.EnvVaultToken, "")
+
+	// the provider is called on each login attempt, the first JWT is rejected
+	var calls atomic.Int32
+	client, err := NewClientWithOptions(
+		ClientTokenPath(filepath.Join(t.TempDir(), "missing")),
+		ClientJWTProvider(func(context.Context) (string, error) {
+			return fmt.Sprintf("jwt-%d", calls.Add(1)), nil
+		}),
+		ClientMaxLoginAttempts(2),
+		ClientTimeout(time.Minute),
+	)
+	require.NoError(t, err)
+	defer client.Close()
+
+	assert.Equal(t, "jwt-token", client.RawClient().Token())
+	assert.EqualValues(t, 2, calls.Load())
+	assert.Equal(t, []string{"jwt-1", "jwt-2"}, jwts)
+
+	_, err = NewClientWithOptions(
+		ClientTokenPath(filepath.Join(t.TempDir(), "missing")),
+		ClientJWTProvider(func(context.Context) (string, error) {
+			return "", errors.New("token source unavailable")
+		}),
+		ClientMaxLoginAttempts(1),
+		ClientTimeout(time.Minute),
+	)
+	assert.ErrorContains(t, err, "failed to get JWT from provider: token source unavailable")
+	assert.Len(t, jwts, 2, "no login request should be sent without a JWT")
+}
+
+func TestAuthNamespace(t *testing.T) {
+	var mu sync.Mutex
+	namespaces := map[string]string{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		namespaces[r.URL.Path] = r.Header.Get("X-Vault-Namespace")
+		mu.Unlock()
+
+		if r.URL.Path == "/v1/auth/kubernetes/login" {
+			fmt.Fprint(w, `{"auth": {"client_token": "token", "lease_duration": 3600, "renewable": true}}`)
+
+			return
+		}
+
+		fmt.Fprint(w, `{"data": {"password": "secret"}}`)
+	}))
+	defer server.Close()
+
+	config := vaultapi.DefaultConfig()
+	config.Address = server.URL
+
+	rawClient, err := vaultapi.NewClient(config)
+	require.NoError(t, err)
+	rawClient.ClearToken()
+
+	client, err := NewClientFromRawClient(
+		rawClient,
+		ClientTokenPath(filepath.Join(t.TempDir(), "missing")),
+		ClientJWTProvider(func(context.Context) (string, error) { return "jwt", nil }),
+		VaultNamespace("team"),
+		ClientAuthNamespace("auth"),
+	)
+	require.NoError(t, err)
+	defer client.Close()
+
+	_, err = client.RawClient().Logical().Read("secret/app")
+	require.NoError(t, err)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	assert.Equal(t, "auth", namespaces["/v1/auth/kubernetes/login"])
+	assert.Equal(t, "team", namespaces["/v1/secret/app"])
+}
+
+func TestConfigureTLS(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []ClientOption
+		err     string
+	}{
+		{
+			name:    "TLS 1.3",
+			options: []ClientOption{ClientTLSMinVersion(tls.VersionTLS13)},
+		},
+		{
+			name:    "TLS 1.2 with cipher suites",
+			options: []ClientOption{ClientTLSMinVersion(tls.VersionTLS12), ClientTLSCipherSuites(tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384)},
+		},
+		{
+			name:    "TLS 1.1",
+			options: []ClientOption{ClientTLSMinVersion(tls.VersionTLS11)},
+			err:     "unsupported TLS minimum version TLS 1.1",
+		},
+		{
+			name:    "insecure cipher suite",
+			options: []ClientOption{ClientTLSCipherSuites(tls.TLS_RSA_WITH_RC4_128_SHA)},
+			err:     "unsupported or insecure TLS 1.2 cipher suite: TLS_RSA_WITH_RC4_128_SHA",
+		},
+		{
+			name:    "cipher suites with TLS 1.3",
+			options: []ClientOption{ClientTLSMinVersion(tls.VersionTLS13), ClientTLSCipherSuites(tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384)},
+			err:     "TLS cipher suites can't be configured with TLS 1.3",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rawClient, err := vaultapi.NewClient(vaultapi.DefaultConfig())
+			require.NoError(t, err)
+
+			client, err := NewClientFromRawClient(rawClient, append(test.options, ClientToken("token"))...)
+			if test.err != "" {
+				assert.ErrorContains(t, err, test.err)
+
+				return
+			}
+			require.NoError(t, err)
+			defer client.Close()
+
+			o := &clientOptions{}
+			for _, opt := range test.options {
+				opt.apply(o)
+			}
+
+			tlsConfig := rawClient.CloneConfig().HttpClient.Transport.(*http.Transport).TLSClientConfig
+			assert.Equal(t, o.tlsMinVersion, tlsConfig.MinVersion)
+			assert.Equal(t, o.tlsCipherSuites, tlsConfig.CipherSuites)
+		})
+	}
+}
+
+func TestAsyncAuth(t *testing.T) {
+	var attempts atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/auth/kubernetes/login" && attempts.Add(1) == 1 {
+			http.Error(w, `{"errors": ["Vault is sealed"]}`, http.StatusServiceUnavailable)
+
+			return
+		}
+
+		fmt.Fprint(w, `{"auth": {"client_token": "token", "lease_duration": 3600, "renewable": true}}`)
+	}))
+	defer server.Close()
+
+	config := vaultapi.DefaultConfig()
+	config.Address = server.URL
+	config.MaxRetries = 0
+
+	rawClient, err := vaultapi.NewClient(config)
+	require.NoError(t, err)
+	rawClient.ClearToken()
+
+	client, err := NewClientFromRawClient(
+		rawClient,
+		ClientTokenPath(filepath.Join(t.TempDir(), "missing")),
+		ClientJWTProvider(func(context.Context) (string, error) { return "jwt", nil }),
+		ClientTimeout(time.Millisecond),
+		ClientAsyncAuth(true),
+	)
+	require.NoError(t, err)
+	defer client.Close()
+
+	select {
+	case <-client.Authenticated():
+		assert.Equal(t, "token", client.RawClient().Token())
+	case <-time.After(5 * time.Second):
+		t.Fatal("client didn't authenticate")
+	}
+}
+
+func TestConfigureConnections(t *testing.T) {
+	rawClient, err := vaultapi.NewClient(vaultapi.DefaultConfig())
+	require.NoError(t, err)
+
+	client, err := NewClientFromRawClient(
+		rawClient,
+		ClientToken("token"),
+		ClientIdleConnTimeout(30*time.Second),
+		ClientMaxIdleConns(4),
+		ClientKeepAlive(10*time.Second),
+	)
+	require.NoError(t, err)
+	defer client.Close()
+
+	transport := rawClient.CloneConfig().HttpClient.Transport.(*http.Transport)
+	assert.Equal(t, 30*time.Second, transport.IdleConnTimeout)
+	assert.Equal(t, 4, transport.MaxIdleConns)
+	assert.Equal(t, 4, transport.MaxIdleConnsPerHost)
+	assert.NotNil(t, transport.DialContext)
+
+	_, err = NewClientFromRawClient(rawClient, ClientToken("token"), ClientMaxIdleConns(-1))
+	assert.Error(t, err)
+}
+
+func TestJWTAudience(t *testing.T) {
+	t.Parallel()
+
+	newJWT := func(claims string) string {
+		encode := base64.RawURLEncoding.EncodeToString
+
+		return encode([]byte(`{"alg":"RS256"}`)) + "." + encode([]byte(claims)) + ".signature"
+	}
+
+	dir := t.TempDir()
+	defaultToken := filepath.Join(dir, "token")
+	vaultToken := filepath.Join(dir, "vault-token")
+	require.NoError(t, os.WriteFile(defaultToken, []byte(newJWT(`{"aud":["https://kubernetes.default.svc"]}`)), 0o600))
+	require.NoError(t, os.WriteFile(vaultToken, []byte(newJWT(`{"aud":"vault"}`)), 0o600))
+
+	tests := []struct {
+		name    string
+		options clientOptions
+		want    string
+		err     string
+	}{
+		{
+			name:    "no audience",
+			options: clientOptions{},
+			want:    defaultToken,
+		},
+		{
+			name:    "audience in default file",
+			options: clientOptions{jwtAudience: "https://kubernetes.default.svc"},
+			want:    defaultToken,
+		},
+		{
+			name:    "audience in second file",
+			options: clientOptions{jwtAudience: "vault", jwtFiles: []string{defaultToken, vaultToken}},
+			want:    vaultToken,
+		},
+		{
+			name:    "audience not found",
+			options: clientOptions{jwtAudience: "other", jwtFiles: []string{defaultToken, vaultToken}},
+			err:     "no JWT with audience 'other' found",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			jwt, err := readJWT(context.Background(), defaultToken, &test.options)
+			if test.err != "" {
+				assert.ErrorContains(t, err, test.err)
+
+				return
+			}
+			require.NoError(t, err)
+
+			want, err := os.ReadFile(test.want)
+			require.NoError(t, err)
+			assert.Equal(t, string(want), jwt)
+		})
+	}
+}
+
+func TestRenewalStats(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/auth/token/renew-self" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors": []}`)
+
+			return
+		}
+		fmt.Fprint(w, `{"auth": {"client_token": "token", "renewable": true, "lease_duration": 3600}}`)
+	}))
+	defer server.Close()
+
+	config := vaultapi.DefaultConfig()
+	config.Address = server.URL
+
+	rawClient, err := vaultapi.NewClient(config)
+	require.NoError(t, err)
+
+	client, err := NewClientFromRawClient(rawClient, ClientToken("token"))
+	require.NoError(t, err)
+	defer client.Close()
+
+	assert.Equal(t, RenewalStats{}, client.RenewalStats())
+
+	watcher, err := rawClient.NewLifetimeWatcher(&vaultapi.LifetimeWatcherInput{
+		Secret: &vaultapi.Secret{Auth: &vaultapi.SecretAuth{ClientToken: "token", Renewable: true, LeaseDuration: 3600}},
+	})
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		client.runRenewChecker(watcher)
+		close(done)
+	}()
+	go watcher.Start()
+
+	require.Eventually(t, func() bool {
+		return client.RenewalStats().Renewals == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	watcher.Stop()
+	<-done
+
+	stats := client.RenewalStats()
+	assert.Equal(t, time.Hour, stats.LastTTL)
+	assert.False(t, stats.LastRenewal.IsZero())
+	assert.Zero(t, stats.Failures)
+
+	client.recordRenewalFailure()
+	assert.Equal(t, 1, client.RenewalStats().Failures)
+}
+
+func TestEffectiveConfig(t *testing.T) {
+	config := vaultapi.DefaultConfig()
+	config.Address = "https://vault.example.com:8200"
+	require.NoError(t, config.ConfigureTLS(&vaultapi.TLSConfig{Insecure: true}))
+
+	rawClient, err := vaultapi.NewClient(config)
+	require.NoError(t, err)
+
+	client, err := NewClientFromRawClient(
+		rawClient,
+		ClientToken("s.secret"),
+		ClientRole("app"),
+		ClientAuthPath("k8s"),
+		VaultNamespace("team"),
+		ClientTimeout(5*time.Second),
+	)
+	require.NoError(t, err)
+	defer client.Close()
+
+	rawClient.SetClientTimeout(30 * time.Second)
+
+	snapshot := client.EffectiveConfig()
+	assert.Equal(t, ClientConfigSnapshot{
+		Address:        "https://vault.example.com:8200",
+		Namespace:      "team",
+		AuthMethod:     JWTAuthMethod,
+		AuthPath:       "k8s",
+		Role:           "app",
+		TokenSource:    "token",
+		TokenPath:      snapshot.TokenPath,
+		Timeout:        5 * time.Second,
+		RequestTimeout: 30 * time.Second,
+		TLSVerify:      false,
+	}, snapshot)
+
+	assert.NotContains(t, fmt.Sprint(snapshot.Fields()), "s.secret")
+}
+
+func TestAuthPaths(t *testing.T) {
+	rawClient, err := vaultapi.NewClient(vaultapi.DefaultConfig())
+	require.NoError(t, err)
+
+	paths := ClientAuthPaths{JWTAuthMethod: "k8s-prod", AppRoleAuthMethod: "approle-prod"}
+
+	for _, test := range []struct {
+		opts []ClientOption
+		path string
+	}{
+		{opts: []ClientOption{ClientToken("token")}, path: "kubernetes"},
+		{opts: []ClientOption{ClientToken("token"), ClientAuthMethod(AppRoleAuthMethod)}, path: "approle"},
+		{opts: []ClientOption{ClientToken("token"), paths}, path: "k8s-prod"},
+		{opts: []ClientOption{ClientToken("token"), paths, ClientAuthMethod(AppRoleAuthMethod)}, path: "approle-prod"},
+		{opts: []ClientOption{ClientToken("token"), paths, ClientAuthMethod(GCPGCEAuthMethod)}, path: "kubernetes"},
+		{opts: []ClientOption{ClientToken("token"), paths, ClientAuthPath("custom")}, path: "custom"},
+	} {
+		client, err := NewClientFromRawClient(rawClient, test.opts...)
+		require.NoError(t, err)
+
+		assert.Equal(t, test.path, client.EffectiveConfig().AuthPath)
+
+		client.Close()
+	}
+}
+
+func TestAuthMethodChain(t *testing.T) {
+	var mu sync.Mutex
+	var logins []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		logins = append(logins, r.URL.Path)
+		mu.Unlock()
+
+		if r.URL.Path != "/v1/auth/approle-ci/login" {
+			http.Error(w, `{"errors": ["permission denied"]}`, http.StatusForbidden)
+
+			return
+		}
+
+		fmt.Fprint(w, `{"auth": {"client_token": "approle-token", "renewable": false, "lease_duration": 3600}}`)
+	}))
+	defer server.Close()
+
+	config := vaultapi.DefaultConfig()
+	config.Address = server.URL
+
+	rawClient, err := vaultapi.NewClient(config)
+	require.NoError(t, err)
+	rawClient.ClearToken()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "role-id"), []byte("role"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "secret-id"), []byte("secret"), 0o600))
+
+	client, err := NewClientFromRawClient(
+		rawClient,
+		ClientTokenPath(filepath.Join(dir, "missing")),
+		ClientJWTProvider(func(context.Context) (string, error) { return "jwt", nil }),
+		ClientAuthMethodChain{JWTAuthMethod, AppRoleAuthMethod},
+		ClientAuthPath("k8s"),
+		ClientAuthPaths{AppRoleAuthMethod: "approle-ci"},
+		ClientRoleIDFile(filepath.Join(dir, "role-id")),
+		ClientSecretIDFile(filepath.Join(dir, "secret-id")),
+		ClientTimeout(time.Minute),
+	)
+	require.NoError(t, err)
+	defer client.Close()
+
+	assert.Equal(t, "approle-token", rawClient.Token())
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"/v1/auth/k8s/login", "/v1/auth/approle-ci/login"}, logins)
+}
+
+func TestCertAuth(t *testing.T) {
+	var logins atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logins.Add(1)
+
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+
+		if r.URL.Path != "/v1/auth/cert-mount/login" || body["name"] != "web" {
+			http.Error(w, `{"errors": ["invalid certificate or no client certificate supplied"]}`, http.StatusBadRequest)
+
+			return
+		}
+
+		fmt.Fprint(w, `{"auth": {"client_token": "cert-token", "renewable": false, "lease_duration": 3600}}`)
+	}))
+	defer server.Close()
+
+	newRawClient := func(withCert bool) *vaultapi.Client {
+		config := vaultapi.DefaultConfig()
+		config.Address = server.URL
+
+		rawClient, err := vaultapi.NewClient(config)
+		require.NoError(t, err)
+		rawClient.ClearToken()
+
+		if withCert {
+			transport, err := rawTransport(rawClient)
+			require.NoError(t, err)
+			transport.TLSClientConfig.Certificates = []tls.Certificate{{}}
+		}
+
+		return rawClient
+	}
+
+	opts := []ClientOption{
+		ClientTokenPath(filepath.Join(t.TempDir(), "missing")),
+		ClientAuthMethod(CertAuthMethod),
+		ClientAuthPath("cert-mount"),
+		ClientRole("web"),
+		ClientMaxLoginAttempts(1),
+		ClientTimeout(time.Minute),
+	}
+
+	rawClient := newRawClient(true)
+	client, err := NewClientFromRawClient(rawClient, opts...)
+	require.NoError(t, err)
+	defer client.Close()
+
+	assert.Equal(t, "cert-token", rawClient.Token())
+	assert.Equal(t, int32(1), logins.Load())
+
+	_, err = NewClientFromRawClient(newRawClient(false), opts...)
+	assert.ErrorContains(t, err, "cert auth method requires a client certificate")
+	assert.Equal(t, int32(1), logins.Load())
+}
+
+func TestAppRoleCredentials(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+
+		switch {
+		case r.URL.Path == "/v1/sys/wrapping/unwrap" && r.Header.Get("X-Vault-Token") == "wrapping-token":
+			fmt.Fprint(w, `{"data": {"secret_id": "secret-id"}}`)
+		case r.URL.Path == "/v1/auth/approle/login" && body["role_id"] == "role-id" && body["secret_id"] == "secret-id":
+			fmt.Fprint(w, `{"auth": {"client_token": "approle-token", "renewable": false, "lease_duration": 3600}}`)
+		default:
+			http.Error(w, `{"errors": ["invalid role or secret ID"]}`, http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	for name, opts := range map[string][]ClientOption{
+		"values":  {ClientRoleID("role-id"), ClientSecretID("secret-id")},
+		"wrapped": {ClientRoleID("role-id"), ClientSecretID("wrapping-token"), ClientSecretIDWrapped(true)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			config := vaultapi.DefaultConfig()
+			config.Address = server.URL
+
+			rawClient, err := vaultapi.NewClient(config)
+			require.NoError(t, err)
+			rawClient.ClearToken()
+
+			client, err := NewClientFromRawClient(rawClient, append(opts,
+				ClientTokenPath(filepath.Join(t.TempDir(), "missing")),
+				ClientAuthMethod(AppRoleAuthMethod),
+				ClientMaxLoginAttempts(1),
+				ClientTimeout(time.Minute),
+			)...)
+			require.NoError(t, err)
+			defer client.Close()
+
+			assert.Equal(t, "approle-token", rawClient.Token())
+		})
+	}
+}
+
+func TestLDAPCredentials(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+
+		if r.URL.Path != "/v1/auth/ldap/login/jane.doe" || body["password"] != "password" {
+			http.Error(w, `{"errors": ["ldap operation failed"]}`, http.StatusBadRequest)
+
+			return
+		}
+
+		fmt.Fprint(w, `{"auth": {"client_token": "ldap-token", "renewable": false, "lease_duration": 3600}}`)
+	}))
+	defer server.Close()
+
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	require.NoError(t, os.WriteFile(passwordFile, []byte("password\n"), 0o600))
+
+	for name, opts := range map[string][]ClientOption{
+		"value": {ClientUsername("jane.doe"), ClientPassword("password")},
+		"file":  {ClientUsername("jane.doe"), ClientPasswordFile(passwordFile)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			config := vaultapi.DefaultConfig()
+			config.Address = server.URL
+
+			rawClient, err := vaultapi.NewClient(config)
+			require.NoError(t, err)
+			rawClient.ClearToken()
+
+			client, err := NewClientFromRawClient(rawClient, append(opts,
+				ClientTokenPath(filepath.Join(t.TempDir(), "missing")),
+				ClientAuthMethod(LDAPAuthMethod),
+				ClientMaxLoginAttempts(1),
+				ClientTimeout(time.Minute),
+			)...)
+			require.NoError(t, err)
+			defer client.Close()
+
+			assert.Equal(t, "ldap-token", rawClient.Token())
+		})
+	}
+
+	config := vaultapi.DefaultConfig()
+	config.Address = server.URL
+
+	rawClient, err := vaultapi.NewClient(config)
+	require.NoError(t, err)
+	rawClient.ClearToken()
+
+	_, err = NewClientFromRawClient(rawClient,
+		ClientTokenPath(filepath.Join(t.TempDir(), "missing")),
+		ClientAuthMethod(LDAPAuthMethod),
+		ClientUsername("jane.doe"),
+		ClientMaxLoginAttempts(1),
+		ClientTimeout(time.Minute),
+	)
+	assert.ErrorContains(t, err, "LDAP auth method requires a username and a password")
+}
+
+func TestHealthCheck(t *testing.T) {
+	var health atomic.Value
+	health.Store(`{"initialized": true, "sealed": false, "standby": false, "version": "1.15.0"}`)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/sys/health" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors": []}`)
+
+			return
+		}
+
+		fmt.Fprint(w, health.Load())
+	}))
+	defer server.Close()
+
+	config := vaultapi.DefaultConfig()
+	config.Address = server.URL
+
+	rawClient, err := vaultapi.NewClient(config)
+	require.NoError(t, err)
+
+	client, err := NewClientFromRawClient(rawClient, ClientToken("token"))
+	require.NoError(t, err)
+	defer client.Close()
+
+	ctx := context.Background()
+
+	response, err := client.HealthCheck(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "1.15.0", response.Version)
+
+	for status, ready := range map[string]bool{
+		`{"initialized": true, "sealed": false, "standby": false}`:                             true,
+		`{"initialized": true, "sealed": false, "standby": true, "performance_standby": true}`: true,
+		`{"initialized": true, "sealed": false, "standby": true}`:                              false,
+		`{"initialized": true, "sealed": true, "standby": false}`:                              false,
+		`{"initialized": false, "sealed": true, "standby": false}`:                             false,
+	} {
+		health.Store(status)
+
+		isReady, err := client.IsReady(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, ready, isReady, status)
+	}
+}
+
+func TestOnTokenRenew(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/auth/token/renew-self" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors": []}`)
+
+			return
+		}
+		fmt.Fprint(w, `{"auth": {"client_token": "token", "renewable": true, "lease_duration": 7200}}`)
+	}))
+	defer server.Close()
+
+	config := vaultapi.DefaultConfig()
+	config.Address = server.URL
+
+	rawClient, err := vaultapi.NewClient(config)
+	require.NoError(t, err)
+	rawClient.ClearToken()
+
+	var current atomic.Pointer[Client]
+	durations := make(chan int, 10)
+	client, err := NewClientFromRawClient(rawClient,
+		ClientLoginSecret(&vaultapi.Secret{Auth: &vaultapi.SecretAuth{ClientToken: "token", Renewable: true, LeaseDuration: 3600}}),
+		ClientOnTokenRenew(func(secret *vaultapi.Secret) {
+			// Calling the client from the callback mustn't deadlock
+			if client := current.Load(); client != nil {
+				_ = client.RenewalStats()
+				_ = client.EffectiveConfig()
+			}
+
+			durations <- secret.Auth.LeaseDuration
+		}),
+	)
+	require.NoError(t, err)
+	defer client.Close()
+	current.Store(client)
+
+	for _, want := range []int{3600, 7200} {
+		select {
+		case duration := <-durations:
+			assert.Equal(t, want, duration)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("token renewal callback wasn't called with lease duration %d", want)
+		}
+	}
+}
+
+type countingTransport struct {
+	transport http.RoundTripper
+	requests  atomic.Int32
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests.Add(1)
+
+	return t.transport.RoundTrip(req)
+}
+
+func TestHTTPClient(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `{"data": {"value": "secret"}}`)
+	}))
+	defer server.Close()
+
+	caCert := filepath.Join(t.TempDir(), "ca.crt")
+	require.NoError(t, os.WriteFile(caCert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o600))
+	t.Setenv(vaultapi.EnvVaultCACert, caCert)
+
+	config := vaultapi.DefaultConfig()
+	require.NoError(t, config.Error)
+	config.Address = server.URL
+
+	transport := &countingTransport{transport: server.Client().Transport}
+	client, err := NewClientFromConfig(config, ClientToken("token"), ClientHTTPClient(&http.Client{Transport: transport}))
+	require.NoError(t, err)
+	defer client.Close()
+
+	secret, err := client.RawClient().Logical().Read("secret/app")
+	require.NoError(t, err)
+	assert.Equal(t, "secret", secret.Data["value"])
+
+	assert.Equal(t, int32(1), transport.requests.Load())
+	assert.Nil(t, client.watch, "the CA certificate isn't reloaded into a custom HTTP client")
+}
+
+func TestConfigNotModified(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `{"data": {"value": "secret"}}`)
+	}))
+	defer server.Close()
+
+	config := vaultapi.DefaultConfig()
+	require.NoError(t, config.Error)
+	config.Address = server.URL
+	configClient := config.HttpClient
+	configTransport := configClient.Transport.(*http.Transport)
+
+	client, err := NewClientFromConfig(config, ClientToken("token"), ClientTLSMinVersion(tls.VersionTLS13), ClientProxyURL("http://bastion:3128"))
+	require.NoError(t, err)
+	defer client.Close()
+
+	assert.Same(t, configClient, config.HttpClient)
+	assert.Same(t, configTransport, config.HttpClient.Transport)
+	assert.NotEqual(t, uint16(tls.VersionTLS13), configTransport.TLSClientConfig.MinVersion)
+
+	proxyURL, err := configTransport.Proxy(&http.Request{URL: &url.URL{Scheme: "http", Host: "vault.internal"}})
+	require.NoError(t, err)
+	assert.Nil(t, proxyURL)
+
+	transport, err := rawTransport(client.RawClient())
+	require.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS13), transport.TLSClientConfig.MinVersion)
+
+	// the custom HTTP client isn't set in the configuration, nor is its transport modified
+	customTransport := &http.Transport{}
+	customClient := &http.Client{Transport: customTransport}
+
+	client, err = NewClientFromConfig(config, ClientToken("token"), ClientHTTPClient(customClient), ClientTLSMinVersion(tls.VersionTLS13))
+	require.NoError(t, err)
+	defer client.Close()
+
+	assert.Same(t, configClient, config.HttpClient)
+	assert.Same(t, customTransport, customClient.Transport)
+	if customTransport.TLSClientConfig != nil {
+		assert.NotEqual(t, uint16(tls.VersionTLS13), customTransport.TLSClientConfig.MinVersion)
+	}
+
+	secret, err := client.RawClient().Logical().Read("secret/app")
+	require.NoError(t, err)
+	assert.Equal(t, "secret", secret.Data["value"])
+}
+
+func TestCACertPEM(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `{"data": {"value": "secret"}}`)
+	}))
+	defer server.Close()
+
+	caCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	// the configurations are created before VAULT_CACERT is set, so they only trust the system CAs
+	untrusted := vaultapi.DefaultConfig()
+	untrusted.Address = server.URL
+
+	config := vaultapi.DefaultConfig()
+	config.Address = server.URL
+
+	caCertFile := filepath.Join(t.TempDir(), "ca.crt")
+	require.NoError(t, os.WriteFile(caCertFile, caCert, 0o600))
+	t.Setenv(vaultapi.EnvVaultCACert, caCertFile)
+
+	untrustedClient, err := NewClientFromConfig(untrusted, ClientToken("token"))
+	require.NoError(t, err)
+	defer untrustedClient.Close()
+
+	_, err = untrustedClient.RawClient().Logical().Read("secret/app")
+	require.ErrorContains(t, err, "certificate")
+
+	client, err := NewClientFromConfig(config, ClientToken("token"), ClientCACertPEM(caCert))
+	require.NoError(t, err)
+	defer client.Close()
+
+	secret, err := client.RawClient().Logical().Read("secret/app")
+	require.NoError(t, err)
+	assert.Equal(t, "secret", secret.Data["value"])
+	assert.Nil(t, client.watch, "the CA certificate of VAULT_CACERT isn't reloaded")
+
+	_, err = NewClientFromConfig(vaultapi.DefaultConfig(), ClientToken("token"), ClientCACertPEM([]byte("not a PEM")))
+	assert.EqualError(t, err, "CA certificate PEM doesn't contain any certificates")
+
+	invalid := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("invalid")})
+	_, err = NewClientFromConfig(vaultapi.DefaultConfig(), ClientToken("token"), ClientCACertPEM(invalid))
+	assert.ErrorContains(t, err, "failed to parse certificate 1 of the CA certificate PEM")
+}
+
+func TestProxyURL(t *testing.T) {
+	var proxied atomic.Value
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// a forward proxy receives the absolute URL of the target
+		proxied.Store(r.URL.String())
+		fmt.Fprint(w, `{"data": {"value": "secret"}}`)
+	}))
+	defer proxy.Close()
+
+	config := vaultapi.DefaultConfig()
+	config.Address = "http://vault.internal:8200"
+
+	rawClient, err := vaultapi.NewClient(config)
+	require.NoError(t, err)
+
+	client, err := NewClientFromRawClient(rawClient, ClientToken("token"), ClientProxyURL(proxy.URL), ClientTLSMinVersion(tls.VersionTLS13))
+	require.NoError(t, err)
+	defer client.Close()
+
+	secret, err := client.RawClient().Logical().Read("secret/app")
+	require.NoError(t, err)
+	assert.Equal(t, "secret", secret.Data["value"])
+	assert.Equal(t, "http://vault.internal:8200/v1/secret/app", proxied.Load())
+
+	transport, err := rawTransport(rawClient)
+	require.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS13), transport.TLSClientConfig.MinVersion, "the proxy composes with the TLS settings")
+
+	_, err = NewClientFromRawClient(rawClient, ClientToken("token"), ClientProxyURL("socks5://bastion:1080"))
+	require.NoError(t, err)
+
+	proxyURL, err := transport.Proxy(&http.Request{URL: &url.URL{Scheme: "https", Host: "vault.internal"}})
+	require.NoError(t, err)
+	assert.Equal(t, "socks5://bastion:1080", proxyURL.String())
+
+	_, err = NewClientFromRawClient(rawClient, ClientToken("token"), ClientProxyURL("ftp://bastion"))
+	assert.EqualError(t, err, `unsupported proxy scheme "ftp", use http, https or socks5`)
+}
+
+func TestInitialTokenWaitCancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, `{"errors": ["Vault is sealed"]}`, http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	config := vaultapi.DefaultConfig()
+	config.Address = server.URL
+	config.MaxRetries = 0
+
+	rawClient, err := vaultapi.NewClient(config)
+	require.NoError(t, err)
+	rawClient.ClearToken()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err = NewClientFromRawClientWithContext(
+		ctx,
+		rawClient,
+		ClientTokenPath(filepath.Join(t.TempDir(), "missing")),
+		ClientJWTProvider(func(context.Context) (string, error) { return "jwt", nil }),
+		ClientTimeout(time.Minute),
+	)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, time.Since(start), 10*time.Second, "the wait stops before the timeout")
+}
+
+func TestMinVersionCheckCancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(10 * time.Second):
+		}
+		fmt.Fprint(w, `{"initialized": true, "sealed": false, "standby": false, "version": "1.15.0"}`)
+	}))
+	defer server.Close()
+
+	config := vaultapi.DefaultConfig()
+	config.Address = server.URL
+
+	rawClient, err := vaultapi.NewClient(config)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err = NewClientFromRawClientWithContext(ctx, rawClient, ClientToken("token"), ClientMinVersion("1.14.0"), ClientTimeout(time.Minute))
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, time.Since(start), 5*time.Second, "the version check stops before the timeout")
+}
+
+func TestLoginMetadata(t *testing.T) {
+	var loginHeader, readHeader atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/auth/kubernetes/login" {
+			loginHeader.Store(r.Header.Get("X-Workload-ID"))
+			fmt.Fprint(w, `{"auth": {"client_token": "token", "lease_duration": 3600, "renewable": true}}`)
+
+			return
+		}
+
+		readHeader.Store(r.Header.Get("X-Workload-ID"))
+		fmt.Fprint(w, `{"data": {"value": "secret"}}`)
+	}))
+	defer server.Close()
+
+	config := vaultapi.DefaultConfig()
+	config.Address = server.URL
+
+	rawClient, err := vaultapi.NewClient(config)
+	require.NoError(t, err)
+	rawClient.ClearToken()
+
+	client, err := NewClientFromRawClient(
+		rawClient,
+		ClientTokenPath(filepath.Join(t.TempDir(), "missing")),
+		ClientJWTProvider(func(context.Context) (string, error) { return "jwt", nil }),
+		ClientLoginMetadata(map[string]string{"X-Workload-ID": "billing-7f9c"}),
+	)
+	require.NoError(t, err)
+	defer client.Close()
+
+	assert.Equal(t, "billing-7f9c", loginHeader.Load())
+
+	_, err = client.RawClient().Logical().Read("secret/app")
+	require.NoError(t, err)
+	assert.Empty(t, readHeader.Load(), "the metadata is only sent with the logins")
+}
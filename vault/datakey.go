@@ -0,0 +1,248 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"encoding/base64"
+	"path"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/spf13/cast"
+	"golang.org/x/sync/singleflight"
+)
+
+// DataKey is a key generated by the transit engine for envelope encryption.
+type DataKey struct {
+	// Plaintext is the key used to encrypt data locally, it should never be stored.
+	Plaintext []byte
+	// Ciphertext is the key encrypted with the transit key, store it next to the encrypted data
+	// to be able to decrypt the data later with Transit.Decrypt.
+	Ciphertext string
+}
+
+// GenerateDataKey generates a new data key encrypted with the given transit key
+// ref: https://developer.hashicorp.com/vault/api-docs/secret/transit#generate-data-key
+func (t *Transit) GenerateDataKey(transitPath, keyID string) (*DataKey, error) {
+	return t.GenerateDataKeyWithContext(context.Background(), transitPath, keyID)
+}
+
+// GenerateDataKeyWithContext works like GenerateDataKey, but the request is cancelled once ctx is done.
+func (t *Transit) GenerateDataKeyWithContext(ctx context.Context, transitPath, keyID string) (*DataKey, error) {
+	if len(transitPath) == 0 {
+		// Rewrite to default if not defined, all examples from documentation
+		// uses `transit` path
+		transitPath = "transit"
+	}
+
+	release, err := t.limiter.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	out, err := t.client.Logical().WriteWithContext(ctx, path.Join(transitPath, "datakey", "plaintext", keyID), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if out == nil {
+		return nil, errors.New("empty response for data key generation")
+	}
+
+	plaintext, err := base64.StdEncoding.DecodeString(cast.ToString(out.Data["plaintext"]))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode data key")
+	}
+
+	return &DataKey{
+		Plaintext:  plaintext,
+		Ciphertext: cast.ToString(out.Data["ciphertext"]),
+	}, nil
+}
+
+// Rewrap re-encrypts the ciphertexts with the latest version of the transit key, without revealing
+// the plaintexts. The results are aligned to the input slice.
+// ref: https://developer.hashicorp.com/vault/api-docs/secret/transit#rewrap-data
+func (t *Transit) Rewrap(ctx context.Context, transitPath, keyID string, ciphertexts []string) ([]string, error) {
+	if len(transitPath) == 0 {
+		transitPath = "transit"
+	}
+
+	if len(ciphertexts) == 0 {
+		return []string{}, nil
+	}
+
+	batchInput := make([]map[string]interface{}, 0, len(ciphertexts))
+	for _, ciphertext := range ciphertexts {
+		batchInput = append(batchInput, map[string]interface{}{
+			"ciphertext": ciphertext,
+		})
+	}
+
+	release, err := t.limiter.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	out, err := t.client.Logical().WriteWithContext(
+		ctx,
+		path.Join(transitPath, "rewrap", keyID),
+		map[string]interface{}{
+			"batch_input": batchInput,
+		},
+	)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to rewrap with transit key: %s", keyID)
+	}
+
+	if out == nil {
+		return nil, errors.New("empty response for rewrap")
+	}
+
+	batchResults, ok := out.Data["batch_results"].([]interface{})
+	if !ok {
+		return nil, errors.New("batch_results not found in transit response")
+	}
+
+	if len(batchResults) != len(ciphertexts) {
+		return nil, errors.Errorf("expected %d batch results, got %d", len(ciphertexts), len(batchResults))
+	}
+
+	rewrapped := make([]string, len(ciphertexts))
+	for k, val := range batchResults {
+		result := cast.ToStringMapString(val)
+		if result["error"] != "" {
+			return nil, errors.Errorf("failed to rewrap batch item %d: %s", k, result["error"])
+		}
+
+		rewrapped[k] = result["ciphertext"]
+	}
+
+	return rewrapped, nil
+}
+
+// DataKeyCache caches a data key to save transit round-trips, and generates a new one
+// once the key reached its maximum age or number of uses.
+// Data encrypted with earlier keys stays decryptable with their stored Ciphertext,
+// which can be moved to the latest version of the transit key with Rewrap after the transit key is rotated.
+type DataKeyCache struct {
+	maxAge   time.Duration
+	maxUses  int
+	generate func(ctx context.Context) (*DataKey, error)
+	rewrap   func(ctx context.Context, ciphertexts []string) ([]string, error)
+
+	// generating shares the generation of a new key between the concurrent callers of Get
+	generating singleflight.Group
+
+	mu        sync.Mutex
+	current   *DataKey
+	createdAt time.Time
+	uses      int
+	// generation is incremented whenever the key is replaced or dropped
+	generation int
+}
+
+// DataKeyCache creates a data key cache for the given transit key.
+// A zero maxAge or maxUses means no limit of that kind.
+func (t *Transit) DataKeyCache(transitPath, keyID string, maxAge time.Duration, maxUses int) *DataKeyCache {
+	return &DataKeyCache{
+		maxAge:  maxAge,
+		maxUses: maxUses,
+		generate: func(ctx context.Context) (*DataKey, error) {
+			return t.GenerateDataKeyWithContext(ctx, transitPath, keyID)
+		},
+		rewrap: func(ctx context.Context, ciphertexts []string) ([]string, error) {
+			return t.Rewrap(ctx, transitPath, keyID, ciphertexts)
+		},
+	}
+}
+
+// Get returns the current data key, generating a new one if it's expired. Every call counts as a use.
+func (c *DataKeyCache) Get() (*DataKey, error) {
+	return c.GetWithContext(context.Background())
+}
+
+// GetWithContext works like Get, but stops waiting for a new key once ctx is done.
+// The key is generated without holding the lock of the cache, and only once for the concurrent callers.
+func (c *DataKeyCache) GetWithContext(ctx context.Context) (*DataKey, error) {
+	for {
+		c.mu.Lock()
+		expired := c.current == nil ||
+			(c.maxAge > 0 && time.Since(c.createdAt) >= c.maxAge) ||
+			(c.maxUses > 0 && c.uses >= c.maxUses)
+
+		if !expired {
+			c.uses++
+			key := c.current
+			c.mu.Unlock()
+
+			return key, nil
+		}
+
+		generation := c.generation
+		c.mu.Unlock()
+
+		// the generation is shared, so it isn't cancelled with the context of the caller which started it
+		results := c.generating.DoChan("", func() (interface{}, error) {
+			key, err := c.generate(context.WithoutCancel(ctx))
+			if err != nil {
+				return nil, err
+			}
+
+			c.mu.Lock()
+			if c.generation == generation {
+				c.current = key
+				c.createdAt = time.Now()
+				c.uses = 0
+				c.generation++
+			}
+			c.mu.Unlock()
+
+			return nil, nil
+		})
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case result := <-results:
+			if result.Err != nil {
+				return nil, errors.Wrap(result.Err, "failed to generate data key")
+			}
+		}
+
+		// take a use of the new key, another one is generated if the concurrent callers used it up meanwhile
+	}
+}
+
+// Rotate drops the current data key, so the next Get generates a new one.
+func (c *DataKeyCache) Rotate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.current = nil
+	c.generation++
+}
+
+// Rewrap re-wraps the stored ciphertexts of earlier data keys with the latest version of the transit key,
+// so the data encrypted with them stays decryptable once the old versions of the transit key are retired
+// (its min_decryption_version is raised). Store the returned ciphertexts in place of the old ones.
+// The data itself isn't re-encrypted, since the plaintext data keys don't change.
+func (c *DataKeyCache) Rewrap(ctx context.Context, ciphertexts []string) ([]string, error) {
+	return c.rewrap(ctx, ciphertexts)
+}
@@ -0,0 +1,169 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	vaultapi "github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDataKeyCache(t *testing.T) {
+	generated := 0
+	cache := &DataKeyCache{
+		maxAge:  time.Hour,
+		maxUses: 2,
+		generate: func(context.Context) (*DataKey, error) {
+			generated++
+
+			return &DataKey{Ciphertext: fmt.Sprintf("vault:v1:%d", generated)}, nil
+		},
+	}
+
+	keys := []string{}
+	for range 5 {
+		key, err := cache.Get()
+		require.NoError(t, err)
+		keys = append(keys, key.Ciphertext)
+	}
+
+	assert.Equal(t, []string{"vault:v1:1", "vault:v1:1", "vault:v1:2", "vault:v1:2", "vault:v1:3"}, keys)
+
+	// expire by age
+	cache.createdAt = time.Now().Add(-2 * time.Hour)
+	key, err := cache.Get()
+	require.NoError(t, err)
+	assert.Equal(t, "vault:v1:4", key.Ciphertext)
+
+	cache.Rotate()
+	key, err = cache.Get()
+	require.NoError(t, err)
+	assert.Equal(t, "vault:v1:5", key.Ciphertext)
+}
+
+func TestDataKeyCacheConcurrentGet(t *testing.T) {
+	var generated atomic.Int32
+	unblock := make(chan struct{})
+	cache := &DataKeyCache{
+		generate: func(context.Context) (*DataKey, error) {
+			<-unblock
+
+			return &DataKey{Ciphertext: fmt.Sprintf("vault:v1:%d", generated.Add(1))}, nil
+		},
+	}
+
+	// a caller stops waiting for the slow generation once its context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := cache.GetWithContext(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	var wg sync.WaitGroup
+	keys := make([]string, 5)
+	for i := range keys {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			key, err := cache.Get()
+			assert.NoError(t, err)
+			keys[i] = key.Ciphertext
+		}()
+	}
+
+	close(unblock)
+	wg.Wait()
+
+	assert.EqualValues(t, 1, generated.Load(), "the concurrent callers should share the generation")
+	assert.Equal(t, []string{"vault:v1:1", "vault:v1:1", "vault:v1:1", "vault:v1:1", "vault:v1:1"}, keys)
+}
+
+func TestDataKeyRewrap(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+
+		switch r.URL.Path {
+		case "/v1/transit/datakey/plaintext/app":
+			fmt.Fprint(w, `{"data": {"plaintext": "a2V5", "ciphertext": "vault:v1:key"}}`)
+		case "/v1/transit/rewrap/app":
+			var body struct {
+				BatchInput []struct {
+					Ciphertext string `json:"ciphertext"`
+				} `json:"batch_input"`
+			}
+			if !assert.NoError(t, json.NewDecoder(r.Body).Decode(&body)) {
+				w.WriteHeader(http.StatusBadRequest)
+
+				return
+			}
+
+			results := make([]map[string]string, 0, len(body.BatchInput))
+			for _, input := range body.BatchInput {
+				if input.Ciphertext == "garbage" {
+					results = append(results, map[string]string{"error": "invalid ciphertext: no prefix"})
+
+					continue
+				}
+				results = append(results, map[string]string{"ciphertext": "vault:v2:" + input.Ciphertext[len("vault:v1:"):]})
+			}
+			require.NoError(t, json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"batch_results": results}}))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors": []}`)
+		}
+	}))
+	defer server.Close()
+
+	config := vaultapi.DefaultConfig()
+	config.Address = server.URL
+
+	rawClient, err := vaultapi.NewClient(config)
+	require.NoError(t, err)
+
+	client, err := NewClientFromRawClient(rawClient, ClientToken("token"))
+	require.NoError(t, err)
+	defer client.Close()
+
+	cache := client.Transit.DataKeyCache("", "app", 0, 0)
+
+	key, err := cache.GetWithContext(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, &DataKey{Plaintext: []byte("key"), Ciphertext: "vault:v1:key"}, key)
+
+	rewrapped, err := cache.Rewrap(context.Background(), []string{key.Ciphertext, "vault:v1:other"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"vault:v2:key", "vault:v2:other"}, rewrapped)
+
+	_, err = cache.Rewrap(context.Background(), []string{"vault:v1:key", "garbage"})
+	assert.EqualError(t, err, "failed to rewrap batch item 1: invalid ciphertext: no prefix")
+
+	assert.Equal(t, []string{
+		"PUT /v1/transit/datakey/plaintext/app",
+		"PUT /v1/transit/rewrap/app",
+		"PUT /v1/transit/rewrap/app",
+	}, requests)
+}
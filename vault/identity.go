@@ -0,0 +1,92 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"context"
+
+	"emperror.dev/errors"
+	"github.com/spf13/cast"
+)
+
+// Identity is the identity entity of the token used by the client.
+type Identity struct {
+	EntityID string
+	Name     string
+	Policies []string
+	Metadata map[string]string
+	Aliases  []IdentityAlias
+}
+
+// IdentityAlias is an alias of an identity entity, one per auth method the entity logged in with.
+type IdentityAlias struct {
+	ID            string
+	Name          string
+	MountAccessor string
+	MountPath     string
+	MountType     string
+	Metadata      map[string]string
+}
+
+// Identity looks up the identity entity of the token used by the client, including its aliases and metadata.
+// The token needs to be allowed to read its own entity from the identity secrets engine.
+// ref: https://developer.hashicorp.com/vault/api-docs/secret/identity/entity#read-entity-by-id
+func (client *Client) Identity(ctx context.Context) (*Identity, error) {
+	tokenInfo, err := client.TokenInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if tokenInfo.EntityID == "" {
+		return nil, errors.New("Vault token has no identity entity")
+	}
+
+	release, err := client.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	secret, err := client.client.Logical().ReadWithContext(ctx, "identity/entity/id/"+tokenInfo.EntityID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read Vault identity entity")
+	}
+
+	if secret == nil || secret.Data == nil {
+		return nil, errors.Errorf("Vault identity entity not found: %s", tokenInfo.EntityID)
+	}
+
+	identity := &Identity{
+		EntityID: tokenInfo.EntityID,
+		Name:     cast.ToString(secret.Data["name"]),
+		Policies: cast.ToStringSlice(secret.Data["policies"]),
+		Metadata: cast.ToStringMapString(secret.Data["metadata"]),
+	}
+
+	for _, rawAlias := range cast.ToSlice(secret.Data["aliases"]) {
+		alias := cast.ToStringMap(rawAlias)
+
+		identity.Aliases = append(identity.Aliases, IdentityAlias{
+			ID:            cast.ToString(alias["id"]),
+			Name:          cast.ToString(alias["name"]),
+			MountAccessor: cast.ToString(alias["mount_accessor"]),
+			MountPath:     cast.ToString(alias["mount_path"]),
+			MountType:     cast.ToString(alias["mount_type"]),
+			Metadata:      cast.ToStringMapString(alias["metadata"]),
+		})
+	}
+
+	return identity, nil
+}
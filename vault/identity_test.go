@@ -0,0 +1,74 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	vaultapi "github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdentity(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/auth/token/lookup-self":
+			fmt.Fprint(w, `{"data": {"accessor": "accessor", "policies": ["default"], "ttl": 3600, "renewable": true, "entity_id": "entity-1"}}`)
+		case "/v1/identity/entity/id/entity-1":
+			fmt.Fprint(w, `{"data": {
+				"name": "app",
+				"policies": ["app"],
+				"metadata": {"team": "payments"},
+				"aliases": [{"id": "alias-1", "name": "app-sa", "mount_accessor": "auth_kubernetes_1", "mount_path": "auth/kubernetes/", "mount_type": "kubernetes", "metadata": {"service_account_namespace": "default"}}]
+			}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors": []}`)
+		}
+	}))
+	defer server.Close()
+
+	config := vaultapi.DefaultConfig()
+	config.Address = server.URL
+
+	rawClient, err := vaultapi.NewClient(config)
+	require.NoError(t, err)
+
+	client, err := NewClientFromRawClient(rawClient, ClientToken("token"))
+	require.NoError(t, err)
+	defer client.Close()
+
+	identity, err := client.Identity(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, &Identity{
+		EntityID: "entity-1",
+		Name:     "app",
+		Policies: []string{"app"},
+		Metadata: map[string]string{"team": "payments"},
+		Aliases: []IdentityAlias{{
+			ID:            "alias-1",
+			Name:          "app-sa",
+			MountAccessor: "auth_kubernetes_1",
+			MountPath:     "auth/kubernetes/",
+			MountType:     "kubernetes",
+			Metadata:      map[string]string{"service_account_namespace": "default"},
+		}},
+	}, identity)
+}
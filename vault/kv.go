@@ -0,0 +1,98 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"emperror.dev/errors"
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+// ReadKVInto reads the latest version of a KV version 2 secret (e.g. mount "secret", path "app/db")
+// and unmarshals its data into dest, which has to be a pointer (e.g. to a struct with json tags).
+// The data is converted with a JSON round-trip, so the usual encoding/json rules apply to dest.
+func (client *Client) ReadKVInto(ctx context.Context, mount, path string, dest interface{}) error {
+	secret, err := client.readKV(ctx, mount, path)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(secret.Data)
+	if err != nil {
+		return errors.Wrapf(err, "failed to encode KV secret %s/%s", mount, path)
+	}
+
+	if err := json.Unmarshal(data, dest); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return errors.Errorf("KV secret %s/%s: field %s can't be set from a %s value, it's a %s", mount, path, typeErr.Field, typeErr.Value, typeErr.Type)
+		}
+
+		return errors.Wrapf(err, "failed to decode KV secret %s/%s", mount, path)
+	}
+
+	return nil
+}
+
+// MissingKeysError means that a KV secret doesn't contain some of the required keys.
+type MissingKeysError struct {
+	Path string
+	Keys []string
+}
+
+func (e *MissingKeysError) Error() string {
+	return fmt.Sprintf("KV secret %s is missing the required keys: %s", e.Path, strings.Join(e.Keys, ", "))
+}
+
+// ReadKVRequiring reads the latest version of a KV version 2 secret like ReadKVInto, and returns its data
+// if it contains all requiredKeys, otherwise a MissingKeysError listing the absent ones.
+func (client *Client) ReadKVRequiring(ctx context.Context, mount, path string, requiredKeys []string) (map[string]interface{}, error) {
+	secret, err := client.readKV(ctx, mount, path)
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	for _, key := range requiredKeys {
+		if _, ok := secret.Data[key]; !ok {
+			missing = append(missing, key)
+		}
+	}
+
+	if len(missing) > 0 {
+		return nil, &MissingKeysError{Path: mount + "/" + path, Keys: missing}
+	}
+
+	return secret.Data, nil
+}
+
+func (client *Client) readKV(ctx context.Context, mount, path string) (*vaultapi.KVSecret, error) {
+	release, err := client.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	secret, err := client.client.KVv2(mount).Get(ctx, path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read KV secret %s/%s", mount, path)
+	}
+
+	return secret, nil
+}
@@ -0,0 +1,108 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	vaultapi "github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadKVInto(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/secret/data/app/db":
+			fmt.Fprint(w, `{"data": {"data": {"host": "db.internal", "port": 5432, "tls": true}, "metadata": {"version": 3}}}`)
+		case "/v1/secret/data/app/invalid":
+			fmt.Fprint(w, `{"data": {"data": {"host": "db.internal", "port": "postgres"}, "metadata": {"version": 1}}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors": []}`)
+		}
+	}))
+	defer server.Close()
+
+	config := vaultapi.DefaultConfig()
+	config.Address = server.URL
+
+	rawClient, err := vaultapi.NewClient(config)
+	require.NoError(t, err)
+
+	client, err := NewClientFromRawClient(rawClient, ClientToken("token"))
+	require.NoError(t, err)
+	defer client.Close()
+
+	type database struct {
+		Host string `json:"host"`
+		Port int    `json:"port"`
+		TLS  bool   `json:"tls"`
+	}
+
+	var db database
+	require.NoError(t, client.ReadKVInto(context.Background(), "secret", "app/db", &db))
+	assert.Equal(t, database{Host: "db.internal", Port: 5432, TLS: true}, db)
+
+	err = client.ReadKVInto(context.Background(), "secret", "app/invalid", &db)
+	assert.EqualError(t, err, "KV secret secret/app/invalid: field port can't be set from a string value, it's a int")
+
+	err = client.ReadKVInto(context.Background(), "secret", "app/missing", &db)
+	assert.ErrorContains(t, err, "failed to read KV secret secret/app/missing")
+}
+
+func TestReadKVRequiring(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/secret/data/app/db" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors": []}`)
+
+			return
+		}
+
+		fmt.Fprint(w, `{"data": {"data": {"host": "db.internal", "port": 5432}, "metadata": {"version": 3}}}`)
+	}))
+	defer server.Close()
+
+	config := vaultapi.DefaultConfig()
+	config.Address = server.URL
+
+	rawClient, err := vaultapi.NewClient(config)
+	require.NoError(t, err)
+
+	client, err := NewClientFromRawClient(rawClient, ClientToken("token"))
+	require.NoError(t, err)
+	defer client.Close()
+
+	ctx := context.Background()
+
+	data, err := client.ReadKVRequiring(ctx, "secret", "app/db", []string{"host", "port"})
+	require.NoError(t, err)
+	assert.Equal(t, "db.internal", data["host"])
+
+	_, err = client.ReadKVRequiring(ctx, "secret", "app/db", []string{"user", "host", "password"})
+
+	var missing *MissingKeysError
+	require.ErrorAs(t, err, &missing)
+	assert.Equal(t, []string{"user", "password"}, missing.Keys)
+	assert.EqualError(t, err, "KV secret secret/app/db is missing the required keys: user, password")
+
+	_, err = client.ReadKVRequiring(ctx, "secret", "app/missing", []string{"host"})
+	assert.ErrorContains(t, err, "failed to read KV secret secret/app/missing")
+}
@@ -0,0 +1,84 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/spf13/cast"
+)
+
+// LeaseInfo describes a lease, as returned by sys/leases/lookup.
+type LeaseInfo struct {
+	ID        string
+	Renewable bool
+	// TTL is the remaining time to live of the lease.
+	TTL time.Duration
+	// IssueTime is when the lease was created, ExpireTime is when it expires.
+	IssueTime  time.Time
+	ExpireTime time.Time
+	// LastRenewal is the time of the last renewal, zero if the lease was never renewed.
+	LastRenewal time.Time
+}
+
+// LookupLease returns the current state of a lease, e.g. to check its remaining TTL and whether it's renewable
+// before starting to renew it.
+// ref: https://developer.hashicorp.com/vault/api-docs/system/leases#read-lease
+func (client *Client) LookupLease(ctx context.Context, leaseID string) (*LeaseInfo, error) {
+	release, err := client.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	secret, err := client.client.Logical().WriteWithContext(ctx, "sys/leases/lookup", map[string]interface{}{"lease_id": leaseID})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to look up lease: %s", leaseID)
+	}
+
+	if secret == nil || secret.Data == nil {
+		return nil, errors.Errorf("no data found for lease: %s", leaseID)
+	}
+
+	ttl, err := cast.ToInt64E(secret.Data["ttl"])
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid lease TTL")
+	}
+
+	info := &LeaseInfo{
+		ID:        cast.ToString(secret.Data["id"]),
+		Renewable: cast.ToBool(secret.Data["renewable"]),
+		TTL:       time.Duration(ttl) * time.Second,
+	}
+
+	for field, t := range map[string]*time.Time{
+		"issue_time":   &info.IssueTime,
+		"expire_time":  &info.ExpireTime,
+		"last_renewal": &info.LastRenewal,
+	} {
+		value := cast.ToString(secret.Data[field])
+		if value == "" {
+			continue
+		}
+
+		if *t, err = time.Parse(time.RFC3339Nano, value); err != nil {
+			return nil, errors.Wrapf(err, "invalid lease %s", field)
+		}
+	}
+
+	return info, nil
+}
@@ -0,0 +1,78 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	vaultapi "github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookupLease(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			LeaseID string `json:"lease_id"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+
+		if r.Method != http.MethodPut || r.URL.Path != "/v1/sys/leases/lookup" || body.LeaseID != "database/creds/app/1" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"errors": ["invalid lease ID"]}`)
+
+			return
+		}
+
+		fmt.Fprint(w, `{"data": {
+			"id": "database/creds/app/1",
+			"issue_time": "2024-01-02T15:04:05.123456Z",
+			"expire_time": "2024-01-02T16:04:05.123456Z",
+			"last_renewal": null,
+			"renewable": true,
+			"ttl": 3599
+		}}`)
+	}))
+	defer server.Close()
+
+	config := vaultapi.DefaultConfig()
+	config.Address = server.URL
+
+	rawClient, err := vaultapi.NewClient(config)
+	require.NoError(t, err)
+
+	client, err := NewClientFromRawClient(rawClient, ClientToken("token"))
+	require.NoError(t, err)
+	defer client.Close()
+
+	info, err := client.LookupLease(context.Background(), "database/creds/app/1")
+	require.NoError(t, err)
+	assert.Equal(t, &LeaseInfo{
+		ID:         "database/creds/app/1",
+		Renewable:  true,
+		TTL:        3599 * time.Second,
+		IssueTime:  time.Date(2024, 1, 2, 15, 4, 5, 123456000, time.UTC),
+		ExpireTime: time.Date(2024, 1, 2, 16, 4, 5, 123456000, time.UTC),
+	}, info)
+
+	_, err = client.LookupLease(context.Background(), "database/creds/app/2")
+	assert.ErrorContains(t, err, "failed to look up lease: database/creds/app/2")
+}
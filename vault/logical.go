@@ -0,0 +1,47 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"net/http"
+
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+// ReadWithHeaders reads a secret like Logical().ReadWithData, and returns the HTTP response headers next to it
+// (e.g. to see which node of an HA cluster served the request). The headers are nil if no response arrived.
+// The response is limited to ClientMaxResponseSize.
+func (client *Client) ReadWithHeaders(ctx context.Context, path string, data map[string][]string) (*vaultapi.Secret, http.Header, error) {
+	release, err := client.Acquire(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer release()
+
+	resp, err := client.client.Logical().ReadRawWithDataWithContext(ctx, path, data)
+	if limitErr := client.LimitResponseSize(resp); limitErr != nil {
+		return nil, nil, limitErr
+	}
+
+	var header http.Header
+	if resp != nil {
+		header = resp.Header
+	}
+
+	secret, err := client.client.Logical().ParseRawResponseAndCloseBody(resp, err)
+
+	return secret, header, err
+}
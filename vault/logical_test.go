@@ -0,0 +1,63 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	vaultapi "github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadWithHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/secret/missing" {
+			w.Header().Set("X-Vault-Node", "vault-1")
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors": []}`)
+
+			return
+		}
+
+		w.Header().Set("X-Vault-Node", "vault-0")
+		fmt.Fprint(w, `{"data": {"password": "secret"}}`)
+	}))
+	defer server.Close()
+
+	config := vaultapi.DefaultConfig()
+	config.Address = server.URL
+
+	rawClient, err := vaultapi.NewClient(config)
+	require.NoError(t, err)
+
+	client, err := NewClientFromRawClient(rawClient, ClientToken("token"))
+	require.NoError(t, err)
+	defer client.Close()
+
+	secret, header, err := client.ReadWithHeaders(context.Background(), "secret/app", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "secret", secret.Data["password"])
+	assert.Equal(t, "vault-0", header.Get("X-Vault-Node"))
+
+	secret, header, err = client.ReadWithHeaders(context.Background(), "secret/missing", nil)
+	require.NoError(t, err)
+	assert.Nil(t, secret)
+	assert.Equal(t, "vault-1", header.Get("X-Vault-Node"))
+}
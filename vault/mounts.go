@@ -0,0 +1,177 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/spf13/cast"
+)
+
+const defaultMountCacheTTL = 5 * time.Minute
+
+// MountInfo describes the secrets engine mounted at a path.
+type MountInfo struct {
+	// Path is the mount path with a trailing slash (e.g. secret/).
+	Path string
+	// Type is the engine type (e.g. kv, transit, database).
+	Type string
+	// Version is the version of a KV engine (1 or 2), 0 for other engines.
+	Version int
+	Options map[string]string
+}
+
+// MountInfo returns the secrets engine mounted at path, or at the mount containing path (e.g. secret/data/app).
+// The results are cached for the duration set with ClientMountCacheTTL.
+// It uses the sys/internal/ui/mounts endpoint, which every token may read for the paths it has access to.
+// ref: https://developer.hashicorp.com/vault/api-docs/system/internal-ui-mounts
+func (client *Client) MountInfo(ctx context.Context, path string) (*MountInfo, error) {
+	path = strings.Trim(path, "/")
+
+	if info, ok := client.mounts.get(path); ok {
+		return info, nil
+	}
+
+	release, err := client.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	secret, err := client.client.Logical().ReadWithContext(ctx, "sys/internal/ui/mounts/"+path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to look up mount of path: %s", path)
+	}
+
+	if secret == nil || secret.Data == nil {
+		return nil, errors.Errorf("no mount found for path: %s", path)
+	}
+
+	info := &MountInfo{
+		Path:    cast.ToString(secret.Data["path"]),
+		Type:    cast.ToString(secret.Data["type"]),
+		Options: cast.ToStringMapString(secret.Data["options"]),
+	}
+
+	if info.Type == "kv" || info.Type == "generic" {
+		info.Version = 1
+		if info.Options["version"] == "2" {
+			info.Version = 2
+		}
+	}
+
+	client.mounts.add(info)
+
+	return info, nil
+}
+
+// InvalidateMountInfo drops the cached mount containing path, or all cached mounts if path is empty,
+// e.g. after a mount was tuned or moved.
+func (client *Client) InvalidateMountInfo(path string) {
+	client.mounts.invalidate(strings.Trim(path, "/"))
+}
+
+type mountCacheEntry struct {
+	info      *MountInfo
+	expiresAt time.Time
+}
+
+// mountCache caches the mounts by their path, nil means no caching.
+type mountCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]mountCacheEntry
+}
+
+func newMountCache(ttl time.Duration) *mountCache {
+	if ttl < 0 {
+		return nil
+	}
+
+	if ttl == 0 {
+		ttl = defaultMountCacheTTL
+	}
+
+	return &mountCache{ttl: ttl, entries: map[string]mountCacheEntry{}}
+}
+
+// lookup returns the path of the cached mount containing path, the longest one if they are nested.
+func (c *mountCache) lookup(path string) (string, bool) {
+	found := ""
+	for mountPath := range c.entries {
+		if strings.HasPrefix(path+"/", mountPath) && len(mountPath) > len(found) {
+			found = mountPath
+		}
+	}
+
+	return found, found != ""
+}
+
+func (c *mountCache) get(path string) (*MountInfo, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	mountPath, ok := c.lookup(path)
+	if !ok {
+		return nil, false
+	}
+
+	entry := c.entries[mountPath]
+	if time.Now().After(entry.expiresAt) {
+		delete(c.entries, mountPath)
+
+		return nil, false
+	}
+
+	return entry.info, true
+}
+
+func (c *mountCache) add(info *MountInfo) {
+	if c == nil || info.Path == "" {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[info.Path] = mountCacheEntry{info: info, expiresAt: time.Now().Add(c.ttl)}
+}
+
+func (c *mountCache) invalidate(path string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if path == "" {
+		clear(c.entries)
+
+		return
+	}
+
+	if mountPath, ok := c.lookup(path); ok {
+		delete(c.entries, mountPath)
+	}
+}
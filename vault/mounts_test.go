@@ -0,0 +1,106 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	vaultapi "github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMountInfo(t *testing.T) {
+	var lookups atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lookups.Add(1)
+
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/v1/sys/internal/ui/mounts/secret"):
+			fmt.Fprint(w, `{"data": {"path": "secret/", "type": "kv", "options": {"version": "2"}}}`)
+		case strings.HasPrefix(r.URL.Path, "/v1/sys/internal/ui/mounts/transit"):
+			fmt.Fprint(w, `{"data": {"path": "transit/", "type": "transit", "options": null}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors": []}`)
+		}
+	}))
+	defer server.Close()
+
+	config := vaultapi.DefaultConfig()
+	config.Address = server.URL
+
+	rawClient, err := vaultapi.NewClient(config)
+	require.NoError(t, err)
+
+	client, err := NewClientFromRawClient(rawClient, ClientToken("token"))
+	require.NoError(t, err)
+	defer client.Close()
+
+	ctx := context.Background()
+
+	info, err := client.MountInfo(ctx, "secret/data/app")
+	require.NoError(t, err)
+	assert.Equal(t, &MountInfo{Path: "secret/", Type: "kv", Version: 2, Options: map[string]string{"version": "2"}}, info)
+
+	// served from the cache
+	info, err = client.MountInfo(ctx, "/secret/data/other/")
+	require.NoError(t, err)
+	assert.Equal(t, 2, info.Version)
+	assert.Equal(t, int32(1), lookups.Load())
+
+	info, err = client.MountInfo(ctx, "transit/decrypt/key")
+	require.NoError(t, err)
+	assert.Equal(t, "transit", info.Type)
+	assert.Equal(t, 0, info.Version)
+	assert.Equal(t, int32(2), lookups.Load())
+
+	client.InvalidateMountInfo("secret/data/app")
+
+	_, err = client.MountInfo(ctx, "secret/data/app")
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), lookups.Load())
+
+	_, err = client.MountInfo(ctx, "missing/path")
+	assert.ErrorContains(t, err, "no mount found for path: missing/path")
+}
+
+func TestMountCacheTTL(t *testing.T) {
+	assert.Nil(t, newMountCache(-1))
+
+	cache := newMountCache(time.Millisecond)
+	cache.add(&MountInfo{Path: "secret/", Type: "kv"})
+	cache.add(&MountInfo{Path: "secret/nested/", Type: "kv"})
+
+	info, ok := cache.get("secret/nested/data/app")
+	require.True(t, ok)
+	assert.Equal(t, "secret/nested/", info.Path)
+
+	_, ok = cache.get("secrets/app")
+	assert.False(t, ok)
+
+	time.Sleep(2 * time.Millisecond)
+
+	_, ok = cache.get("secret/app")
+	assert.False(t, ok)
+}
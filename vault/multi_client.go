@@ -0,0 +1,264 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+const defaultMultiClientRecoveryInterval = 30 * time.Second
+
+type multiClientOptions struct {
+	retryWrites      bool
+	recoveryInterval time.Duration
+}
+
+// MultiClientOption configures a MultiClient using the functional options paradigm.
+type MultiClientOption interface {
+	apply(o *multiClientOptions)
+}
+
+// MultiClientRetryWrites enables retrying failed writes against the other clusters.
+// Writes are only sent to the preferred cluster by default, since they aren't necessarily idempotent.
+type MultiClientRetryWrites bool
+
+func (co MultiClientRetryWrites) apply(o *multiClientOptions) {
+	o.retryWrites = bool(co)
+}
+
+// MultiClientRecoveryInterval is the time after which a failed cluster is preferred again.
+type MultiClientRecoveryInterval time.Duration
+
+func (co MultiClientRecoveryInterval) apply(o *multiClientOptions) {
+	o.recoveryInterval = time.Duration(co)
+}
+
+// MultiClient wraps clients of several Vault clusters (e.g. a primary and a DR secondary)
+// and transparently retries a failed request against the next healthy cluster.
+type MultiClient struct {
+	clients []*Client
+	options multiClientOptions
+
+	mu       sync.Mutex
+	failedAt []time.Time
+}
+
+// NewMultiClient creates a new MultiClient, the clients are preferred in the given order.
+func NewMultiClient(clients []*Client, opts ...MultiClientOption) (*MultiClient, error) {
+	if len(clients) == 0 {
+		return nil, errors.New("at least one Vault client is required")
+	}
+
+	o := multiClientOptions{}
+	for _, opt := range opts {
+		opt.apply(&o)
+	}
+
+	if o.recoveryInterval == 0 {
+		o.recoveryInterval = defaultMultiClientRecoveryInterval
+	}
+
+	return &MultiClient{
+		clients:  clients,
+		options:  o,
+		failedAt: make([]time.Time, len(clients)),
+	}, nil
+}
+
+// Clients returns the underlying clients in the configured order.
+func (m *MultiClient) Clients() []*Client {
+	return m.clients
+}
+
+// Read reads a secret from the first healthy cluster, failing over to the rest.
+func (m *MultiClient) Read(path string) (*vaultapi.Secret, error) {
+	return m.ReadWithContext(context.Background(), path)
+}
+
+// ReadWithContext works like Read, but the request is cancelled once ctx is done.
+func (m *MultiClient) ReadWithContext(ctx context.Context, path string) (*vaultapi.Secret, error) {
+	return m.ReadWithDataWithContext(ctx, path, nil)
+}
+
+// ReadWithData reads a secret with query parameters from the first healthy cluster, failing over to the rest.
+func (m *MultiClient) ReadWithData(path string, data map[string][]string) (*vaultapi.Secret, error) {
+	return m.ReadWithDataWithContext(context.Background(), path, data)
+}
+
+// ReadWithDataWithContext works like ReadWithData, but the request is cancelled once ctx is done.
+func (m *MultiClient) ReadWithDataWithContext(ctx context.Context, path string, data map[string][]string) (*vaultapi.Secret, error) {
+	var secret *vaultapi.Secret
+
+	err := m.do(ctx, true, func(client *Client) error {
+		release, err := client.Acquire(ctx)
+		if err != nil {
+			return err
+		}
+		defer release()
+
+		secret, err = client.RawClient().Logical().ReadWithDataWithContext(ctx, path, data)
+
+		return err
+	})
+
+	return secret, err
+}
+
+// Write writes data to the first healthy cluster.
+// It only fails over to the rest of the clusters if MultiClientRetryWrites is enabled.
+func (m *MultiClient) Write(path string, data map[string]interface{}) (*vaultapi.Secret, error) {
+	return m.WriteWithContext(context.Background(), path, data)
+}
+
+// WriteWithContext works like Write, but the request is cancelled once ctx is done.
+func (m *MultiClient) WriteWithContext(ctx context.Context, path string, data map[string]interface{}) (*vaultapi.Secret, error) {
+	var secret *vaultapi.Secret
+
+	err := m.do(ctx, m.options.retryWrites, func(client *Client) error {
+		release, err := client.Acquire(ctx)
+		if err != nil {
+			return err
+		}
+		defer release()
+
+		secret, err = client.RawClient().Logical().WriteWithContext(ctx, path, data)
+
+		return err
+	})
+
+	return secret, err
+}
+
+// Decrypt decrypts the ciphertext with the first healthy cluster, failing over to the rest.
+func (m *MultiClient) Decrypt(transitPath, keyID string, ciphertext []byte) ([]byte, error) {
+	return m.DecryptWithContext(context.Background(), transitPath, keyID, ciphertext)
+}
+
+// DecryptWithContext works like Decrypt, but the request is cancelled once ctx is done.
+func (m *MultiClient) DecryptWithContext(ctx context.Context, transitPath, keyID string, ciphertext []byte) ([]byte, error) {
+	var plaintext []byte
+
+	err := m.do(ctx, true, func(client *Client) error {
+		var err error
+		plaintext, err = client.Transit.DecryptWithContext(ctx, transitPath, keyID, ciphertext)
+
+		return err
+	})
+
+	return plaintext, err
+}
+
+// DecryptBatch decrypts the ciphertexts with the first healthy cluster, failing over to the rest.
+func (m *MultiClient) DecryptBatch(transitPath, keyID string, ciphertexts []string) (map[string][]byte, error) {
+	return m.DecryptBatchWithContext(context.Background(), transitPath, keyID, ciphertexts)
+}
+
+// DecryptBatchWithContext works like DecryptBatch, but the request is cancelled once ctx is done.
+func (m *MultiClient) DecryptBatchWithContext(ctx context.Context, transitPath, keyID string, ciphertexts []string) (map[string][]byte, error) {
+	var plaintexts map[string][]byte
+
+	err := m.do(ctx, true, func(client *Client) error {
+		var err error
+		plaintexts, err = client.Transit.DecryptBatchWithContext(ctx, transitPath, keyID, ciphertexts)
+
+		return err
+	})
+
+	return plaintexts, err
+}
+
+// Close closes all the underlying clients.
+func (m *MultiClient) Close() {
+	for _, client := range m.clients {
+		client.Close()
+	}
+}
+
+// do runs fn with the clients in order, until it succeeds. Only the failures of a cluster (see isClusterFailure)
+// mark it unhealthy and fail over to the next one, the other errors (e.g. permission denied) are returned as they are.
+func (m *MultiClient) do(ctx context.Context, failover bool, fn func(client *Client) error) error {
+	var errs error
+
+	for _, i := range m.order() {
+		err := fn(m.clients[i])
+		if err == nil {
+			m.mu.Lock()
+			m.failedAt[i] = time.Time{}
+			m.mu.Unlock()
+
+			return nil
+		}
+
+		errs = errors.Append(errs, err)
+
+		if ctx.Err() != nil || !isClusterFailure(err) {
+			break
+		}
+
+		m.mu.Lock()
+		m.failedAt[i] = time.Now()
+		m.mu.Unlock()
+
+		if !failover {
+			break
+		}
+
+		m.clients[i].logger.Warn("Vault request failed, trying the next cluster", map[string]interface{}{"err": err})
+	}
+
+	return errs
+}
+
+// isClusterFailure reports if an error means that the cluster can't serve requests: it's unreachable,
+// or it responded with a server error, e.g. because it's sealed (503) or a standby (429).
+// The errors of the request itself, like 400, 403 and 404, would be the same on the other clusters.
+func isClusterFailure(err error) bool {
+	var responseErr *vaultapi.ResponseError
+	if errors.As(err, &responseErr) {
+		return responseErr.StatusCode >= http.StatusInternalServerError || responseErr.StatusCode == http.StatusTooManyRequests
+	}
+
+	var urlErr *url.Error
+	var netErr net.Error
+
+	return errors.As(err, &urlErr) || errors.As(err, &netErr)
+}
+
+// order returns the client indexes with the healthy clients first, keeping the configured order otherwise.
+func (m *MultiClient) order() []int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	healthy := make([]int, 0, len(m.clients))
+	unhealthy := []int{}
+
+	for i, failedAt := range m.failedAt {
+		if failedAt.IsZero() || time.Since(failedAt) > m.options.recoveryInterval {
+			healthy = append(healthy, i)
+		} else {
+			unhealthy = append(unhealthy, i)
+		}
+	}
+
+	return append(healthy, unhealthy...)
+}
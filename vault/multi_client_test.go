@@ -0,0 +1,154 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"emperror.dev/errors"
+	vaultapi "github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMultiClientFailover(t *testing.T) {
+	primary, secondary := &Client{logger: noopLogger{}}, &Client{logger: noopLogger{}}
+
+	multiClient, err := NewMultiClient([]*Client{primary, secondary}, MultiClientRecoveryInterval(time.Hour))
+	require.NoError(t, err)
+
+	var called []*Client
+	err = multiClient.do(context.Background(), true, func(client *Client) error {
+		called = append(called, client)
+		if client == primary {
+			return &url.Error{Op: "Get", URL: "https://primary:8200", Err: errors.New("connection refused")}
+		}
+
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []*Client{primary, secondary}, called)
+
+	// The failed primary is tried last until the recovery interval passes
+	assert.Equal(t, []int{1, 0}, multiClient.order())
+
+	// Writes don't fail over by default
+	called = nil
+	err = multiClient.do(context.Background(), false, func(client *Client) error {
+		called = append(called, client)
+
+		return &url.Error{Op: "Put", URL: "https://secondary:8200", Err: errors.New("connection refused")}
+	})
+	assert.EqualError(t, err, `Put "https://secondary:8200": connection refused`)
+	assert.Equal(t, []*Client{secondary}, called)
+}
+
+// newMultiClientTestClient returns a client of a test cluster, and the counter of its requests.
+func newMultiClientTestClient(t *testing.T, handler http.HandlerFunc) (*Client, *atomic.Int32) {
+	requests := &atomic.Int32{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	config := vaultapi.DefaultConfig()
+	config.Address = server.URL
+	config.MaxRetries = 0
+
+	rawClient, err := vaultapi.NewClient(config)
+	require.NoError(t, err)
+
+	client, err := NewClientFromRawClient(rawClient, ClientToken("token"))
+	require.NoError(t, err)
+	t.Cleanup(client.Close)
+
+	return client, requests
+}
+
+func TestMultiClientReadFailover(t *testing.T) {
+	var primaryStatus atomic.Int32
+	primaryStatus.Store(http.StatusServiceUnavailable)
+
+	primary, primaryRequests := newMultiClientTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		status := int(primaryStatus.Load())
+		if status != http.StatusOK {
+			http.Error(w, `{"errors": ["primary error"]}`, status)
+
+			return
+		}
+		fmt.Fprint(w, `{"data": {"cluster": "primary"}}`)
+	})
+	secondary, secondaryRequests := newMultiClientTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `{"data": {"cluster": "secondary"}}`)
+	})
+
+	multiClient, err := NewMultiClient([]*Client{primary, secondary}, MultiClientRecoveryInterval(time.Hour))
+	require.NoError(t, err)
+
+	// a sealed primary fails over, and is tried last until it recovers
+	secret, err := multiClient.ReadWithContext(context.Background(), "secret/app")
+	require.NoError(t, err)
+	assert.Equal(t, "secondary", secret.Data["cluster"])
+	assert.Equal(t, []int{1, 0}, multiClient.order())
+	assert.EqualValues(t, 1, primaryRequests.Load())
+	assert.EqualValues(t, 1, secondaryRequests.Load())
+
+	// a permission error of the healthy cluster is returned as it is, without failing over or demoting it
+	multiClient, err = NewMultiClient([]*Client{primary, secondary}, MultiClientRecoveryInterval(time.Hour))
+	require.NoError(t, err)
+	primaryStatus.Store(http.StatusForbidden)
+
+	_, err = multiClient.Read("secret/app")
+	assert.ErrorContains(t, err, "Code: 403")
+	assert.Equal(t, []int{0, 1}, multiClient.order())
+	assert.EqualValues(t, 2, primaryRequests.Load())
+	assert.EqualValues(t, 1, secondaryRequests.Load())
+
+	primaryStatus.Store(http.StatusOK)
+
+	secret, err = multiClient.ReadWithData("secret/app", map[string][]string{"version": {"1"}})
+	require.NoError(t, err)
+	assert.Equal(t, "primary", secret.Data["cluster"])
+}
+
+func TestMultiClientWriteNoFailover(t *testing.T) {
+	primary, primaryRequests := newMultiClientTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, `{"errors": ["Vault is sealed"]}`, http.StatusServiceUnavailable)
+	})
+	secondary, secondaryRequests := newMultiClientTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `{"data": {"cluster": "secondary"}}`)
+	})
+
+	multiClient, err := NewMultiClient([]*Client{primary, secondary}, MultiClientRecoveryInterval(time.Hour))
+	require.NoError(t, err)
+
+	_, err = multiClient.WriteWithContext(context.Background(), "secret/app", map[string]interface{}{"password": "secret"})
+	assert.ErrorContains(t, err, "Code: 503")
+	assert.EqualValues(t, 1, primaryRequests.Load())
+	assert.EqualValues(t, 0, secondaryRequests.Load(), "writes don't fail over by default")
+
+	// the failed primary is demoted, so the next write goes to the secondary
+	secret, err := multiClient.Write("secret/app", map[string]interface{}{"password": "secret"})
+	require.NoError(t, err)
+	assert.Equal(t, "secondary", secret.Data["cluster"])
+}
@@ -0,0 +1,80 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"fmt"
+	"io"
+
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+// ResponseTooLargeError is returned when the body of a Vault response exceeds ClientMaxResponseSize.
+type ResponseTooLargeError struct {
+	MaxSize int64
+}
+
+func (e *ResponseTooLargeError) Error() string {
+	return fmt.Sprintf("Vault response exceeds the maximum size of %d bytes", e.MaxSize)
+}
+
+// LimitResponseSize applies ClientMaxResponseSize to a raw response (e.g. of Logical().ReadRawWithDataWithContext):
+// it fails right away if the Content-Length of the response exceeds the limit, closing the response,
+// otherwise reading the body fails once it does. It does nothing if the size is unlimited or resp is nil.
+func (client *Client) LimitResponseSize(resp *vaultapi.Response) error {
+	if client.maxResponseSize == 0 || resp == nil || resp.Response == nil || resp.Body == nil {
+		return nil
+	}
+
+	if resp.ContentLength > client.maxResponseSize {
+		_ = resp.Body.Close()
+
+		return &ResponseTooLargeError{MaxSize: client.maxResponseSize}
+	}
+
+	resp.Body = &maxSizeReader{body: resp.Body, remaining: client.maxResponseSize, maxSize: client.maxResponseSize}
+
+	return nil
+}
+
+// maxSizeReader fails once more than maxSize bytes are read from body, without reading more than maxSize+1 bytes.
+type maxSizeReader struct {
+	body      io.ReadCloser
+	remaining int64
+	maxSize   int64
+}
+
+func (r *maxSizeReader) Read(p []byte) (int, error) {
+	if r.remaining < 0 {
+		return 0, &ResponseTooLargeError{MaxSize: r.maxSize}
+	}
+
+	// read one byte more than allowed, to tell a body of exactly the maximum size from a larger one
+	if int64(len(p)) > r.remaining+1 {
+		p = p[:r.remaining+1]
+	}
+
+	n, err := r.body.Read(p)
+	r.remaining -= int64(n)
+	if r.remaining < 0 {
+		return n + int(r.remaining), &ResponseTooLargeError{MaxSize: r.maxSize}
+	}
+
+	return n, err
+}
+
+func (r *maxSizeReader) Close() error {
+	return r.body.Close()
+}
@@ -0,0 +1,91 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	vaultapi "github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaxResponseSize(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := fmt.Sprintf(`{"data": {"value": %q}}`, strings.Repeat("x", 2048))
+
+		switch r.URL.Path {
+		case "/v1/secret/small":
+			fmt.Fprint(w, `{"data": {"value": "small"}}`)
+		case "/v1/secret/large":
+			w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+			fmt.Fprint(w, body)
+		case "/v1/secret/streamed":
+			// flushing makes the response chunked, without a Content-Length
+			w.(http.Flusher).Flush()
+			fmt.Fprint(w, body)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors": []}`)
+		}
+	}))
+	defer server.Close()
+
+	config := vaultapi.DefaultConfig()
+	config.Address = server.URL
+
+	rawClient, err := vaultapi.NewClient(config)
+	require.NoError(t, err)
+
+	client, err := NewClientFromRawClient(rawClient, ClientToken("token"), ClientMaxResponseSize(1024))
+	require.NoError(t, err)
+	defer client.Close()
+
+	secret, _, err := client.ReadWithHeaders(context.Background(), "secret/small", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "small", secret.Data["value"])
+
+	for _, path := range []string{"secret/large", "secret/streamed"} {
+		_, _, err := client.ReadWithHeaders(context.Background(), path, nil)
+
+		var tooLarge *ResponseTooLargeError
+		require.ErrorAs(t, err, &tooLarge, path)
+		assert.Equal(t, int64(1024), tooLarge.MaxSize)
+	}
+
+	_, err = NewClientFromRawClient(rawClient, ClientToken("token"), ClientMaxResponseSize(-1))
+	assert.EqualError(t, err, "maximum response size can't be negative")
+}
+
+func TestMaxSizeReader(t *testing.T) {
+	for _, size := range []int{0, 10, 100, 101} {
+		reader := &maxSizeReader{body: io.NopCloser(strings.NewReader(strings.Repeat("x", size))), remaining: 100, maxSize: 100}
+
+		data, err := io.ReadAll(reader)
+		if size > 100 {
+			assert.Len(t, data, 100)
+			assert.ErrorAs(t, err, new(*ResponseTooLargeError))
+		} else {
+			assert.Len(t, data, size)
+			assert.NoError(t, err)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/spf13/cast"
+)
+
+// TokenInfo contains the details of the token used by the client.
+type TokenInfo struct {
+	Accessor  string
+	Policies  []string
+	TTL       time.Duration
+	Renewable bool
+	EntityID  string
+	// ExpireTime is when the token expires, zero if it never does (e.g. a root token)
+	ExpireTime time.Time
+}
+
+// TokenInfo looks up the token used by the client
+// ref: https://developer.hashicorp.com/vault/api-docs/auth/token#lookup-a-token-self
+func (client *Client) TokenInfo(ctx context.Context) (*TokenInfo, error) {
+	release, err := client.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	secret, err := client.client.Auth().Token().LookupSelfWithContext(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to look up Vault token")
+	}
+
+	if secret == nil || secret.Data == nil {
+		return nil, errors.New("empty response for Vault token lookup")
+	}
+
+	accessor, err := secret.TokenAccessor()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse token accessor")
+	}
+
+	policies, err := secret.TokenPolicies()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse token policies")
+	}
+
+	ttl, err := secret.TokenTTL()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse token TTL")
+	}
+
+	renewable, err := secret.TokenIsRenewable()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse token renewability")
+	}
+
+	var expireTime time.Time
+	if value := cast.ToString(secret.Data["expire_time"]); value != "" {
+		expireTime, err = time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse token expire time")
+		}
+	}
+
+	return &TokenInfo{
+		Accessor:   accessor,
+		Policies:   policies,
+		TTL:        ttl,
+		Renewable:  renewable,
+		EntityID:   cast.ToString(secret.Data["entity_id"]),
+		ExpireTime: expireTime,
+	}, nil
+}
@@ -0,0 +1,99 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	vaultapi "github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenInfo(t *testing.T) {
+	var lookup atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/auth/token/lookup-self" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors": []}`)
+
+			return
+		}
+
+		fmt.Fprint(w, lookup.Load())
+	}))
+	defer server.Close()
+
+	config := vaultapi.DefaultConfig()
+	config.Address = server.URL
+
+	rawClient, err := vaultapi.NewClient(config)
+	require.NoError(t, err)
+
+	client, err := NewClientFromRawClient(rawClient, ClientToken("token"))
+	require.NoError(t, err)
+	defer client.Close()
+
+	lookup.Store(`{"data": {
+		"accessor": "accessor",
+		"policies": ["default", "app"],
+		"identity_policies": ["team"],
+		"ttl": 3600,
+		"renewable": true,
+		"entity_id": "entity",
+		"expire_time": "2026-10-15T15:00:00.123456789Z"
+	}}`)
+
+	info, err := client.TokenInfo(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, &TokenInfo{
+		Accessor:   "accessor",
+		Policies:   []string{"default", "app", "team"},
+		TTL:        time.Hour,
+		Renewable:  true,
+		EntityID:   "entity",
+		ExpireTime: time.Date(2026, time.October, 15, 15, 0, 0, 123456789, time.UTC),
+	}, info)
+
+	// a root token never expires
+	lookup.Store(`{"data": {"accessor": "root", "policies": ["root"], "ttl": 0, "renewable": false, "expire_time": null}}`)
+
+	info, err = client.TokenInfo(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"root"}, info.Policies)
+	assert.Zero(t, info.TTL)
+	assert.True(t, info.ExpireTime.IsZero())
+
+	lookup.Store(`{"data": {"accessor": "accessor", "ttl": 3600, "expire_time": "tomorrow"}}`)
+
+	_, err = client.TokenInfo(context.Background())
+	assert.ErrorContains(t, err, "failed to parse token expire time")
+
+	lookup.Store(`{"data": {"accessor": "accessor", "ttl": "an hour"}}`)
+
+	_, err = client.TokenInfo(context.Background())
+	assert.ErrorContains(t, err, "failed to parse token TTL")
+
+	lookup.Store(`{}`)
+
+	_, err = client.TokenInfo(context.Background())
+	assert.EqualError(t, err, "empty response for Vault token lookup")
+}
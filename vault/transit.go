@@ -15,21 +15,64 @@
 package vault
 
 import (
+	"context"
 	"encoding/base64"
+	"fmt"
 	"path"
 	"regexp"
+	"strconv"
+	"strings"
 
+	"emperror.dev/errors"
 	vaultapi "github.com/hashicorp/vault/api"
+	"github.com/spf13/cast"
 )
 
 // Example: vault:v1:8SDd3WHDOjf7mq69CyCqYjBXAiQQAVZRkFM13ok481zoCmHnSeDX9vyf7w==
 // ref: https://www.vaultproject.io/docs/secrets/transit/index.html#usage
 var transitEncryptedVariable = regexp.MustCompile(`^vault:v\d+:.+$`)
 
+var transitCiphertextVersion = regexp.MustCompile(`^vault:v(\d+):`)
+
+// CiphertextTooOldError is returned when a ciphertext was encrypted with a key version below the
+// min_decryption_version of the transit key, so it can't be decrypted (or rewrapped) anymore,
+// unless the minimum decryption version of the key is lowered.
+type CiphertextTooOldError struct {
+	KeyID string
+	// Version is the key version the ciphertext was encrypted with, 0 if it's unknown.
+	Version int
+
+	err error
+}
+
+func (e *CiphertextTooOldError) Error() string {
+	return fmt.Sprintf("ciphertext version %d is below the minimum decryption version of transit key '%s': %s", e.Version, e.KeyID, e.err)
+}
+
+func (e *CiphertextTooOldError) Unwrap() error {
+	return e.err
+}
+
+// ciphertextTooOld converts the error of Vault for a too old ciphertext to a CiphertextTooOldError.
+func ciphertextTooOld(keyID, ciphertext string, err error) error {
+	if err == nil || !strings.Contains(err.Error(), "disallowed by policy (too old)") {
+		return err
+	}
+
+	tooOld := &CiphertextTooOldError{KeyID: keyID, err: err}
+	if match := transitCiphertextVersion.FindStringSubmatch(ciphertext); match != nil {
+		tooOld.Version, _ = strconv.Atoi(match[1])
+	}
+
+	return tooOld
+}
+
 // Transit is a wrapper for Transit Secret Engine
 // ref: https://www.vaultproject.io/docs/secrets/transit/index.html
 type Transit struct {
-	client *vaultapi.Client
+	client  *vaultapi.Client
+	limiter requestLimiter
+	cache   *transitCache
 }
 
 // IsEncrypted check with regexp that value encrypter by Vault transit secret engine
@@ -37,27 +80,292 @@ func (t *Transit) IsEncrypted(value string) bool {
 	return transitEncryptedVariable.MatchString(value)
 }
 
-// Decrypt decrypts the ciphertext into a plaintext
+// KeyExists checks if the transit key exists
+// ref: https://developer.hashicorp.com/vault/api-docs/secret/transit#read-key
+func (t *Transit) KeyExists(ctx context.Context, transitPath, keyID string) (bool, error) {
+	if len(transitPath) == 0 {
+		transitPath = "transit"
+	}
+
+	release, err := t.limiter.acquire(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+
+	out, err := t.client.Logical().ReadWithContext(ctx, path.Join(transitPath, "keys", keyID))
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to read transit key: %s", keyID)
+	}
+
+	return out != nil, nil
+}
+
+// IsKeyNotFound reports if the error was returned by Vault because the transit key doesn't exist.
+func IsKeyNotFound(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "encryption key not found")
+}
+
+// Decrypt decrypts the ciphertext into a plaintext.
+// A ciphertext below the minimum decryption version of the key results in a *CiphertextTooOldError.
 // ref: https://www.vaultproject.io/api/secret/transit/index.html#decrypt-data
 func (t *Transit) Decrypt(transitPath, keyID string, ciphertext []byte) ([]byte, error) {
+	return t.DecryptWithContext(context.Background(), transitPath, keyID, ciphertext)
+}
+
+// DecryptWithContext works like Decrypt, but the request is cancelled once ctx is done.
+func (t *Transit) DecryptWithContext(ctx context.Context, transitPath, keyID string, ciphertext []byte) ([]byte, error) {
 	if len(transitPath) == 0 {
 		// Rewrite to default if not defined, all examples from documentation
 		// uses `transit` path
 		transitPath = "transit"
 	}
-	out, err := t.client.Logical().Write(
+
+	cacheKey := transitCacheKey(transitPath, keyID, string(ciphertext))
+	if plaintext, ok := t.cache.get(cacheKey); ok {
+		return plaintext, nil
+	}
+
+	release, err := t.limiter.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	out, err := t.client.Logical().WriteWithContext(
+		ctx,
 		path.Join(transitPath, "decrypt", keyID),
 		map[string]interface{}{
 			"ciphertext": string(ciphertext),
 		},
 	)
+	if err != nil {
+		return nil, ciphertextTooOld(keyID, string(ciphertext), err)
+	}
+
+	plaintext, err := base64.StdEncoding.DecodeString(out.Data["plaintext"].(string))
 	if err != nil {
 		return nil, err
 	}
-	return base64.StdEncoding.DecodeString(out.Data["plaintext"].(string))
+
+	t.cache.add(cacheKey, plaintext)
+
+	return plaintext, nil
 }
 
+// DecryptBatch decrypts the ciphertexts into plaintexts keyed by their ciphertexts
 func (t *Transit) DecryptBatch(transitPath, keyID string, ciphertexts []string) (map[string][]byte, error) {
+	return t.DecryptBatchWithContext(context.Background(), transitPath, keyID, ciphertexts)
+}
+
+// DecryptBatchWithContext works like DecryptBatch, but the request is cancelled once ctx is done.
+func (t *Transit) DecryptBatchWithContext(ctx context.Context, transitPath, keyID string, ciphertexts []string) (map[string][]byte, error) {
+	if len(transitPath) == 0 {
+		transitPath = "transit"
+	}
+
+	ret := map[string][]byte{}
+
+	uncached := make([]string, 0, len(ciphertexts))
+	for _, ciphertext := range ciphertexts {
+		if plaintext, ok := t.cache.get(transitCacheKey(transitPath, keyID, ciphertext)); ok {
+			ret[ciphertext] = plaintext
+		} else {
+			uncached = append(uncached, ciphertext)
+		}
+	}
+
+	if len(uncached) == 0 {
+		return ret, nil
+	}
+
+	batchResults, err := t.decryptBatch(ctx, transitPath, keyID, uncached)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, val := range batchResults {
+		ret[uncached[k]], err = base64.StdEncoding.DecodeString(val.(map[string]interface{})["plaintext"].(string))
+		if err != nil {
+			return nil, err
+		}
+
+		t.cache.add(transitCacheKey(transitPath, keyID, uncached[k]), ret[uncached[k]])
+	}
+
+	return ret, nil
+}
+
+// DecryptBatchOrdered decrypts the ciphertexts into plaintexts aligned to the input slice,
+// so duplicate ciphertexts are kept. The returned errors are aligned the same way, a non-nil
+// error means that the ciphertext at that index couldn't be decrypted.
+func (t *Transit) DecryptBatchOrdered(transitPath, keyID string, ciphertexts []string) ([][]byte, []error, error) {
+	return t.DecryptBatchOrderedWithContext(context.Background(), transitPath, keyID, ciphertexts)
+}
+
+// DecryptBatchOrderedWithContext works like DecryptBatchOrdered, but the request is cancelled once ctx is done.
+func (t *Transit) DecryptBatchOrderedWithContext(ctx context.Context, transitPath, keyID string, ciphertexts []string) ([][]byte, []error, error) {
+	return t.decryptBatchOrdered(ctx, transitPath, keyID, ciphertexts, true)
+}
+
+// decryptBatchOrdered implements DecryptBatchOrderedWithContext, the plaintext cache is only used if cached is set.
+func (t *Transit) decryptBatchOrdered(ctx context.Context, transitPath, keyID string, ciphertexts []string, cached bool) ([][]byte, []error, error) {
+	if len(transitPath) == 0 {
+		transitPath = "transit"
+	}
+
+	plaintexts := make([][]byte, len(ciphertexts))
+	errs := make([]error, len(ciphertexts))
+
+	// the indexes of the ciphertexts which aren't cached, only these are sent to Vault
+	uncached := make([]int, 0, len(ciphertexts))
+	for k, ciphertext := range ciphertexts {
+		if !cached {
+			uncached = append(uncached, k)
+		} else if plaintext, ok := t.cache.get(transitCacheKey(transitPath, keyID, ciphertext)); ok {
+			plaintexts[k] = plaintext
+		} else {
+			uncached = append(uncached, k)
+		}
+	}
+
+	if len(uncached) == 0 {
+		return plaintexts, errs, nil
+	}
+
+	batch := make([]string, len(uncached))
+	for k, index := range uncached {
+		batch[k] = ciphertexts[index]
+	}
+
+	batchResults, err := t.decryptBatch(ctx, transitPath, keyID, batch)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(batchResults) != len(batch) {
+		return nil, nil, errors.Errorf("expected %d batch results, got %d", len(batch), len(batchResults))
+	}
+
+	for k, val := range batchResults {
+		index := uncached[k]
+
+		result := cast.ToStringMapString(val)
+		if result["error"] != "" {
+			errs[index] = ciphertextTooOld(keyID, batch[k], errors.New(result["error"]))
+
+			continue
+		}
+
+		plaintexts[index], errs[index] = base64.StdEncoding.DecodeString(result["plaintext"])
+		if errs[index] == nil && cached {
+			t.cache.add(transitCacheKey(transitPath, keyID, batch[k]), plaintexts[index])
+		}
+	}
+
+	return plaintexts, errs, nil
+}
+
+// Encrypt encrypts the plaintext into a ciphertext.
+// ref: https://developer.hashicorp.com/vault/api-docs/secret/transit#encrypt-data
+func (t *Transit) Encrypt(transitPath, keyID string, plaintext []byte) (string, error) {
+	return t.EncryptWithContext(context.Background(), transitPath, keyID, plaintext)
+}
+
+// EncryptWithContext works like Encrypt, but the request is cancelled once ctx is done.
+func (t *Transit) EncryptWithContext(ctx context.Context, transitPath, keyID string, plaintext []byte) (string, error) {
+	if len(transitPath) == 0 {
+		transitPath = "transit"
+	}
+
+	release, err := t.limiter.acquire(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	out, err := t.client.Logical().WriteWithContext(
+		ctx,
+		path.Join(transitPath, "encrypt", keyID),
+		map[string]interface{}{
+			"plaintext": base64.StdEncoding.EncodeToString(plaintext),
+		},
+	)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to encrypt with transit key: %s", keyID)
+	}
+
+	ciphertext, ok := out.Data["ciphertext"].(string)
+	if !ok {
+		return "", errors.New("ciphertext not found in transit response")
+	}
+
+	return ciphertext, nil
+}
+
+// EncryptBatch encrypts the plaintexts into ciphertexts keyed by their plaintexts
+func (t *Transit) EncryptBatch(transitPath, keyID string, plaintexts [][]byte) (map[string]string, error) {
+	return t.EncryptBatchWithContext(context.Background(), transitPath, keyID, plaintexts)
+}
+
+// EncryptBatchWithContext works like EncryptBatch, but the request is cancelled once ctx is done.
+func (t *Transit) EncryptBatchWithContext(ctx context.Context, transitPath, keyID string, plaintexts [][]byte) (map[string]string, error) {
+	if len(transitPath) == 0 {
+		transitPath = "transit"
+	}
+
+	ret := map[string]string{}
+
+	if len(plaintexts) == 0 {
+		return ret, nil
+	}
+
+	batchInput := [](map[string]interface{}){}
+	for _, text := range plaintexts {
+		batchInput = append(batchInput, map[string]interface{}{
+			"plaintext": base64.StdEncoding.EncodeToString(text),
+		})
+	}
+
+	release, err := t.limiter.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	out, err := t.client.Logical().WriteWithContext(
+		ctx,
+		path.Join(transitPath, "encrypt", keyID),
+		map[string]interface{}{
+			"batch_input": batchInput,
+		},
+	)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to encrypt with transit key: %s", keyID)
+	}
+
+	batchResults, ok := out.Data["batch_results"].([]interface{})
+	if !ok {
+		return nil, errors.New("batch_results not found in transit response")
+	}
+
+	if len(batchResults) != len(plaintexts) {
+		return nil, errors.Errorf("expected %d batch results, got %d", len(plaintexts), len(batchResults))
+	}
+
+	for k, val := range batchResults {
+		result := cast.ToStringMapString(val)
+		if result["error"] != "" {
+			return nil, errors.Errorf("failed to encrypt batch item %d: %s", k, result["error"])
+		}
+
+		ret[string(plaintexts[k])] = result["ciphertext"]
+	}
+
+	return ret, nil
+}
+
+func (t *Transit) decryptBatch(ctx context.Context, transitPath, keyID string, ciphertexts []string) ([]interface{}, error) {
 	if len(transitPath) == 0 {
 		// Rewrite to default if not defined, all examples from documentation
 		// uses `transit` path
@@ -71,7 +379,14 @@ func (t *Transit) DecryptBatch(transitPath, keyID string, ciphertexts []string)
 		})
 	}
 
-	out, err := t.client.Logical().Write(
+	release, err := t.limiter.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	out, err := t.client.Logical().WriteWithContext(
+		ctx,
 		path.Join(transitPath, "decrypt", keyID),
 		map[string]interface{}{
 			"batch_input": batchInput,
@@ -81,13 +396,10 @@ func (t *Transit) DecryptBatch(transitPath, keyID string, ciphertexts []string)
 		return nil, err
 	}
 
-	ret := map[string][]byte{}
-	for k, val := range out.Data["batch_results"].([]interface{}) {
-		ret[ciphertexts[k]], err = base64.StdEncoding.DecodeString(val.(map[string]interface{})["plaintext"].(string))
-		if err != nil {
-			return nil, err
-		}
+	batchResults, ok := out.Data["batch_results"].([]interface{})
+	if !ok {
+		return nil, errors.New("batch_results not found in transit response")
 	}
 
-	return ret, nil
+	return batchResults, nil
 }
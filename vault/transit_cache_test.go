@@ -0,0 +1,56 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransitCacheEviction(t *testing.T) {
+	cache := newTransitCache(2)
+
+	cache.add("first", []byte("1"))
+	cache.add("second", []byte("2"))
+
+	// touch first, so second becomes the least recently used one
+	_, ok := cache.get("first")
+	assert.True(t, ok)
+
+	cache.add("third", []byte("3"))
+
+	_, ok = cache.get("second")
+	assert.False(t, ok)
+
+	plaintext, ok := cache.get("first")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("1"), plaintext)
+
+	plaintext, ok = cache.get("third")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("3"), plaintext)
+
+	assert.Equal(t, 2, cache.order.Len())
+}
+
+func TestTransitCacheDisabled(t *testing.T) {
+	var cache *transitCache
+
+	cache.add("first", []byte("1"))
+
+	_, ok := cache.get("first")
+	assert.False(t, ok)
+}
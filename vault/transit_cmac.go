@@ -0,0 +1,96 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"encoding/base64"
+	"path"
+
+	"emperror.dev/errors"
+	"github.com/spf13/cast"
+)
+
+// CMAC generates the CMAC of the input with a CMAC type transit key (e.g. aes256-cmac).
+// A zero macLength uses the default MAC length of the key.
+// ref: https://developer.hashicorp.com/vault/api-docs/secret/transit#generate-cmac
+func (t *Transit) CMAC(ctx context.Context, transitPath, keyID string, input []byte, macLength int) (string, error) {
+	if len(transitPath) == 0 {
+		transitPath = "transit"
+	}
+
+	data := map[string]interface{}{
+		"input": base64.StdEncoding.EncodeToString(input),
+	}
+	if macLength > 0 {
+		data["mac_length"] = macLength
+	}
+
+	release, err := t.limiter.acquire(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	out, err := t.client.Logical().WriteWithContext(ctx, path.Join(transitPath, "cmac", keyID), data)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to generate CMAC with transit key: %s", keyID)
+	}
+
+	if out == nil {
+		return "", errors.New("empty response for transit CMAC generation")
+	}
+
+	cmac := cast.ToString(out.Data["cmac"])
+	if cmac == "" {
+		return "", errors.New("cmac not found in transit response")
+	}
+
+	return cmac, nil
+}
+
+// VerifyCMAC checks if the CMAC (as returned by CMAC) matches the input.
+// The macLength has to be the same the CMAC was generated with, zero means the default MAC length of the key.
+// ref: https://developer.hashicorp.com/vault/api-docs/secret/transit#verify-signed-data
+func (t *Transit) VerifyCMAC(ctx context.Context, transitPath, keyID string, input []byte, cmac string, macLength int) (bool, error) {
+	if len(transitPath) == 0 {
+		transitPath = "transit"
+	}
+
+	data := map[string]interface{}{
+		"input": base64.StdEncoding.EncodeToString(input),
+		"cmac":  cmac,
+	}
+	if macLength > 0 {
+		data["mac_length"] = macLength
+	}
+
+	release, err := t.limiter.acquire(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+
+	out, err := t.client.Logical().WriteWithContext(ctx, path.Join(transitPath, "verify", keyID), data)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to verify CMAC with transit key: %s", keyID)
+	}
+
+	if out == nil {
+		return false, errors.New("empty response for transit CMAC verification")
+	}
+
+	return cast.ToBool(out.Data["valid"]), nil
+}
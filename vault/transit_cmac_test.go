@@ -0,0 +1,83 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	vaultapi "github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCMAC(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if !assert.NoError(t, json.NewDecoder(r.Body).Decode(&body)) {
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+		assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("payload")), body["input"])
+
+		switch r.URL.Path {
+		case "/v1/transit/cmac/mac-key":
+			fmt.Fprintf(w, `{"data": {"cmac": "vault:v1:mac-%v"}}`, body["mac_length"])
+		case "/v1/transit/verify/mac-key":
+			fmt.Fprintf(w, `{"data": {"valid": %t}}`, body["cmac"] == "vault:v1:mac-8")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors": []}`)
+		}
+	}))
+	defer server.Close()
+
+	config := vaultapi.DefaultConfig()
+	config.Address = server.URL
+
+	rawClient, err := vaultapi.NewClient(config)
+	require.NoError(t, err)
+
+	client, err := NewClientFromRawClient(rawClient, ClientToken("token"))
+	require.NoError(t, err)
+	defer client.Close()
+
+	ctx := context.Background()
+
+	cmac, err := client.Transit.CMAC(ctx, "", "mac-key", []byte("payload"), 8)
+	require.NoError(t, err)
+	assert.Equal(t, "vault:v1:mac-8", cmac)
+
+	cmac, err = client.Transit.CMAC(ctx, "", "mac-key", []byte("payload"), 0)
+	require.NoError(t, err)
+	assert.Equal(t, "vault:v1:mac-<nil>", cmac, "mac_length is omitted by default")
+
+	valid, err := client.Transit.VerifyCMAC(ctx, "", "mac-key", []byte("payload"), "vault:v1:mac-8", 8)
+	require.NoError(t, err)
+	assert.True(t, valid)
+
+	valid, err = client.Transit.VerifyCMAC(ctx, "", "mac-key", []byte("payload"), "vault:v1:forged", 8)
+	require.NoError(t, err)
+	assert.False(t, valid)
+
+	_, err = client.Transit.CMAC(ctx, "", "missing-key", []byte("payload"), 0)
+	assert.ErrorContains(t, err, "failed to generate CMAC with transit key: missing-key")
+}
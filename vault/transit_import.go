@@ -0,0 +1,104 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"path"
+
+	"emperror.dev/errors"
+	"github.com/spf13/cast"
+)
+
+// WrappingKey returns the PEM encoded public RSA key of the transit engine,
+// which is used to wrap the keys to be imported with ImportKey and ImportKeyVersion
+// ref: https://developer.hashicorp.com/vault/api-docs/secret/transit#get-wrapping-key
+func (t *Transit) WrappingKey(ctx context.Context, transitPath string) (string, error) {
+	if len(transitPath) == 0 {
+		transitPath = "transit"
+	}
+
+	release, err := t.limiter.acquire(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	out, err := t.client.Logical().ReadWithContext(ctx, path.Join(transitPath, "wrapping_key"))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read transit wrapping key")
+	}
+
+	if out == nil {
+		return "", errors.New("empty response for transit wrapping key")
+	}
+
+	publicKey := cast.ToString(out.Data["public_key"])
+	if publicKey == "" {
+		return "", errors.New("public_key not found in transit response")
+	}
+
+	return publicKey, nil
+}
+
+// ImportKey imports an externally generated key (e.g. from an HSM) as a new transit key.
+// The ciphertext is the base64 encoded key, wrapped with the key returned by WrappingKey,
+// keyType is the transit key type (e.g. aes256-gcm96).
+// ref: https://developer.hashicorp.com/vault/api-docs/secret/transit#import-key
+func (t *Transit) ImportKey(ctx context.Context, transitPath, keyID, ciphertext, keyType string) error {
+	if len(transitPath) == 0 {
+		transitPath = "transit"
+	}
+
+	release, err := t.limiter.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	_, err = t.client.Logical().WriteWithContext(ctx, path.Join(transitPath, "keys", keyID, "import"), map[string]interface{}{
+		"ciphertext": ciphertext,
+		"type":       keyType,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to import transit key: %s", keyID)
+	}
+
+	return nil
+}
+
+// ImportKeyVersion imports an externally generated key as the new version of an existing transit key,
+// which has to be an imported one.
+// ref: https://developer.hashicorp.com/vault/api-docs/secret/transit#import-key-version
+func (t *Transit) ImportKeyVersion(ctx context.Context, transitPath, keyID, ciphertext string) error {
+	if len(transitPath) == 0 {
+		transitPath = "transit"
+	}
+
+	release, err := t.limiter.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	_, err = t.client.Logical().WriteWithContext(ctx, path.Join(transitPath, "keys", keyID, "import_version"), map[string]interface{}{
+		"ciphertext": ciphertext,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to import transit key version: %s", keyID)
+	}
+
+	return nil
+}
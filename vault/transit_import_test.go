@@ -0,0 +1,115 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	vaultapi "github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportKey(t *testing.T) {
+	var wrappingKey atomic.Value
+	wrappingKey.Store(`{"data": {"public_key": "-----BEGIN PUBLIC KEY-----\nMIIB\n-----END PUBLIC KEY-----\n"}}`)
+
+	var requests []string
+	var bodies []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+
+		switch r.URL.Path {
+		case "/v1/transit/wrapping_key":
+			response := wrappingKey.Load().(string)
+			if response == "" {
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, `{"errors": []}`)
+
+				return
+			}
+			fmt.Fprint(w, response)
+		case "/v1/transit/keys/app/import", "/v1/transit/keys/app/import_version":
+			var body map[string]interface{}
+			if !assert.NoError(t, json.NewDecoder(r.Body).Decode(&body)) {
+				w.WriteHeader(http.StatusBadRequest)
+
+				return
+			}
+			bodies = append(bodies, body)
+
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"errors": ["key is not imported"]}`)
+		}
+	}))
+	defer server.Close()
+
+	config := vaultapi.DefaultConfig()
+	config.Address = server.URL
+
+	rawClient, err := vaultapi.NewClient(config)
+	require.NoError(t, err)
+
+	client, err := NewClientFromRawClient(rawClient, ClientToken("token"))
+	require.NoError(t, err)
+	defer client.Close()
+
+	ctx := context.Background()
+
+	publicKey, err := client.Transit.WrappingKey(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, "-----BEGIN PUBLIC KEY-----\nMIIB\n-----END PUBLIC KEY-----\n", publicKey)
+
+	require.NoError(t, client.Transit.ImportKey(ctx, "", "app", "d3JhcHBlZA==", "aes256-gcm96"))
+	require.NoError(t, client.Transit.ImportKeyVersion(ctx, "transit", "app", "bmV3IHZlcnNpb24="))
+
+	err = client.Transit.ImportKeyVersion(ctx, "", "generated", "bmV3IHZlcnNpb24=")
+	assert.ErrorContains(t, err, "failed to import transit key version: generated")
+
+	assert.Equal(t, []string{
+		"GET /v1/transit/wrapping_key",
+		"PUT /v1/transit/keys/app/import",
+		"PUT /v1/transit/keys/app/import_version",
+		"PUT /v1/transit/keys/generated/import_version",
+	}, requests)
+	assert.Equal(t, []map[string]interface{}{
+		{"ciphertext": "d3JhcHBlZA==", "type": "aes256-gcm96"},
+		{"ciphertext": "bmV3IHZlcnNpb24="},
+	}, bodies)
+
+	wrappingKey.Store(`{"data": {}}`)
+	_, err = client.Transit.WrappingKey(ctx, "")
+	assert.EqualError(t, err, "public_key not found in transit response")
+
+	wrappingKey.Store(`{"data": {"public_key": {"n": 1}}}`)
+	_, err = client.Transit.WrappingKey(ctx, "")
+	assert.EqualError(t, err, "public_key not found in transit response")
+
+	wrappingKey.Store("")
+	_, err = client.Transit.WrappingKey(ctx, "")
+	assert.EqualError(t, err, "empty response for transit wrapping key")
+
+	wrappingKey.Store("not json")
+	_, err = client.Transit.WrappingKey(ctx, "")
+	assert.ErrorContains(t, err, "failed to read transit wrapping key")
+}
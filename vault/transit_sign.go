@@ -0,0 +1,159 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"encoding/base64"
+	"path"
+
+	"emperror.dev/errors"
+	"github.com/spf13/cast"
+)
+
+// defaultHashAlgorithm is the hash algorithm of Transit.Sign and Transit.Verify if none is given.
+const defaultHashAlgorithm = "sha2-256"
+
+// SignOption configures the algorithms of Transit.Sign, Transit.Verify and Transit.VerifyBatch.
+type SignOption interface {
+	apply(o *signOptions)
+}
+
+type signOptions struct {
+	hashAlgorithm      string
+	signatureAlgorithm string
+	prehashed          bool
+}
+
+// HashAlgorithm is the hash algorithm of the input (e.g. sha2-512), sha2-256 by default.
+// ref: https://developer.hashicorp.com/vault/api-docs/secret/transit#hash_algorithm
+type HashAlgorithm string
+
+func (so HashAlgorithm) apply(o *signOptions) {
+	o.hashAlgorithm = string(so)
+}
+
+// SignatureAlgorithm is the signature algorithm of RSA keys (pss or pkcs1v15), the default of Vault is pss.
+// ref: https://developer.hashicorp.com/vault/api-docs/secret/transit#signature_algorithm
+type SignatureAlgorithm string
+
+func (so SignatureAlgorithm) apply(o *signOptions) {
+	o.signatureAlgorithm = string(so)
+}
+
+// Prehashed marks the input as already hashed with the hash algorithm, so Vault doesn't hash it again.
+// ref: https://developer.hashicorp.com/vault/api-docs/secret/transit#prehashed
+type Prehashed bool
+
+func (so Prehashed) apply(o *signOptions) {
+	o.prehashed = bool(so)
+}
+
+// signParameters returns the request data of the options of a sign or verify request.
+func signParameters(opts []SignOption) map[string]interface{} {
+	o := signOptions{hashAlgorithm: defaultHashAlgorithm}
+	for _, opt := range opts {
+		opt.apply(&o)
+	}
+
+	data := map[string]interface{}{
+		"hash_algorithm": o.hashAlgorithm,
+	}
+	if o.signatureAlgorithm != "" {
+		data["signature_algorithm"] = o.signatureAlgorithm
+	}
+	if o.prehashed {
+		data["prehashed"] = true
+	}
+
+	return data
+}
+
+// signData returns the request data of a sign or verify request of the input.
+func signData(input []byte, opts []SignOption) map[string]interface{} {
+	data := signParameters(opts)
+	data["input"] = base64.StdEncoding.EncodeToString(input)
+
+	return data
+}
+
+// Sign signs the input with the given transit key, and returns the signature (e.g. vault:v1:...).
+// ref: https://developer.hashicorp.com/vault/api-docs/secret/transit#sign-data
+func (t *Transit) Sign(transitPath, keyID string, input []byte, opts ...SignOption) (string, error) {
+	return t.SignWithContext(context.Background(), transitPath, keyID, input, opts...)
+}
+
+// SignWithContext works like Sign, but the request is cancelled once ctx is done.
+func (t *Transit) SignWithContext(ctx context.Context, transitPath, keyID string, input []byte, opts ...SignOption) (string, error) {
+	if len(transitPath) == 0 {
+		transitPath = "transit"
+	}
+
+	release, err := t.limiter.acquire(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	out, err := t.client.Logical().WriteWithContext(ctx, path.Join(transitPath, "sign", keyID), signData(input, opts))
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to sign with transit key: %s", keyID)
+	}
+
+	if out == nil {
+		return "", errors.New("empty response for transit signing")
+	}
+
+	signature := cast.ToString(out.Data["signature"])
+	if signature == "" {
+		return "", errors.New("signature not found in transit response")
+	}
+
+	return signature, nil
+}
+
+// Verify checks if the signature (as returned by Sign) is valid for the input.
+// The options have to be the same the signature was created with.
+// ref: https://developer.hashicorp.com/vault/api-docs/secret/transit#verify-signed-data
+func (t *Transit) Verify(transitPath, keyID string, input []byte, signature string, opts ...SignOption) (bool, error) {
+	return t.VerifyWithContext(context.Background(), transitPath, keyID, input, signature, opts...)
+}
+
+// VerifyWithContext works like Verify, but the request is cancelled once ctx is done.
+func (t *Transit) VerifyWithContext(ctx context.Context, transitPath, keyID string, input []byte, signature string, opts ...SignOption) (bool, error) {
+	if len(transitPath) == 0 {
+		transitPath = "transit"
+	}
+
+	data := signData(input, opts)
+	data["signature"] = signature
+
+	release, err := t.limiter.acquire(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+
+	out, err := t.client.Logical().WriteWithContext(ctx, path.Join(transitPath, "verify", keyID), data)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to verify signature with transit key: %s", keyID)
+	}
+
+	if out == nil {
+		return false, errors.New("empty response for transit signature verification")
+	}
+
+	return cast.ToBool(out.Data["valid"]), nil
+}
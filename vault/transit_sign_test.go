@@ -0,0 +1,82 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	vaultapi "github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if !assert.NoError(t, json.NewDecoder(r.Body).Decode(&body)) {
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+		assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("payload")), body["input"])
+
+		signature := fmt.Sprintf("vault:v1:%v-%v-%v", body["hash_algorithm"], body["signature_algorithm"], body["prehashed"])
+
+		switch r.URL.Path {
+		case "/v1/transit/sign/webhook":
+			fmt.Fprintf(w, `{"data": {"signature": %q}}`, signature)
+		case "/v1/transit/verify/webhook":
+			fmt.Fprintf(w, `{"data": {"valid": %t}}`, body["signature"] == signature)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors": []}`)
+		}
+	}))
+	defer server.Close()
+
+	config := vaultapi.DefaultConfig()
+	config.Address = server.URL
+
+	rawClient, err := vaultapi.NewClient(config)
+	require.NoError(t, err)
+
+	client, err := NewClientFromRawClient(rawClient, ClientToken("token"))
+	require.NoError(t, err)
+	defer client.Close()
+
+	signature, err := client.Transit.Sign("", "webhook", []byte("payload"))
+	require.NoError(t, err)
+	assert.Equal(t, "vault:v1:sha2-256-<nil>-<nil>", signature)
+
+	valid, err := client.Transit.Verify("", "webhook", []byte("payload"), signature)
+	require.NoError(t, err)
+	assert.True(t, valid)
+
+	signature, err = client.Transit.Sign("transit", "webhook", []byte("payload"), HashAlgorithm("sha2-512"), SignatureAlgorithm("pkcs1v15"), Prehashed(true))
+	require.NoError(t, err)
+	assert.Equal(t, "vault:v1:sha2-512-pkcs1v15-true", signature)
+
+	valid, err = client.Transit.Verify("transit", "webhook", []byte("payload"), signature)
+	require.NoError(t, err)
+	assert.False(t, valid, "the signature is verified with other algorithms")
+
+	_, err = client.Transit.Sign("", "missing", []byte("payload"))
+	assert.ErrorContains(t, err, "failed to sign with transit key: missing")
+}
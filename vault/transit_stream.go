@@ -0,0 +1,122 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+
+	"emperror.dev/errors"
+)
+
+const (
+	// streamBatchSize is the number of chunks decrypted with one transit request
+	streamBatchSize = 64
+	// maxStreamChunkSize protects against allocating huge buffers for corrupt length prefixes
+	maxStreamChunkSize = 64 << 20
+)
+
+// WriteStreamChunk writes a ciphertext chunk in the framing read by DecryptStream:
+// the length of the ciphertext as a 4 byte big-endian unsigned integer, followed by the ciphertext
+// as returned by the transit engine (e.g. vault:v1:...).
+// A stream is a sequence of such chunks, the plaintexts of the chunks are concatenated in order.
+func WriteStreamChunk(w io.Writer, ciphertext string) error {
+	if len(ciphertext) > maxStreamChunkSize {
+		return errors.Errorf("ciphertext chunk is larger than %d bytes", maxStreamChunkSize)
+	}
+
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(ciphertext))) //nolint:gosec
+
+	if _, err := w.Write(length[:]); err != nil {
+		return errors.Wrap(err, "failed to write chunk length")
+	}
+
+	if _, err := io.WriteString(w, ciphertext); err != nil {
+		return errors.Wrap(err, "failed to write chunk")
+	}
+
+	return nil
+}
+
+// DecryptStream decrypts a stream of ciphertext chunks framed as described at WriteStreamChunk from r,
+// and writes the plaintexts to w. Only a batch of chunks is held in memory at a time,
+// so arbitrarily large streams can be decrypted. The plaintexts of the chunks aren't cached (see ClientTransitCacheSize).
+func (t *Transit) DecryptStream(ctx context.Context, transitPath, keyID string, r io.Reader, w io.Writer) error {
+	batch := make([]string, 0, streamBatchSize)
+	offset := 0
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// the chunks aren't cached, they would only evict the cached secrets
+		plaintexts, errs, err := t.decryptBatchOrdered(ctx, transitPath, keyID, batch, false)
+		if err != nil {
+			return errors.Wrapf(err, "failed to decrypt chunks %d-%d", offset, offset+len(batch)-1)
+		}
+
+		for k, plaintext := range plaintexts {
+			if errs[k] != nil {
+				return errors.Wrapf(errs[k], "failed to decrypt chunk %d", offset+k)
+			}
+
+			if _, err := w.Write(plaintext); err != nil {
+				return errors.Wrap(err, "failed to write plaintext")
+			}
+		}
+
+		offset += len(batch)
+		batch = batch[:0]
+
+		return nil
+	}
+
+	var length [4]byte
+
+	for {
+		if _, err := io.ReadFull(r, length[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				return flush()
+			}
+
+			return errors.Wrapf(err, "failed to read length of chunk %d", offset+len(batch))
+		}
+
+		size := binary.BigEndian.Uint32(length[:])
+		if size > maxStreamChunkSize {
+			return errors.Errorf("chunk %d is larger than %d bytes", offset+len(batch), maxStreamChunkSize)
+		}
+
+		chunk := make([]byte, size)
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return errors.Wrapf(err, "failed to read chunk %d", offset+len(batch))
+		}
+
+		batch = append(batch, string(chunk))
+
+		if len(batch) == streamBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
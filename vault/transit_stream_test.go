@@ -0,0 +1,130 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	vaultapi "github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecryptStream(t *testing.T) {
+	// the fake transit engine "decrypts" vault:v1:<text> to <text>
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			BatchInput []map[string]string `json:"batch_input"`
+		}
+		if !assert.NoError(t, json.NewDecoder(r.Body).Decode(&request)) {
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		results := []map[string]string{}
+		for _, input := range request.BatchInput {
+			plaintext := strings.TrimPrefix(input["ciphertext"], "vault:v1:")
+			results = append(results, map[string]string{"plaintext": base64.StdEncoding.EncodeToString([]byte(plaintext))})
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"batch_results": results}})
+	}))
+	defer server.Close()
+
+	config := vaultapi.DefaultConfig()
+	config.Address = server.URL
+
+	rawClient, err := vaultapi.NewClient(config)
+	require.NoError(t, err)
+
+	client, err := NewClientFromRawClient(rawClient, ClientToken("token"), ClientTransitCacheSize(10))
+	require.NoError(t, err)
+	defer client.Close()
+
+	stream := bytes.Buffer{}
+	expected := strings.Builder{}
+
+	// more chunks than fit into one batch
+	for i := 0; i < 2*streamBatchSize+1; i++ {
+		require.NoError(t, WriteStreamChunk(&stream, fmt.Sprintf("vault:v1:chunk-%d;", i)))
+		fmt.Fprintf(&expected, "chunk-%d;", i)
+	}
+
+	plaintext := bytes.Buffer{}
+	require.NoError(t, client.Transit.DecryptStream(context.Background(), "", "key", &stream, &plaintext))
+	assert.Equal(t, expected.String(), plaintext.String())
+	assert.Equal(t, 0, client.Transit.cache.order.Len(), "the chunks aren't cached")
+
+	truncated := bytes.NewReader([]byte{0, 0, 0, 10, 'v'})
+	err = client.Transit.DecryptStream(context.Background(), "", "key", truncated, &plaintext)
+	assert.ErrorContains(t, err, "failed to read chunk 0")
+}
+
+func TestDecryptStreamCancelled(t *testing.T) {
+	var requests atomic.Int32
+	started := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		// the closed connection is noticed only after the body is read
+		_, _ = io.Copy(io.Discard, r.Body)
+		requests.Add(1)
+		started <- struct{}{}
+
+		select {
+		case <-r.Context().Done():
+		case <-time.After(10 * time.Second):
+		}
+	}))
+	defer server.Close()
+
+	config := vaultapi.DefaultConfig()
+	config.Address = server.URL
+
+	rawClient, err := vaultapi.NewClient(config)
+	require.NoError(t, err)
+
+	client, err := NewClientFromRawClient(rawClient, ClientToken("token"))
+	require.NoError(t, err)
+	defer client.Close()
+
+	stream := bytes.Buffer{}
+	for i := 0; i < 2*streamBatchSize; i++ {
+		require.NoError(t, WriteStreamChunk(&stream, fmt.Sprintf("vault:v1:chunk-%d;", i)))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	start := time.Now()
+	err = client.Transit.DecryptStream(ctx, "", "key", &stream, io.Discard)
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, time.Since(start), 5*time.Second, "the in-flight batch should be cancelled")
+	assert.EqualValues(t, 1, requests.Load())
+}
@@ -14,7 +14,20 @@
 
 package vault
 
-import "testing"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	vaultapi "github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
 
 func TestIsEncrypted(t *testing.T) {
 	// value to valid map
@@ -58,3 +71,155 @@ func TestIsEncrypted(t *testing.T) {
 		}
 	}
 }
+
+func TestCiphertextTooOld(t *testing.T) {
+	vaultErr := errors.New("Code: 400. Errors:\n\n* ciphertext or hmac version is disallowed by policy (too old)")
+
+	err := ciphertextTooOld("app", "vault:v3:aGVsbG8=", vaultErr)
+
+	var tooOld *CiphertextTooOldError
+	require.ErrorAs(t, err, &tooOld)
+	assert.Equal(t, "app", tooOld.KeyID)
+	assert.Equal(t, 3, tooOld.Version)
+	assert.ErrorIs(t, err, vaultErr)
+
+	otherErr := errors.New("Code: 400. Errors:\n\n* invalid ciphertext: no prefix")
+	assert.Equal(t, otherErr, ciphertextTooOld("app", "garbage", otherErr))
+	assert.NoError(t, ciphertextTooOld("app", "vault:v3:aGVsbG8=", nil))
+}
+
+func TestEncrypt(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/transit/encrypt/app" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors": []}`)
+
+			return
+		}
+
+		var body struct {
+			Plaintext  string `json:"plaintext"`
+			BatchInput []struct {
+				Plaintext string `json:"plaintext"`
+			} `json:"batch_input"`
+		}
+		if !assert.NoError(t, json.NewDecoder(r.Body).Decode(&body)) {
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		if body.BatchInput == nil {
+			fmt.Fprintf(w, `{"data": {"ciphertext": "vault:v1:%s"}}`, body.Plaintext)
+
+			return
+		}
+
+		results := make([]map[string]string, 0, len(body.BatchInput))
+		for _, input := range body.BatchInput {
+			results = append(results, map[string]string{"ciphertext": "vault:v1:" + input.Plaintext})
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"batch_results": results}}))
+	}))
+	defer server.Close()
+
+	config := vaultapi.DefaultConfig()
+	config.Address = server.URL
+
+	rawClient, err := vaultapi.NewClient(config)
+	require.NoError(t, err)
+
+	client, err := NewClientFromRawClient(rawClient, ClientToken("token"))
+	require.NoError(t, err)
+	defer client.Close()
+
+	ciphertext, err := client.Transit.Encrypt("", "app", []byte("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, "vault:v1:aGVsbG8=", ciphertext)
+
+	ciphertexts, err := client.Transit.EncryptBatch("transit", "app", [][]byte{[]byte("hello"), []byte("world")})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"hello": "vault:v1:aGVsbG8=", "world": "vault:v1:d29ybGQ="}, ciphertexts)
+
+	_, err = client.Transit.Encrypt("", "missing", []byte("hello"))
+	assert.ErrorContains(t, err, "failed to encrypt with transit key: missing")
+}
+
+func TestDecryptBatchOrdered(t *testing.T) {
+	var batches [][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/transit/decrypt/app" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors": []}`)
+
+			return
+		}
+
+		var body struct {
+			BatchInput []struct {
+				Ciphertext string `json:"ciphertext"`
+			} `json:"batch_input"`
+		}
+		if !assert.NoError(t, json.NewDecoder(r.Body).Decode(&body)) {
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		batch := make([]string, 0, len(body.BatchInput))
+		results := make([]map[string]string, 0, len(body.BatchInput))
+		for _, input := range body.BatchInput {
+			batch = append(batch, input.Ciphertext)
+
+			switch plaintext, _ := strings.CutPrefix(input.Ciphertext, "vault:v1:"); plaintext {
+			case "old":
+				results = append(results, map[string]string{"error": "ciphertext or hmac version is disallowed by policy (too old)"})
+			case "invalid":
+				results = append(results, map[string]string{"error": "invalid ciphertext: no prefix"})
+			default:
+				results = append(results, map[string]string{"plaintext": plaintext})
+			}
+		}
+		batches = append(batches, batch)
+
+		require.NoError(t, json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"batch_results": results}}))
+	}))
+	defer server.Close()
+
+	config := vaultapi.DefaultConfig()
+	config.Address = server.URL
+
+	rawClient, err := vaultapi.NewClient(config)
+	require.NoError(t, err)
+
+	client, err := NewClientFromRawClient(rawClient, ClientToken("token"), ClientTransitCacheSize(10))
+	require.NoError(t, err)
+	defer client.Close()
+
+	hello := "vault:v1:aGVsbG8="
+	world := "vault:v1:d29ybGQ="
+
+	plaintexts, errs, err := client.Transit.DecryptBatchOrdered("", "app", []string{hello, "vault:v1:old", world, "vault:v1:invalid", hello})
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("hello"), nil, []byte("world"), nil, []byte("hello")}, plaintexts)
+	require.Len(t, errs, 5)
+	assert.NoError(t, errs[0])
+	var tooOld *CiphertextTooOldError
+	assert.ErrorAs(t, errs[1], &tooOld)
+	assert.NoError(t, errs[2])
+	assert.EqualError(t, errs[3], "invalid ciphertext: no prefix")
+	assert.NoError(t, errs[4])
+
+	// the decrypted ciphertexts are served from the cache, only the failed ones are sent again
+	plaintexts, errs, err = client.Transit.DecryptBatchOrderedWithContext(context.Background(), "transit", "app", []string{"vault:v1:invalid", world, hello})
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{nil, []byte("world"), []byte("hello")}, plaintexts)
+	assert.Error(t, errs[0])
+	assert.NoError(t, errs[1])
+	assert.NoError(t, errs[2])
+
+	assert.Equal(t, [][]string{
+		{hello, "vault:v1:old", world, "vault:v1:invalid", hello},
+		{"vault:v1:invalid"},
+	}, batches)
+}
@@ -0,0 +1,133 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"path"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/spf13/cast"
+)
+
+// verifyBatchSize is the number of signatures verified with one request.
+const verifyBatchSize = 256
+
+// VerifyInput is a signed payload to be verified by Transit.VerifyBatch.
+type VerifyInput struct {
+	// Input is the signed data, it's base64 encoded by VerifyBatch.
+	Input []byte
+	// Signature is the signature as returned by transit (e.g. vault:v1:...).
+	Signature string
+}
+
+// BatchItemErrors holds the errors of a batch operation aligned to its inputs,
+// a nil error means that the item at that index was processed.
+type BatchItemErrors []error
+
+func (e BatchItemErrors) Error() string {
+	var messages []string
+	for k, err := range e {
+		if err != nil {
+			messages = append(messages, fmt.Sprintf("item %d: %s", k, err))
+		}
+	}
+
+	return "batch items failed: " + strings.Join(messages, "; ")
+}
+
+// VerifyBatch verifies the signatures of the inputs with the given transit key, in batches of verifyBatchSize.
+// The results are aligned to the inputs. If some of the inputs couldn't be verified (e.g. a malformed signature),
+// the results of the others are still returned, along with a BatchItemErrors.
+// The options apply to all inputs, they have to be the same the signatures were created with.
+// ref: https://developer.hashicorp.com/vault/api-docs/secret/transit#verify-signed-data
+func (t *Transit) VerifyBatch(ctx context.Context, transitPath, keyID string, inputs []VerifyInput, opts ...SignOption) ([]bool, error) {
+	if len(transitPath) == 0 {
+		transitPath = "transit"
+	}
+
+	results := make([]bool, len(inputs))
+	itemErrs := make(BatchItemErrors, len(inputs))
+	failed := false
+
+	for start := 0; start < len(inputs); start += verifyBatchSize {
+		end := min(start+verifyBatchSize, len(inputs))
+
+		batchResults, err := t.verifyBatch(ctx, transitPath, keyID, inputs[start:end], opts)
+		if err != nil {
+			return nil, err
+		}
+
+		for k, val := range batchResults {
+			result := cast.ToStringMap(val)
+			if message := cast.ToString(result["error"]); message != "" {
+				itemErrs[start+k] = errors.New(message)
+				failed = true
+
+				continue
+			}
+
+			results[start+k] = cast.ToBool(result["valid"])
+		}
+	}
+
+	if failed {
+		return results, itemErrs
+	}
+
+	return results, nil
+}
+
+func (t *Transit) verifyBatch(ctx context.Context, transitPath, keyID string, inputs []VerifyInput, opts []SignOption) ([]interface{}, error) {
+	batchInput := make([]map[string]interface{}, 0, len(inputs))
+	for _, input := range inputs {
+		batchInput = append(batchInput, map[string]interface{}{
+			"input":     base64.StdEncoding.EncodeToString(input.Input),
+			"signature": input.Signature,
+		})
+	}
+
+	release, err := t.limiter.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	data := signParameters(opts)
+	data["batch_input"] = batchInput
+
+	out, err := t.client.Logical().WriteWithContext(ctx, path.Join(transitPath, "verify", keyID), data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to verify signatures with transit key: %s", keyID)
+	}
+
+	if out == nil {
+		return nil, errors.New("empty response for transit batch verification")
+	}
+
+	batchResults, ok := out.Data["batch_results"].([]interface{})
+	if !ok {
+		return nil, errors.New("batch_results not found in transit response")
+	}
+
+	if len(batchResults) != len(inputs) {
+		return nil, errors.Errorf("expected %d batch results, got %d", len(inputs), len(batchResults))
+	}
+
+	return batchResults, nil
+}
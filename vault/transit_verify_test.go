@@ -0,0 +1,107 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	vaultapi "github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyBatch(t *testing.T) {
+	requests := 0
+	var parameters []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Equal(t, "/v1/transit/verify/signing", r.URL.Path)
+
+		var body struct {
+			BatchInput         []map[string]string `json:"batch_input"`
+			HashAlgorithm      string              `json:"hash_algorithm"`
+			SignatureAlgorithm string              `json:"signature_algorithm"`
+			Prehashed          bool                `json:"prehashed"`
+		}
+		if !assert.NoError(t, json.NewDecoder(r.Body).Decode(&body)) {
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+		parameters = append(parameters, fmt.Sprintf("%s-%s-%t", body.HashAlgorithm, body.SignatureAlgorithm, body.Prehashed))
+
+		results := make([]map[string]interface{}, 0, len(body.BatchInput))
+		for _, input := range body.BatchInput {
+			switch input["signature"] {
+			case "vault:v1:good":
+				results = append(results, map[string]interface{}{"valid": true})
+			case "vault:v1:forged":
+				results = append(results, map[string]interface{}{"valid": false})
+			default:
+				results = append(results, map[string]interface{}{"error": "invalid signature"})
+			}
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"batch_results": results}})
+	}))
+	defer server.Close()
+
+	config := vaultapi.DefaultConfig()
+	config.Address = server.URL
+
+	rawClient, err := vaultapi.NewClient(config)
+	require.NoError(t, err)
+
+	client, err := NewClientFromRawClient(rawClient, ClientToken("token"))
+	require.NoError(t, err)
+	defer client.Close()
+
+	inputs := make([]VerifyInput, verifyBatchSize+2)
+	for k := range inputs {
+		inputs[k] = VerifyInput{Input: []byte("payload"), Signature: "vault:v1:good"}
+	}
+	inputs[1].Signature = "vault:v1:forged"
+	inputs[verifyBatchSize+1].Signature = "garbage"
+
+	results, err := client.Transit.VerifyBatch(context.Background(), "", "signing", inputs)
+	assert.Equal(t, 2, requests)
+
+	var itemErrs BatchItemErrors
+	require.ErrorAs(t, err, &itemErrs)
+	assert.EqualError(t, err, "batch items failed: item 257: invalid signature")
+	assert.Len(t, itemErrs, len(inputs))
+
+	require.Len(t, results, len(inputs))
+	assert.True(t, results[0])
+	assert.False(t, results[1])
+	assert.True(t, results[verifyBatchSize])
+	assert.False(t, results[verifyBatchSize+1])
+
+	// the options are sent with every batch
+	_, err = client.Transit.VerifyBatch(context.Background(), "", "signing", inputs, HashAlgorithm("sha2-512"), SignatureAlgorithm("pkcs1v15"), Prehashed(true))
+	require.ErrorAs(t, err, &itemErrs)
+	assert.Equal(t, []string{
+		"sha2-256--false",
+		"sha2-256--false",
+		"sha2-512-pkcs1v15-true",
+		"sha2-512-pkcs1v15-true",
+	}, parameters)
+}
@@ -0,0 +1,70 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/spf13/cast"
+)
+
+// WrapInfo contains the details of a response wrapping token.
+type WrapInfo struct {
+	// CreationPath is the path of the request whose response got wrapped (e.g. auth/approle/role/app/secret-id).
+	CreationPath string
+	CreationTime time.Time
+	TTL          time.Duration
+}
+
+// WrapLookup looks up a response wrapping token without unwrapping it, so its creation path and TTL
+// can be verified before unwrapping it with RawClient().Logical().UnwrapWithContext.
+// A token which was already unwrapped or which has expired results in an error.
+// ref: https://developer.hashicorp.com/vault/api-docs/system/wrapping-lookup
+func (client *Client) WrapLookup(ctx context.Context, token string) (*WrapInfo, error) {
+	release, err := client.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	secret, err := client.client.Logical().WriteWithContext(ctx, "sys/wrapping/lookup", map[string]interface{}{
+		"token": token,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to look up wrapping token")
+	}
+
+	if secret == nil || secret.Data == nil {
+		return nil, errors.New("empty response for wrapping token lookup")
+	}
+
+	ttl, err := cast.ToInt64E(secret.Data["creation_ttl"])
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse wrapping token TTL")
+	}
+
+	creationTime, err := time.Parse(time.RFC3339Nano, cast.ToString(secret.Data["creation_time"]))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse wrapping token creation time")
+	}
+
+	return &WrapInfo{
+		CreationPath: cast.ToString(secret.Data["creation_path"]),
+		CreationTime: creationTime,
+		TTL:          time.Duration(ttl) * time.Second,
+	}, nil
+}
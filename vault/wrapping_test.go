@@ -0,0 +1,67 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	vaultapi "github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrapLookup(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+
+		if r.URL.Path != "/v1/sys/wrapping/lookup" || body["token"] != "wrapping-token" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"errors": ["wrapping token is not valid or does not exist"]}`)
+
+			return
+		}
+
+		fmt.Fprint(w, `{"data": {"creation_path": "auth/approle/role/app/secret-id", "creation_time": "2024-05-01T10:00:00.123456Z", "creation_ttl": 300}}`)
+	}))
+	defer server.Close()
+
+	config := vaultapi.DefaultConfig()
+	config.Address = server.URL
+
+	rawClient, err := vaultapi.NewClient(config)
+	require.NoError(t, err)
+
+	client, err := NewClientFromRawClient(rawClient, ClientToken("token"))
+	require.NoError(t, err)
+	defer client.Close()
+
+	info, err := client.WrapLookup(context.Background(), "wrapping-token")
+	require.NoError(t, err)
+	assert.Equal(t, &WrapInfo{
+		CreationPath: "auth/approle/role/app/secret-id",
+		CreationTime: time.Date(2024, 5, 1, 10, 0, 0, 123456000, time.UTC),
+		TTL:          5 * time.Minute,
+	}, info)
+
+	_, err = client.WrapLookup(context.Background(), "unwrapped-token")
+	assert.ErrorContains(t, err, "wrapping token is not valid or does not exist")
+}